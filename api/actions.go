@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/remediation"
+)
+
+// actionsReport is the response body of the /actions endpoint
+type actionsReport struct {
+	Actions []remediation.Proposal `json:"actions"`
+}
+
+// authenticateApprover returns the name of the approver whose bearer token
+// authenticates the request. Otherwise, it writes an error response and
+// returns false.
+func authenticateApprover(w http.ResponseWriter, r *http.Request, approval *config.ApprovalConfig) (string, bool) {
+	if len(approval.Approvers) == 0 {
+		http.Error(w, "remediation approval is not enabled", http.StatusNotFound)
+		return "", false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="watchtower"`)
+		http.Error(w, "bearer token required", http.StatusUnauthorized)
+		return "", false
+	}
+	approver, ok := approval.Authenticate(token)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="watchtower", error="invalid_token"`)
+		http.Error(w, "invalid bearer token", http.StatusUnauthorized)
+		return "", false
+	}
+	return approver, true
+}
+
+// writeJSON writes body as the JSON response to a request to endpoint
+func writeJSON(w http.ResponseWriter, endpoint string, body interface{}) {
+	jsonResp, err := json.Marshal(body)
+	if err != nil {
+		logger.Errorw("JSON marshal failure during "+endpoint+" request",
+			"error", err.Error(),
+		)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeResponse(w, endpoint, "application/json", jsonResp)
+}
+
+// actionsHandler returns the queue of remediation actions proposed for approval
+// as JSON. Requests must be authenticated with the bearer token of an approver.
+func actionsHandler(store *config.Store, remediator *remediation.Remediator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conf := store.Get()
+		if _, ok := authenticateApprover(w, r, &conf.Data.Remediation.Approval); !ok {
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, "/actions", actionsReport{Actions: remediator.Proposals()})
+	}
+}
+
+// actionDecisionHandler approves or rejects a proposed remediation action with
+// POST /actions/{id}/approve or POST /actions/{id}/reject, on behalf of the
+// approver whose bearer token authenticates the request. The decided proposal is
+// returned as JSON.
+func actionDecisionHandler(store *config.Store, remediator *remediation.Remediator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conf := store.Get()
+		approver, ok := authenticateApprover(w, r, &conf.Data.Remediation.Approval)
+		if !ok {
+			return
+		}
+		id, decision, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/actions/"), "/")
+		if id == "" || (decision != "approve" && decision != "reject") {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		proposal, err := remediator.Decide(&conf, id, decision == "approve", approver)
+		switch {
+		case errors.Is(err, remediation.ErrProposalNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, remediation.ErrProposalDecided):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			writeJSON(w, r.URL.Path, proposal)
+		}
+	}
+}
@@ -8,6 +8,9 @@ import (
 	"time"
 
 	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+	"github.com/18F/watchtower/history"
+	"github.com/18F/watchtower/remediation"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v2"
@@ -38,7 +41,9 @@ func healthHandler(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
-func registerEndpoints(conf *config.Config) {
+func registerEndpoints(store *config.Store, findings *drift.Findings, historyStore *history.Store, remediator *remediation.Remediator) {
+	conf := store.Get()
+
 	// Set global api variables
 	bindPort = conf.Data.GlobalConfig.HTTPBindPort
 	cloudControllerInfoEndpoint = conf.Data.GlobalConfig.CloudControllerURL + "/v2/info"
@@ -47,11 +52,16 @@ func registerEndpoints(conf *config.Config) {
 
 	http.HandleFunc("/health", healthHandler)
 
-	yamlBytes, err := yaml.Marshal(conf.Data)
-	if err != nil {
-		logger.Fatalf("Failed marshalling config to yaml for /config endpoint: %v", err)
-	}
 	http.HandleFunc("/config", func(w http.ResponseWriter, _ *http.Request) {
+		// Marshal on every request so that reloaded configs are reflected
+		yamlBytes, err := yaml.Marshal(store.Get().Data)
+		if err != nil {
+			logger.Errorw("failed marshalling config to yaml for /config request",
+				"error", err.Error(),
+			)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 		if _, err := w.Write(yamlBytes); err != nil {
 			logger.Errorw("failed writing response to /config request",
 				"error", err.Error(),
@@ -59,18 +69,29 @@ func registerEndpoints(conf *config.Config) {
 		}
 	})
 
+	http.HandleFunc("/drift", driftHandler(findings))
+	http.HandleFunc("/drift/patch", driftPatchHandler(store, findings))
+	http.HandleFunc("/drift/history", driftHistoryHandler(historyStore))
+	http.HandleFunc("/actions", actionsHandler(store, remediator))
+	http.HandleFunc("/actions/", actionDecisionHandler(store, remediator))
+
 	http.Handle("/metrics", promhttp.Handler())
 }
 
 // Serve registers the Watchtower endpoints to the http DefaultServeMux, begins
-// listening for incoming connections, and monitoring health of the app.
-func Serve(conf *config.Config, zapLogger *zap.SugaredLogger) error {
+// listening for incoming connections, and monitoring health of the app. historyStore
+// may be nil if drift history is not recorded.
+func Serve(store *config.Store, findings *drift.Findings, historyStore *history.Store,
+	remediator *remediation.Remediator, zapLogger *zap.SugaredLogger) error {
 	if zapLogger == nil {
 		return errors.New("cannot call api.Serve with nil logger")
 	}
+	if remediator == nil {
+		return errors.New("cannot call api.Serve with nil remediator")
+	}
 
 	logger = zapLogger.Named("api")
-	registerEndpoints(conf)
+	registerEndpoints(store, findings, historyStore, remediator)
 	go monitorHealth(logger)
 	logger.Infow("start listening for connections",
 		"address", "0.0.0.0"+":"+fmt.Sprint(bindPort),
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+	"github.com/18F/watchtower/history"
+	"gopkg.in/yaml.v2"
+)
+
+// driftReport is the response body of the /drift endpoint
+type driftReport struct {
+	Updated  time.Time       `json:"updated"`
+	Findings []drift.Finding `json:"findings"`
+}
+
+// writeResponse writes body as the response to a request to endpoint, logging any failure
+func writeResponse(w http.ResponseWriter, endpoint, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	if _, err := w.Write(body); err != nil {
+		logger.Errorw("failed writing response to "+endpoint+" request",
+			"error", err.Error(),
+		)
+	}
+}
+
+// driftHandler returns the findings of the most recent drift checks as JSON. The
+// findings can be filtered with the kind and resource query parameters.
+func driftHandler(findings *drift.Findings) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		all, updated := findings.All()
+		kind, resource := r.URL.Query().Get("kind"), r.URL.Query().Get("resource")
+		current := []drift.Finding{}
+		for _, finding := range all {
+			if (kind == "" || string(finding.Kind) == kind) && (resource == "" || finding.Resource == resource) {
+				current = append(current, finding)
+			}
+		}
+
+		jsonResp, err := json.Marshal(driftReport{Updated: updated, Findings: current})
+		if err != nil {
+			logger.Errorw("JSON marshal failure during /drift request",
+				"error", err.Error(),
+			)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeResponse(w, "/drift", "application/json", jsonResp)
+	}
+}
+
+// driftPatchHandler returns the config entries to add, update or remove to
+// resolve the current, non-exempted findings, as YAML that can be copied into
+// the config.
+func driftPatchHandler(store *config.Store, findings *drift.Findings) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		conf := store.Get()
+		current, _ := findings.All()
+		patch := drift.NewPatch(conf.Data, drift.Active(current))
+
+		body, err := yaml.Marshal(patch)
+		if err != nil {
+			logger.Errorw("failed marshalling config patch for /drift/patch request",
+				"error", err.Error(),
+			)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeResponse(w, "/drift/patch", "application/yaml", body)
+	}
+}
+
+// historyLifecycle is a finding lifecycle in the response body of the /drift/history endpoint
+type historyLifecycle struct {
+	history.Lifecycle
+	Open            bool    `json:"open"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// historyReport is the response body of the /drift/history endpoint
+type historyReport struct {
+	Lifecycles []historyLifecycle `json:"lifecycles"`
+	Open       int                `json:"open"`
+	Resolved   int                `json:"resolved"`
+
+	// MeanTimeToRemediateSeconds is omitted if none of the lifecycles were remediated
+	MeanTimeToRemediateSeconds *float64 `json:"mean_time_to_remediate_seconds,omitempty"`
+}
+
+// parseSince parses the since query parameter, which is either an RFC 3339
+// timestamp or a date
+func parseSince(since string) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, since)
+}
+
+// driftHistoryHandler returns the recorded lifecycles of findings as JSON, along
+// with their mean time to remediate. The lifecycles can be filtered with the
+// kind, resource and space query parameters, and since excludes lifecycles
+// resolved before the given time.
+func driftHistoryHandler(historyStore *history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if historyStore == nil {
+			http.Error(w, "drift history is not enabled", http.StatusNotFound)
+			return
+		}
+		params := r.URL.Query()
+		since, err := parseSince(params.Get("since"))
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 timestamp or a YYYY-MM-DD date", http.StatusBadRequest)
+			return
+		}
+
+		lifecycles := historyStore.Lifecycles(history.Query{
+			Kind:     drift.Kind(params.Get("kind")),
+			Resource: params.Get("resource"),
+			Space:    params.Get("space"),
+			Since:    since,
+		})
+		now := time.Now()
+		report := historyReport{Lifecycles: []historyLifecycle{}}
+		for i := range lifecycles {
+			lifecycle := historyLifecycle{
+				Lifecycle:       lifecycles[i],
+				Open:            lifecycles[i].Open(),
+				DurationSeconds: lifecycles[i].Duration(now).Seconds(),
+			}
+			if lifecycle.Open {
+				report.Open++
+			} else {
+				report.Resolved++
+			}
+			report.Lifecycles = append(report.Lifecycles, lifecycle)
+		}
+		if mean, ok := history.MeanTimeToRemediate(lifecycles); ok {
+			seconds := mean.Seconds()
+			report.MeanTimeToRemediateSeconds = &seconds
+		}
+
+		jsonResp, err := json.Marshal(report)
+		if err != nil {
+			logger.Errorw("JSON marshal failure during /drift/history request",
+				"error", err.Error(),
+			)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeResponse(w, "/drift/history", "application/json", jsonResp)
+	}
+}
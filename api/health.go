@@ -19,6 +19,7 @@ type healthStatus struct {
 // health structs provide a concurrency-safe way of accessing the current healthStatus
 type health struct {
 	status healthStatus
+	ready  bool
 	mut    sync.RWMutex
 }
 
@@ -29,22 +30,42 @@ func (h *health) Get() healthStatus {
 	return status
 }
 
+// Set records the status of a health check. It is ignored until the drift
+// detector is ready, so that Watchtower is reported as connecting until then.
 func (h *health) Set(status healthStatus) {
 	h.mut.Lock()
-	h.status = status
+	if h.ready {
+		h.status = status
+	}
+	h.mut.Unlock()
+}
+
+// setReady marks Watchtower as healthy once the drift detector is ready
+func (h *health) setReady() {
+	h.mut.Lock()
+	h.ready = true
+	h.status = healthyStatus
 	h.mut.Unlock()
 }
 
+// connectingStatus is reported until the drift detector has connected to the
+// Cloud Controller and checked for drift for the first time
+var connectingStatus = healthStatus{StatusCode: http.StatusServiceUnavailable, Message: "Connecting to Cloud Foundry"}
+
 var watchtowerHealth = health{
-	status: healthStatus{
-		StatusCode: http.StatusOK,
-		Message:    "Healthy",
-	},
-	mut: sync.RWMutex{},
+	status: connectingStatus,
+	mut:    sync.RWMutex{},
 }
 
 var healthyStatus = healthStatus{StatusCode: http.StatusOK, Message: "Healthy"}
 
+// SetReady reports Watchtower as healthy once the drift detector has connected
+// to the Cloud Controller and checked for drift for the first time. Until then,
+// /health responds with 503 Service Unavailable.
+func SetReady() {
+	watchtowerHealth.setReady()
+}
+
 // checkEndpoint makes a GET request to the requested URL and automatically sets
 // watchtowerHealth should the request fail. Returns the request response.
 func getEndpointHealth(url string, logger *zap.SugaredLogger) healthStatus {
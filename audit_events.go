@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/18F/watchtower/drift"
+	"go.uber.org/zap"
+)
+
+// Types of the audit events that cause unknown apps and routes
+const (
+	appCreateEvent   = "audit.app.create"
+	appMapRouteEvent = "audit.app.map-route"
+)
+
+// auditEventsPageSize is the number of audit events requested per lookup, which
+// is enough to find the latest mapping of a route among the other route
+// mappings of an app
+const auditEventsPageSize = 50
+
+// auditEventWindow is how long before a finding was detected the audit event of
+// the change that caused it is looked for, so that an event of an earlier change
+// to the same resource is not mistaken for it. auditEventClockSkew allows for
+// differences between the clocks of Watchtower and the Cloud Controller.
+const (
+	auditEventWindow    = 24 * time.Hour
+	auditEventClockSkew = time.Minute
+)
+
+// Delays before audit events are looked up again after a failed lookup. The delay
+// doubles with each consecutive failure, up to auditRetryMaxDelay.
+const (
+	auditRetryBaseDelay = time.Minute
+	auditRetryMaxDelay  = time.Hour
+)
+
+// cfAuditEvent is a Cloud Controller v3 audit event
+type cfAuditEvent struct {
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Actor     struct {
+		GUID string `json:"guid"`
+		Type string `json:"type"`
+		Name string `json:"name"`
+	} `json:"actor"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// listAuditEvents returns the audit events matching query from /v3/audit_events
+func listAuditEvents(query url.Values) ([]cfAuditEvent, error) {
+	resp, err := client.DoRequest(client.NewRequest("GET", "/v3/audit_events?"+query.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error listing audit events, response code: %d", resp.StatusCode)
+	}
+
+	var data struct {
+		Resources []cfAuditEvent `json:"resources"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	return data.Resources, nil
+}
+
+// AuditCorrelator finds the audit events of the changes that caused findings.
+// Each finding is looked up once, when it is first detected, and the result is
+// kept for as long as the finding is reported. After a failed lookup, such as
+// when the service account may not read audit events, no lookups are made until
+// a backoff has passed.
+type AuditCorrelator struct {
+	events  map[string]*drift.AuditEvent // By finding key. nil if no event was found
+	list    func(query url.Values) ([]cfAuditEvent, error)
+	logger  *zap.SugaredLogger
+	retryAt time.Time     // Lookups are paused until retryAt after a failure
+	backoff time.Duration // Delay after the most recent failure
+	mut     sync.Mutex
+}
+
+// NewAuditCorrelator returns an AuditCorrelator that queries the Cloud Controller
+func NewAuditCorrelator(logger *zap.SugaredLogger) *AuditCorrelator {
+	return &AuditCorrelator{
+		events: make(map[string]*drift.AuditEvent),
+		list:   listAuditEvents,
+		logger: logger.Named("audit-events"),
+	}
+}
+
+// Find returns the most recent audit event of the given type on the target
+// resource for the finding, created up to auditEventWindow before the finding
+// was first seen, or before now if it is new. If routeGUID is set, only events
+// for that route are considered. Failed lookups are retried once the backoff
+// after the failure has passed.
+func (c *AuditCorrelator) Find(finding *drift.Finding, targetGUID, eventType, routeGUID string) *drift.AuditEvent {
+	key := finding.Key()
+	now := time.Now()
+	c.mut.Lock()
+	event, ok := c.events[key]
+	paused := now.Before(c.retryAt)
+	c.mut.Unlock()
+	if ok || paused {
+		return event
+	}
+
+	detected := finding.FirstSeen
+	if detected.IsZero() {
+		detected = now
+	}
+	events, err := c.list(url.Values{
+		"target_guids":     {targetGUID},
+		"types":            {eventType},
+		"created_ats[gte]": {detected.Add(-auditEventWindow).UTC().Format(time.RFC3339)},
+		"created_ats[lte]": {detected.Add(auditEventClockSkew).UTC().Format(time.RFC3339)},
+		"order_by":         {"-created_at"},
+		"per_page":         {fmt.Sprint(auditEventsPageSize)},
+	})
+	if err != nil {
+		c.mut.Lock()
+		c.backoff = min(max(2*c.backoff, auditRetryBaseDelay), auditRetryMaxDelay)
+		c.retryAt = now.Add(c.backoff)
+		c.mut.Unlock()
+		c.logger.Warnw("failed looking up audit events, pausing lookups",
+			"finding", key,
+			"retry after", c.backoff.String(),
+			"error", err.Error(),
+		)
+		return nil
+	}
+	for _, cfEvent := range events {
+		if routeGUID != "" && cfEvent.Data["route_guid"] != routeGUID {
+			continue
+		}
+		actor := cfEvent.Actor.Name
+		if actor == "" {
+			actor = cfEvent.Actor.GUID
+		}
+		event = &drift.AuditEvent{Type: cfEvent.Type, Actor: actor, ActorType: cfEvent.Actor.Type, Time: cfEvent.CreatedAt}
+		c.logger.Infow("correlated drift with audit event",
+			"finding", key,
+			"type", event.Type,
+			"actor", event.Actor,
+			"actor type", event.ActorType,
+			"time", event.Time,
+		)
+		break
+	}
+
+	c.mut.Lock()
+	c.events[key] = event
+	c.backoff = 0
+	c.mut.Unlock()
+	return event
+}
+
+// Prune forgets the events of findings that are no longer reported, so that they
+// are looked up again if the findings reappear
+func (c *AuditCorrelator) Prune(findings []drift.Finding) {
+	current := make(map[string]bool)
+	for _, finding := range findings {
+		current[finding.Key()] = true
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	for key := range c.events {
+		if !current[key] {
+			delete(c.events, key)
+		}
+	}
+}
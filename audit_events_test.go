@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/18F/watchtower/drift"
+	"go.uber.org/zap"
+)
+
+// TestAuditCorrelator ensures that findings are matched with the latest audit event
+// of their route, and that each finding is only looked up once while it is reported.
+func TestAuditCorrelator(t *testing.T) {
+	lookups := 0
+	correlator := NewAuditCorrelator(zap.NewNop().Sugar())
+	correlator.list = func(query url.Values) ([]cfAuditEvent, error) {
+		lookups++
+		if query.Get("target_guids") != "app-guid" || query.Get("types") != appMapRouteEvent ||
+			query.Get("created_ats[gte]") != "2026-10-17T14:00:00Z" || query.Get("created_ats[lte]") != "2026-10-18T14:01:00Z" {
+			t.Fatalf("Incorrect audit event query: %v", query)
+		}
+		events := make([]cfAuditEvent, 2)
+		events[0].Type, events[0].Data = appMapRouteEvent, map[string]interface{}{"route_guid": "other-route"}
+		events[1].Type, events[1].Data = appMapRouteEvent, map[string]interface{}{"route_guid": "route-guid"}
+		events[1].Actor.Name, events[1].Actor.Type = "ci-deployer", "user"
+		events[1].CreatedAt = time.Date(2026, 10, 18, 13, 58, 0, 0, time.UTC)
+		return events, nil
+	}
+
+	detected := time.Date(2026, 10, 18, 14, 0, 0, 0, time.UTC)
+	finding := drift.Finding{Kind: drift.UnknownRoute, Resource: "web", Route: "admin.app.cloud.gov", FirstSeen: detected}
+	event := correlator.Find(&finding, "app-guid", appMapRouteEvent, "route-guid")
+	if event == nil || event.Actor != "ci-deployer" || event.ActorType != "user" || event.Time.Hour() != 13 {
+		t.Fatalf("Audit event of the route was not found. Found: %+v", event)
+	}
+	if correlator.Find(&finding, "app-guid", appMapRouteEvent, "route-guid") != event || lookups != 1 {
+		t.Fatalf("Audit event was looked up again. Lookups: %d", lookups)
+	}
+
+	correlator.Prune(nil)
+	lookups = 0
+	correlator.list = func(url.Values) ([]cfAuditEvent, error) {
+		lookups++
+		return nil, errors.New("forbidden")
+	}
+	if event := correlator.Find(&finding, "app-guid", appMapRouteEvent, "route-guid"); event != nil {
+		t.Fatalf("Failed lookup returned an audit event. Found: %+v", event)
+	}
+	if _, ok := correlator.events[finding.Key()]; ok {
+		t.Fatal("Failed lookup was cached")
+	}
+	other := drift.Finding{Kind: drift.UnknownApp, Resource: "rogue"}
+	if correlator.Find(&other, "rogue-guid", appCreateEvent, ""); lookups != 1 {
+		t.Fatalf("Audit events were looked up again before the backoff passed. Lookups: %d", lookups)
+	}
+
+	correlator.retryAt = time.Now()
+	correlator.Find(&other, "rogue-guid", appCreateEvent, "")
+	if lookups != 2 || correlator.backoff != 2*auditRetryBaseDelay {
+		t.Fatalf("Failed lookup was not retried with a longer backoff. Lookups: %d, backoff: %s", lookups, correlator.backoff)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// passwordGrantClientID is the UAA client used for the password grant, as used by the cf CLI
+const passwordGrantClientID = "cf"
+
+// cloudControllerReadScopes are the scopes that grant read access to the Cloud
+// Controller. Every token must have at least one of them.
+var cloudControllerReadScopes = []string{
+	"cloud_controller.read",
+	"cloud_controller.admin",
+	"cloud_controller.admin_read_only",
+	"cloud_controller.global_auditor",
+}
+
+// cfCredentials are the credentials Watchtower authenticates with. A UAA client
+// authenticates with the client credentials grant, and a user with the password
+// grant.
+type cfCredentials struct {
+	username       string
+	password       string
+	clientID       string
+	clientSecret   string
+	tokenEndpoint  string   // Overrides the token endpoint advertised by the Cloud Controller
+	requiredScopes []string // Scopes the token must have, in addition to a read scope
+}
+
+// credentialsFromEnv reads the credentials from the CF_CLIENT_ID and
+// CF_CLIENT_SECRET, or CF_USER and CF_PASS environment variables, along with
+// CF_TOKEN_ENDPOINT and the comma separated CF_REQUIRED_SCOPES.
+func credentialsFromEnv() (cfCredentials, error) {
+	creds := cfCredentials{
+		username:      getEnv("CF_USER", ""),
+		password:      getEnv("CF_PASS", ""),
+		clientID:      getEnv("CF_CLIENT_ID", ""),
+		clientSecret:  getEnv("CF_CLIENT_SECRET", ""),
+		tokenEndpoint: getEnv("CF_TOKEN_ENDPOINT", ""),
+	}
+	for _, scope := range strings.Split(getEnv("CF_REQUIRED_SCOPES", ""), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			creds.requiredScopes = append(creds.requiredScopes, scope)
+		}
+	}
+
+	switch {
+	case creds.clientID != "" && creds.clientSecret == "":
+		return creds, errors.New("CF_CLIENT_SECRET must be set with CF_CLIENT_ID")
+	case creds.clientID == "" && (creds.username == "" || creds.password == ""):
+		return creds, errors.New("either CF_CLIENT_ID and CF_CLIENT_SECRET, or CF_USER and CF_PASS must be set")
+	}
+	return creds, nil
+}
+
+// grant returns the name of the OAuth grant the credentials authenticate with
+func (c *cfCredentials) grant() string {
+	if c.clientID != "" {
+		return "client_credentials"
+	}
+	return "password"
+}
+
+// grantToken fetches a new token from tokenURL with the credentials
+func (c *cfCredentials) grantToken(ctx context.Context, tokenURL string) (*oauth2.Token, error) {
+	if c.clientID != "" {
+		clientConfig := &clientcredentials.Config{
+			ClientID:     c.clientID,
+			ClientSecret: c.clientSecret,
+			TokenURL:     tokenURL,
+			AuthStyle:    oauth2.AuthStyleInHeader,
+		}
+		return clientConfig.Token(ctx)
+	}
+	return userOAuthConfig(tokenURL).PasswordCredentialsToken(ctx, c.username, c.password)
+}
+
+// userOAuthConfig returns the config of the password grant client, which is also
+// used to refresh tokens
+func userOAuthConfig(tokenURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID: passwordGrantClientID,
+		Endpoint: oauth2.Endpoint{TokenURL: tokenURL, AuthStyle: oauth2.AuthStyleInHeader},
+	}
+}
+
+// Reasons of authentication failures, as labelled in the auth failure metric
+const (
+	authFailureRefresh  = "refresh"  // Refreshing a token with its refresh token failed
+	authFailureGrant    = "grant"    // Fetching a token with the credentials failed
+	authFailureRejected = "rejected" // The Cloud Controller rejected a token
+)
+
+// Token fetch attempts per call and the backoff between them, which tests shorten
+var (
+	tokenAttempts      = 3
+	authRetryBaseDelay = time.Second
+	authRetryMaxDelay  = 5 * time.Minute
+)
+
+// authBackoff returns the delay before retry attempt n of authentication,
+// doubling from authRetryBaseDelay up to authRetryMaxDelay
+func authBackoff(n int) time.Duration {
+	delay := authRetryBaseDelay
+	for i := 1; i < n && delay < authRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, authRetryMaxDelay)
+}
+
+// tokenManager is the token source of the Cloud Controller client. It keeps the
+// current token until it expires or is rejected, then refreshes it with its
+// refresh token, falling back to the credentials grant if the token has no
+// refresh token or refreshing fails. Failed fetches are retried with backoff.
+type tokenManager struct {
+	creds    cfCredentials
+	tokenURL string
+	token    *oauth2.Token
+	logger   *zap.SugaredLogger
+	mut      sync.Mutex
+}
+
+// newTokenManager returns a tokenManager that fetches tokens from tokenURL with creds
+func newTokenManager(creds cfCredentials, tokenURL string, logger *zap.SugaredLogger) *tokenManager {
+	return &tokenManager{creds: creds, tokenURL: tokenURL, logger: logger.Named("auth")}
+}
+
+// Token returns the current token, fetching a new one if it expired or was
+// rejected. It implements oauth2.TokenSource. Fetches are made one at a time,
+// but m.mut is released during the backoff between attempts, so that other
+// callers are not blocked and can use a token fetched meanwhile.
+func (m *tokenManager) Token() (*oauth2.Token, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	var err error
+	for attempt := 1; attempt <= tokenAttempts; attempt++ {
+		if attempt > 1 {
+			m.mut.Unlock()
+			time.Sleep(authBackoff(attempt - 1))
+			m.mut.Lock()
+		}
+		if m.token.Valid() {
+			return m.token, nil
+		}
+
+		var token *oauth2.Token
+		if token, err = m.fetch(); err == nil {
+			m.token = token
+			tokenExpiry.Set(float64(token.Expiry.Unix()))
+			m.logger.Infow("fetched token", "grant", m.creds.grant(), "expiry", token.Expiry)
+			return token, nil
+		}
+		m.logger.Warnw("failed fetching token", "attempt", attempt, "error", err.Error())
+	}
+	return nil, err
+}
+
+// fetch returns a new token, refreshing the current token if it has a refresh
+// token. m.mut must be held.
+func (m *tokenManager) fetch() (*oauth2.Token, error) {
+	ctx := context.Background()
+	if m.token != nil && m.token.RefreshToken != "" {
+		expired := &oauth2.Token{RefreshToken: m.token.RefreshToken}
+		token, err := userOAuthConfig(m.tokenURL).TokenSource(ctx, expired).Token()
+		if err == nil {
+			return token, nil
+		}
+		authFailures.WithLabelValues(authFailureRefresh).Inc()
+		m.logger.Warnw("failed refreshing token, authenticating again", "error", err.Error())
+	}
+
+	token, err := m.creds.grantToken(ctx, m.tokenURL)
+	if err != nil {
+		authFailures.WithLabelValues(authFailureGrant).Inc()
+		return nil, tokenError(err)
+	}
+	return token, nil
+}
+
+// invalidate drops token if it is still the current token, so that the next
+// call to Token fetches a new one. Its refresh token is kept.
+func (m *tokenManager) invalidate(token *oauth2.Token) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if m.token != nil && m.token.AccessToken == token.AccessToken {
+		m.token = &oauth2.Token{RefreshToken: m.token.RefreshToken}
+	}
+}
+
+// authenticate fetches a token, and checks that it has the required scopes
+func (m *tokenManager) authenticate() error {
+	token, err := m.Token()
+	if err != nil {
+		return err
+	}
+	scopes, err := tokenScopes(token.AccessToken)
+	if err != nil {
+		return err
+	}
+	return checkScopes(scopes, m.creds.requiredScopes)
+}
+
+// authTransport authorizes Cloud Controller requests with the tokens of a
+// tokenManager. A request rejected with 401 Unauthorized is retried once with a
+// new token, in case the token was revoked or expired early.
+type authTransport struct {
+	tokens *tokenManager
+	base   http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.tokens.Token()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(authorize(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	authFailures.WithLabelValues(authFailureRejected).Inc()
+	t.tokens.invalidate(token)
+	retry := req
+	if req.Body != nil && req.Body != http.NoBody {
+		// The body was consumed, and can only be sent again if it can be recreated
+		if req.GetBody == nil {
+			return resp, nil
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry = req.Clone(req.Context())
+		retry.Body = body
+	}
+	if token, err = t.tokens.Token(); err != nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+	return t.base.RoundTrip(authorize(retry, token))
+}
+
+// authorize returns a copy of req with the token in its Authorization header
+func authorize(req *http.Request, token *oauth2.Token) *http.Request {
+	authorized := req.Clone(req.Context())
+	token.SetAuthHeader(authorized)
+	return authorized
+}
+
+// tokenError returns err, explaining it if the token endpoint rejected the credentials
+func tokenError(err error) error {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.Response != nil &&
+		retrieveErr.Response.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("credentials were not valid: %w", err)
+	}
+	return fmt.Errorf("failed fetching token: %w", err)
+}
+
+// tokenScopes returns the scopes of a UAA access token, which is a JWT
+func tokenScopes(accessToken string) ([]string, error) {
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("access token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding access token: %w", err)
+	}
+	var claims struct {
+		Scope []string `json:"scope"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("failed decoding access token: %w", err)
+	}
+	return claims.Scope, nil
+}
+
+// checkScopes returns an error listing the required scopes that are missing, or
+// the read scopes if the token has none of them
+func checkScopes(scopes, required []string) error {
+	var missing []string
+	for _, scope := range required {
+		if !slices.Contains(scopes, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("token is missing required scopes: %s", strings.Join(missing, ", "))
+	}
+	for _, scope := range cloudControllerReadScopes {
+		if slices.Contains(scopes, scope) {
+			return nil
+		}
+	}
+	return fmt.Errorf("token is missing a cloud controller read scope, one of: %s", strings.Join(cloudControllerReadScopes, ", "))
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// testUAA is a token endpoint that issues tokens with scopes to the client
+// "watchtower" with secret "s3cret" and the user "auditor" with password
+// "s3cret", and counts the grants it receives by type
+type testUAA struct {
+	*httptest.Server
+	scopes []string
+	grants map[string]int
+	mut    sync.Mutex
+}
+
+// newTestUAA starts a testUAA that issues tokens with the given scopes
+func newTestUAA(t *testing.T, scopes ...string) *testUAA {
+	t.Helper()
+	uaa := &testUAA{scopes: scopes, grants: make(map[string]int)}
+	uaa.Server = httptest.NewServer(http.HandlerFunc(uaa.token))
+	t.Cleanup(uaa.Close)
+
+	baseDelay := authRetryBaseDelay
+	authRetryBaseDelay = time.Millisecond
+	t.Cleanup(func() { authRetryBaseDelay = baseDelay })
+	return uaa
+}
+
+// token handles token requests
+func (uaa *testUAA) token(w http.ResponseWriter, r *http.Request) {
+	uaa.mut.Lock()
+	defer uaa.mut.Unlock()
+	grant := r.PostFormValue("grant_type")
+	uaa.grants[grant]++
+
+	id, secret, _ := r.BasicAuth()
+	var valid bool
+	switch grant {
+	case "client_credentials":
+		valid = id == "watchtower" && secret == "s3cret"
+	case "password":
+		valid = id == passwordGrantClientID && r.PostFormValue("username") == "auditor" && r.PostFormValue("password") == "s3cret"
+	case "refresh_token":
+		valid = strings.HasPrefix(r.PostFormValue("refresh_token"), "refresh-")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !valid {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"unauthorized","error_description":"Bad credentials"}`))
+		return
+	}
+
+	issued := uaa.grants["client_credentials"] + uaa.grants["password"] + uaa.grants["refresh_token"]
+	claims, _ := json.Marshal(map[string]interface{}{"scope": uaa.scopes, "jti": fmt.Sprint(issued)})
+	response := map[string]interface{}{
+		"access_token": "e30." + base64.RawURLEncoding.EncodeToString(claims) + ".c2ln",
+		"token_type":   "bearer",
+		"expires_in":   3600,
+	}
+	if grant != "client_credentials" {
+		response["refresh_token"] = fmt.Sprintf("refresh-%d", issued)
+	}
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// TestClientCredentials ensures that UAA clients are authenticated against the
+// token endpoint, and that missing scopes and invalid credentials are reported.
+func TestClientCredentials(t *testing.T) {
+	uaa := newTestUAA(t, "cloud_controller.global_auditor", "openid")
+	creds := cfCredentials{clientID: "watchtower", clientSecret: "s3cret"}
+	tokens := newTokenManager(creds, uaa.URL, zap.NewNop().Sugar())
+	if err := tokens.authenticate(); err != nil {
+		t.Fatalf("Client failed to authenticate: %s", err)
+	}
+	if token, err := tokens.Token(); err != nil || !token.Valid() || uaa.grants["client_credentials"] != 1 {
+		t.Fatalf("Token was not reused. Found: %+v, %v, grants: %v", token, err, uaa.grants)
+	}
+
+	creds.requiredScopes = []string{"openid", "cloud_controller.write", "cloud_controller.admin"}
+	err := newTokenManager(creds, uaa.URL, zap.NewNop().Sugar()).authenticate()
+	if err == nil || !strings.HasSuffix(err.Error(), "missing required scopes: cloud_controller.write, cloud_controller.admin") {
+		t.Fatalf("Missing scopes were not reported. Found: %v", err)
+	}
+
+	creds = cfCredentials{clientID: "watchtower", clientSecret: "wrong"}
+	err = newTokenManager(creds, uaa.URL, zap.NewNop().Sugar()).authenticate()
+	if err == nil || !strings.HasPrefix(err.Error(), "credentials were not valid") {
+		t.Fatalf("Invalid credentials were not reported. Found: %v", err)
+	}
+	if uaa.grants["client_credentials"] != 2+tokenAttempts {
+		t.Fatalf("Failed grant was not retried. Grants: %v", uaa.grants)
+	}
+}
+
+// TestTokenRefresh ensures that tokens rejected by the Cloud Controller are
+// refreshed with their refresh token, and that the request is retried.
+func TestTokenRefresh(t *testing.T) {
+	uaa := newTestUAA(t, "cloud_controller.read")
+	tokens := newTokenManager(cfCredentials{username: "auditor", password: "s3cret"}, uaa.URL, zap.NewNop().Sugar())
+	if err := tokens.authenticate(); err != nil {
+		t.Fatalf("User failed to authenticate: %s", err)
+	}
+	first, _ := tokens.Token()
+
+	// The Cloud Controller rejects the first token, as if it were revoked
+	var authorizations []string
+	cc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") == "Bearer "+first.AccessToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer cc.Close()
+
+	httpClient := &http.Client{Transport: &authTransport{tokens: tokens, base: http.DefaultTransport}}
+	resp, err := httpClient.Post(cc.URL, "application/json", strings.NewReader(`{"enabled":false}`))
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(authorizations) != 2 || authorizations[1] == authorizations[0] {
+		t.Fatalf("Rejected request was not retried with a new token. Status: %d, authorizations: %v", resp.StatusCode, authorizations)
+	}
+	if uaa.grants["password"] != 1 || uaa.grants["refresh_token"] != 1 {
+		t.Fatalf("Token was not refreshed with its refresh token. Grants: %v", uaa.grants)
+	}
+}
+
+// TestTokenBackoffUnlocked ensures that other callers are not blocked while a
+// failed token fetch backs off before retrying.
+func TestTokenBackoffUnlocked(t *testing.T) {
+	uaa := newTestUAA(t)
+	authRetryBaseDelay = 200 * time.Millisecond
+	tokens := newTokenManager(cfCredentials{clientID: "watchtower", clientSecret: "wrong"}, uaa.URL, zap.NewNop().Sugar())
+
+	done := make(chan error)
+	go func() {
+		_, err := tokens.Token()
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	tokens.invalidate(&oauth2.Token{AccessToken: "revoked"})
+	if waited := time.Since(start); waited >= 100*time.Millisecond {
+		t.Fatalf("Token manager was locked during backoff for %s", waited)
+	}
+	if err := <-done; err == nil {
+		t.Fatal("Invalid credentials were not reported")
+	}
+}
+
+// TestAuthBackoff ensures that retries back off exponentially up to the maximum delay.
+func TestAuthBackoff(t *testing.T) {
+	if authBackoff(1) != time.Second || authBackoff(3) != 4*time.Second || authBackoff(20) != authRetryMaxDelay {
+		t.Fatalf("Incorrect backoff. Found: %s, %s, %s", authBackoff(1), authBackoff(3), authBackoff(20))
+	}
+}
+
+// TestCheckScopes ensures that every token must have a cloud controller read scope.
+func TestCheckScopes(t *testing.T) {
+	if err := checkScopes([]string{"openid", "cloud_controller.read"}, nil); err != nil {
+		t.Fatalf("Token with a read scope was rejected: %s", err)
+	}
+	if err := checkScopes([]string{"openid"}, nil); err == nil || !strings.Contains(err.Error(), "cloud_controller.global_auditor") {
+		t.Fatalf("Token without a read scope was not rejected. Found: %v", err)
+	}
+}
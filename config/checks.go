@@ -0,0 +1,91 @@
+package config
+
+import "fmt"
+
+// Severities of the drift found by a check
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Severities lists every severity, from least to most severe
+var Severities = []string{SeverityInfo, SeverityWarning, SeverityCritical}
+
+// defaultSeverity is the severity of checks that do not set one
+const defaultSeverity = SeverityWarning
+
+// ChecksConfig represents allowed values under the 'checks' key. Checks that
+// are not listed are enabled with the default severity.
+type ChecksConfig struct {
+	Apps        *CheckConfig `yaml:"apps,omitempty" doc:"Unknown and missing apps"`
+	AppRoutes   *CheckConfig `yaml:"app_routes,omitempty" doc:"Unknown and missing app routes"`
+	AppSSH      *CheckConfig `yaml:"app_ssh,omitempty" doc:"App ssh settings"`
+	AppSettings *CheckConfig `yaml:"app_settings,omitempty" doc:"App instances, memory, buildpacks, services and health checks"`
+	AppLabels   *CheckConfig `yaml:"app_labels,omitempty" doc:"Required app labels"`
+	Spaces      *CheckConfig `yaml:"spaces,omitempty" doc:"Space ssh settings"`
+	SpaceLabels *CheckConfig `yaml:"space_labels,omitempty" doc:"Required space labels"`
+}
+
+// CheckConfig represents allowed values for each check under the 'checks' key
+type CheckConfig struct {
+	Enabled  *bool  `yaml:"enabled,omitempty" doc:"Whether the check runs. Defaults to true"`
+	Severity string `yaml:"severity,omitempty" doc:"Severity of the drift found by the check. Defaults to warning" enum:"info,warning,critical"`
+	Enforce  bool   `yaml:"enforce,omitempty" doc:"Whether drift found by the check is remediated. Only supported by app_ssh and spaces. See remediation"`
+}
+
+// enforceableChecks are the checks whose drift can be remediated
+var enforceableChecks = []string{"app_ssh", "spaces"}
+
+// check returns the settings of the named check, or nil if it is not set
+func (c *ChecksConfig) check(name string) *CheckConfig {
+	switch name {
+	case "apps":
+		return c.Apps
+	case "app_routes":
+		return c.AppRoutes
+	case "app_ssh":
+		return c.AppSSH
+	case "app_settings":
+		return c.AppSettings
+	case "app_labels":
+		return c.AppLabels
+	case "spaces":
+		return c.Spaces
+	case "space_labels":
+		return c.SpaceLabels
+	}
+	return nil
+}
+
+// Enabled returns true unless the named check is disabled. Checks also require
+// their 'apps' or 'spaces' section to be enabled.
+func (c *ChecksConfig) Enabled(name string) bool {
+	check := c.check(name)
+	return check == nil || check.Enabled == nil || *check.Enabled
+}
+
+// Enforced returns true if drift found by the named check is remediated. Config
+// entries may override this for their resource.
+func (c *ChecksConfig) Enforced(name string) bool {
+	check := c.check(name)
+	return check != nil && check.Enforce
+}
+
+// compile validates the checks config
+func (c *ChecksConfig) compile() error {
+	for _, name := range []string{"apps", "app_routes", "app_settings", "app_labels", "space_labels"} {
+		if c.Enforced(name) {
+			return fmt.Errorf("check %q cannot be enforced. Only %v can", name, enforceableChecks)
+		}
+	}
+	return nil
+}
+
+// Severity returns the severity of the drift found by the named check
+func (c *ChecksConfig) Severity(name string) string {
+	if check := c.check(name); check != nil && check.Severity != "" {
+		return check.Severity
+	}
+	return defaultSeverity
+}
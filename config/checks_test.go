@@ -0,0 +1,60 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const checksConfig = `---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+checks:
+  app_routes:
+    enabled: false
+  app_ssh:
+    severity: critical
+  spaces:
+    enabled: true
+    severity: info`
+
+// TestChecks ensures that checks can be disabled and given a severity, and default to enabled with warning severity.
+func TestChecks(t *testing.T) {
+	conf, err := Parse([]byte(checksConfig))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	checks := &conf.Data.Checks
+	if checks.Enabled("app_routes") {
+		t.Fatal("Disabled check was enabled")
+	}
+	if !checks.Enabled("apps") || !checks.Enabled("app_ssh") || !checks.Enabled("spaces") {
+		t.Fatal("Check not disabled in the config was disabled")
+	}
+
+	severities := map[string]string{"apps": "warning", "app_routes": "warning", "app_ssh": "critical", "spaces": "info"}
+	for check, expected := range severities {
+		if severity := checks.Severity(check); severity != expected {
+			t.Fatalf("Severity of check %s incorrect. Expected: %s, Found: %s", check, expected, severity)
+		}
+	}
+}
+
+// TestInvalidChecks ensures that unknown checks, severities and unsupported enforcement are load errors.
+func TestInvalidChecks(t *testing.T) {
+	base := "global:\n  port: 8443\n  refresh_interval: 15s\n  cloud_controller_url: https://api.fr.cloud.gov\nchecks:\n"
+	invalid := map[string]string{
+		"  app_memory:\n    enabled: false": "checks.app_memory: unknown key",
+		"  apps:\n    severity: high":       `checks.apps.severity: "high" must be one of: info, warning, critical`,
+		"  apps:\n    enabled: no thanks":   "checks.apps.enabled: expected boolean, found string",
+		"  app_labels:\n    enforce: true":  `check "app_labels" cannot be enforced`,
+	}
+	for checks, message := range invalid {
+		_, err := Parse([]byte(base + checks))
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Fatalf("Invalid checks config did not report %q. Found: %v", message, err)
+		}
+	}
+}
@@ -2,9 +2,11 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -17,61 +19,383 @@ const minRefreshInterval = time.Second * 10
 // should be the primary method of reading the expected state of a cloudfoundry
 // environment.
 type Config struct {
-	Data   YAMLConfig
-	Apps   map[string]AppEntry   // AppName -> AppEntry
-	Spaces map[string]SpaceEntry // SpaceName -> SpaceEntry
+	Data    YAMLConfig
+	Apps    map[string]AppEntry   // AppEntry.ID() -> AppEntry
+	Spaces  map[string]SpaceEntry // SpaceEntry.ID() -> SpaceEntry
+	Sources []string              // Paths of every file the Config was loaded from
+
+	configFiles   []string     // Paths of the main config and fragment files
+	appPatterns   []AppEntry   // App entries matched by pattern or selector, in config order
+	spacePatterns []SpaceEntry // Space entries matched by pattern or selector, in config order
+}
+
+// FindApp returns the AppEntry for the named app with the given labels. Entries
+// matched by their exact name alone take precedence over pattern and selector
+// entries, which are tried in the order they appear in the config.
+func (c *Config) FindApp(name string, labels map[string]string) (AppEntry, bool) {
+	if app, ok := c.Apps[name]; ok && !app.IsPattern() {
+		return app, true
+	}
+	for _, app := range c.appPatterns {
+		if app.Matches(name, labels) {
+			return app, true
+		}
+	}
+	return AppEntry{}, false
+}
+
+// FindSpace returns the SpaceEntry for the named space with the given labels.
+// Entries matched by their exact name alone take precedence over pattern and
+// selector entries, which are tried in the order they appear in the config.
+func (c *Config) FindSpace(name string, labels map[string]string) (SpaceEntry, bool) {
+	if space, ok := c.Spaces[name]; ok && !space.IsPattern() {
+		return space, true
+	}
+	for _, space := range c.spacePatterns {
+		if space.Matches(name, labels) {
+			return space, true
+		}
+	}
+	return SpaceEntry{}, false
+}
+
+// HasSpaceSelectors returns true if any space entry is matched by label selector
+func (c *Config) HasSpaceSelectors() bool {
+	for _, space := range c.spacePatterns {
+		if space.Selector != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// compileEntry validates the name, match type and selector of a config entry,
+// returning the compiled name pattern and label selector.
+func compileEntry(name, match, selector string) (*namePattern, labelSelector, error) {
+	if name == "" && selector == "" {
+		return nil, nil, errors.New("resource entries must have a name, a selector, or both")
+	}
+
+	pattern, err := newNamePattern(name, match)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if selector == "" {
+		return pattern, nil, nil
+	}
+	parsedSelector, err := parseLabelSelector(selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pattern, parsedSelector, nil
+}
+
+// index validates the app and space entries in c.Data, and builds the lookup
+// maps and pattern lists used to find them.
+func (c *Config) index() error {
+	c.Apps = make(map[string]AppEntry)
+	c.Spaces = make(map[string]SpaceEntry)
+	c.appPatterns = nil
+	c.spacePatterns = nil
+
+	for i := range c.Data.AppConfig.Apps {
+		app := &c.Data.AppConfig.Apps[i]
+		if err := app.compile(); err != nil {
+			return err
+		}
+
+		c.Apps[app.ID()] = *app
+		if app.IsPattern() {
+			c.appPatterns = append(c.appPatterns, *app)
+		}
+	}
+
+	for _, section := range c.Data.settingsSections() {
+		if err := section.compile(); err != nil {
+			return err
+		}
+	}
+
+	for i := range c.Data.SpaceConfig.Spaces {
+		space := &c.Data.SpaceConfig.Spaces[i]
+		if err := space.compile(); err != nil {
+			return err
+		}
+
+		c.Spaces[space.ID()] = *space
+		if space.IsPattern() {
+			c.spacePatterns = append(c.spacePatterns, *space)
+		}
+	}
+
+	return nil
+}
+
+// settingsSection is a part of the config validated independently of the app
+// and space entries, along with its path within the config
+type settingsSection struct {
+	path    string
+	compile func() error
+}
+
+// settingsSections returns the sections of the config other than its app and
+// space entries that must be validated, in order
+func (y *YAMLConfig) settingsSections() []settingsSection {
+	var sections []settingsSection
+	for i := range y.Exemptions {
+		sections = append(sections, settingsSection{fmt.Sprintf("exemptions[%d]", i), y.Exemptions[i].compile})
+	}
+	return append(sections,
+		settingsSection{"notifications", y.Notifications.compile},
+		settingsSection{"checks", y.Checks.compile},
+		settingsSection{"remediation", y.Remediation.compile},
+		settingsSection{"history.retention", func() error {
+			if y.History.Retention < 0 {
+				return errors.New("history retention cannot be negative")
+			}
+			return nil
+		}},
+	)
 }
 
 // Config file definition begins here
 
 // YAMLConfig represents top-level keys
 type YAMLConfig struct {
-	GlobalConfig GlobalConfig `yaml:"global"`
-	AppConfig    AppConfig    `yaml:"apps"`
-	SpaceConfig  SpaceConfig  `yaml:"spaces"`
+	GlobalConfig    GlobalConfig        `yaml:"global" doc:"Settings that apply to Watchtower as a whole"`
+	Include         []string            `yaml:"include,omitempty" doc:"Glob patterns of config fragments to merge into this config"`
+	TerraformStates []string            `yaml:"terraform_states,omitempty" doc:"Terraform state files to import apps and spaces from"`
+	AppConfig       AppConfig           `yaml:"apps" doc:"Monitoring of CF apps"`
+	SpaceConfig     SpaceConfig         `yaml:"spaces" doc:"Monitoring of CF spaces"`
+	Checks          ChecksConfig        `yaml:"checks,omitempty" doc:"Per-check settings. Checks that are not listed are enabled with warning severity"`
+	Notifications   NotificationsConfig `yaml:"notifications,omitempty" doc:"Notifications sent when drift is detected or resolved"`
+	History         HistoryConfig       `yaml:"history,omitempty" doc:"Local store of the lifecycle of every finding, served by /drift/history"`
+	AuditEvents     AuditEventsConfig   `yaml:"audit_events,omitempty" doc:"Correlation of unknown apps and routes with the Cloud Controller audit events that created them"`
+	Remediation     RemediationConfig   `yaml:"remediation,omitempty" doc:"Settings of the actions taken to remediate enforced drift"`
+	Exemptions      []ExemptionEntry    `yaml:"exemptions,omitempty" doc:"Drift that is knowingly accepted until the exemption expires"`
 }
 
 // GlobalConfig represents allowed values under the 'global' key
 type GlobalConfig struct {
-	HTTPBindPort       uint16        `yaml:"port"`
-	RefreshInterval    time.Duration `yaml:"refresh_interval"`
-	CloudControllerURL string        `yaml:"cloud_controller_url"`
+	HTTPBindPort       uint16        `yaml:"port" doc:"Port for Watchtower to listen on"`
+	RefreshInterval    time.Duration `yaml:"refresh_interval" doc:"How often Watchtower refreshes CF resources, e.g. 5m. Must be at least 10s"`
+	CloudControllerURL string        `yaml:"cloud_controller_url" doc:"Full URL of the Cloud Foundry Cloud Controller, as shown by cf api"`
+}
+
+// defaultHistoryRetention is how long resolved findings are kept in the history by default
+const defaultHistoryRetention = 90 * 24 * time.Hour
+
+// HistoryConfig represents allowed values under the 'history' key
+type HistoryConfig struct {
+	Path      string        `yaml:"path,omitempty" doc:"File the drift history is stored in. History is not recorded if not set"`
+	Retention time.Duration `yaml:"retention,omitempty" doc:"How long resolved findings are kept in the history, e.g. 720h. Defaults to 2160h (90 days)"`
+}
+
+// RetentionPeriod returns how long resolved findings are kept in the history
+func (h *HistoryConfig) RetentionPeriod() time.Duration {
+	if h.Retention == 0 {
+		return defaultHistoryRetention
+	}
+	return h.Retention
+}
+
+// AuditEventsConfig represents allowed values under the 'audit_events' key
+type AuditEventsConfig struct {
+	Enabled    *bool `yaml:"enabled,omitempty" doc:"Whether unknown apps and routes are correlated with audit events. Defaults to true"`
+	ActorLabel bool  `yaml:"actor_label,omitempty" doc:"Whether the unknown apps and routes metrics have an actor label. Defaults to false"`
+}
+
+// Correlate returns true unless audit event correlation is disabled
+func (a *AuditEventsConfig) Correlate() bool {
+	return a.Enabled == nil || *a.Enabled
 }
 
 // AppConfig represents allowed values under the 'apps' key
 type AppConfig struct {
-	Enabled bool       `yaml:"enabled"`
-	Apps    []AppEntry `yaml:"resources"`
+	Enabled        bool             `yaml:"enabled" doc:"Whether to enable monitoring of CF apps"`
+	RequiredLabels []string         `yaml:"required_labels,omitempty" doc:"Labels that every deployed app must have"`
+	Manifests      []ManifestSource `yaml:"manifests,omitempty" doc:"CF application manifests to import apps from"`
+	Apps           []AppEntry       `yaml:"resources" doc:"Apps that are expected to be deployed"`
+}
+
+// ManifestSource represents allowed values under the 'apps:manifests' key
+type ManifestSource struct {
+	Path      string            `yaml:"path" doc:"Path to the manifest, relative to the main config"`
+	VarsFiles []string          `yaml:"vars_files,omitempty" doc:"Files containing values for ((var)) placeholders in the manifest"`
+	Vars      map[string]string `yaml:"vars,omitempty" doc:"Values for ((var)) placeholders in the manifest"`
+
+	DefaultDomain string `yaml:"default_domain,omitempty" doc:"Domain of the default route CF maps to apps pushed without routes"`
 }
 
 // AppEntry represents allowed values under the 'apps:resources' key
 type AppEntry struct {
-	Name        string       `yaml:"name"`
-	Optional    bool         `yaml:"optional"`
-	Routes      []RouteEntry `yaml:"routes"`
-	SSHDisabled bool         `yaml:"ssh_disabled"`
+	Name          string       `yaml:"name,omitempty" doc:"Name of the app, or a name pattern when match is glob or regex"`
+	Match         string       `yaml:"match,omitempty" doc:"How the name is matched against deployed app names" enum:"exact,glob,regex"`
+	Selector      string       `yaml:"selector,omitempty" doc:"Label selector the app's CF metadata labels must match"`
+	Optional      bool         `yaml:"optional" doc:"Whether the app is never reported as missing"`
+	Routes        []RouteEntry `yaml:"routes" doc:"Routes the app must have, of the form <hostname>.<domain>"`
+	RoutePatterns []RouteEntry `yaml:"route_patterns,omitempty" doc:"Routes the app may have, whose hostnames are glob patterns"`
+	SSHDisabled   bool         `yaml:"ssh_disabled" doc:"Whether ssh to the app is expected to be disabled"`
+	EnforceSSH    *bool        `yaml:"enforce_ssh,omitempty" doc:"Whether ssh drift of the app is remediated. Overrides checks.app_ssh.enforce"`
+
+	// Expected app settings. Settings left unset are not checked.
+	Instances               int      `yaml:"instances,omitempty" doc:"Expected number of instances"`
+	Memory                  string   `yaml:"memory,omitempty" doc:"Expected memory limit with a unit of M, MB, G, GB, T or TB, e.g. 64M"`
+	Buildpacks              []string `yaml:"buildpacks,omitempty" doc:"Expected buildpacks, in the order they are applied"`
+	Services                []string `yaml:"services,omitempty" doc:"Names of the service instances expected to be bound to the app, in any order"`
+	HealthCheckType         string   `yaml:"health_check_type,omitempty" doc:"Expected health check type" enum:"port,process,http,none"`
+	HealthCheckHTTPEndpoint string   `yaml:"health_check_http_endpoint,omitempty" doc:"Expected health check HTTP endpoint"`
+
+	pattern  *namePattern
+	selector labelSelector
+}
+
+// MemoryMB returns the expected memory limit of the app in megabytes, or 0 if
+// the memory limit is not set.
+func (a *AppEntry) MemoryMB() int {
+	megabytes, err := parseMemoryMB(a.Memory)
+	if err != nil {
+		return 0
+	}
+	return megabytes
+}
+
+// HasSettings returns true if any of the expected app settings are set
+func (a *AppEntry) HasSettings() bool {
+	return a.Instances != 0 || a.Memory != "" || len(a.Buildpacks) != 0 || len(a.Services) != 0 ||
+		a.HealthCheckType != "" || a.HealthCheckHTTPEndpoint != ""
+}
+
+// compile validates the AppEntry, compiling its name pattern and label selector
+func (a *AppEntry) compile() error {
+	pattern, selector, err := compileEntry(a.Name, a.Match, a.Selector)
+	if err != nil {
+		return err
+	}
+	a.pattern = pattern
+	a.selector = selector
+	if _, err := parseMemoryMB(a.Memory); err != nil {
+		return fmt.Errorf("invalid memory for app %q: %w", a.ID(), err)
+	}
+	for _, route := range a.RoutePatterns {
+		if err := route.validateRoutePattern(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ID returns the name of the AppEntry, or its label selector when it has no name
+func (a *AppEntry) ID() string {
+	if a.Name == "" {
+		return "{" + a.Selector + "}"
+	}
+	return a.Name
+}
+
+// IsPattern returns true if the AppEntry name is a glob or regex pattern, or if
+// the AppEntry has a label selector
+func (a *AppEntry) IsPattern() bool {
+	return a.pattern.isPattern() || a.Selector != ""
+}
+
+// Matches returns true if the AppEntry applies to the named app with the given labels
+func (a *AppEntry) Matches(name string, labels map[string]string) bool {
+	return nameMatches(a.pattern, a.Name, name) && a.selector.matches(labels)
 }
 
-// ContainsRoute returns true if the AppEntry contains the specified route, false otherwise
+// ExactCopy returns a copy of the AppEntry that applies only to the named app,
+// keeping its routes and settings but not its name pattern or selector.
+func (a *AppEntry) ExactCopy(name string) AppEntry {
+	entry := *a
+	entry.Name, entry.Match, entry.Selector = name, "", ""
+	entry.pattern, entry.selector = nil, nil
+	entry.Routes = slices.Clone(a.Routes)
+	entry.RoutePatterns = slices.Clone(a.RoutePatterns)
+	entry.Buildpacks = slices.Clone(a.Buildpacks)
+	entry.Services = slices.Clone(a.Services)
+	return entry
+}
+
+// ContainsRoute returns true if the AppEntry contains the specified route, or the
+// route matches one of its route patterns, false otherwise
 func (a *AppEntry) ContainsRoute(route string) bool {
 	for _, routeEntry := range a.Routes {
 		if string(routeEntry) == route {
 			return true
 		}
 	}
+
+	routeURL := RouteEntry(route)
+	if len(a.RoutePatterns) == 0 || !strings.Contains(route, ".") {
+		return false
+	}
+	for _, routePattern := range a.RoutePatterns {
+		if routePattern.matchesHost(routeURL.Host(), routeURL.Domain()) {
+			return true
+		}
+	}
 	return false
 }
 
 // SpaceConfig represents the Watchtower 'spaces' config file section.
 type SpaceConfig struct {
-	Enabled bool         `yaml:"enabled"`
-	Spaces  []SpaceEntry `yaml:"resources"`
+	Enabled        bool         `yaml:"enabled" doc:"Whether to enable monitoring of CF spaces"`
+	RequiredLabels []string     `yaml:"required_labels,omitempty" doc:"Labels that every space must have"`
+	Spaces         []SpaceEntry `yaml:"resources" doc:"Spaces that are expected to exist"`
 }
 
 // SpaceEntry represents allowed values under the 'spaces:resources' key
 type SpaceEntry struct {
-	Name     string `yaml:"name"`
-	AllowSSH bool   `yaml:"allow_ssh"`
+	Name     string `yaml:"name,omitempty" doc:"Name of the space, or a name pattern when match is glob or regex"`
+	Match    string `yaml:"match,omitempty" doc:"How the name is matched against space names" enum:"exact,glob,regex"`
+	Selector string `yaml:"selector,omitempty" doc:"Label selector the space's CF metadata labels must match"`
+	AllowSSH bool   `yaml:"allow_ssh" doc:"Whether ssh is expected to be allowed in the space"`
+
+	EnforceSSH *bool `yaml:"enforce_ssh,omitempty" doc:"Whether ssh drift of the space is remediated. Overrides checks.spaces.enforce"`
+
+	pattern  *namePattern
+	selector labelSelector
+}
+
+// compile validates the SpaceEntry, compiling its name pattern and label selector
+func (s *SpaceEntry) compile() error {
+	pattern, selector, err := compileEntry(s.Name, s.Match, s.Selector)
+	if err != nil {
+		return err
+	}
+	s.pattern = pattern
+	s.selector = selector
+	return nil
+}
+
+// ID returns the name of the SpaceEntry, or its label selector when it has no name
+func (s *SpaceEntry) ID() string {
+	if s.Name == "" {
+		return "{" + s.Selector + "}"
+	}
+	return s.Name
+}
+
+// IsPattern returns true if the SpaceEntry name is a glob or regex pattern, or if
+// the SpaceEntry has a label selector
+func (s *SpaceEntry) IsPattern() bool {
+	return s.pattern.isPattern() || s.Selector != ""
+}
+
+// Matches returns true if the SpaceEntry applies to the named space with the given labels
+func (s *SpaceEntry) Matches(name string, labels map[string]string) bool {
+	return nameMatches(s.pattern, s.Name, name) && s.selector.matches(labels)
+}
+
+// ExactCopy returns a copy of the SpaceEntry that applies only to the named
+// space, keeping its settings but not its name pattern or selector.
+func (s *SpaceEntry) ExactCopy(name string) SpaceEntry {
+	entry := *s
+	entry.Name, entry.Match, entry.Selector = name, "", ""
+	entry.pattern, entry.selector = nil, nil
+	return entry
 }
 
 // RouteEntry represents the allowed values for each entry under 'routes' within 'apps'
@@ -99,62 +423,155 @@ func loadData(dataSource []byte) (Config, error) {
 	expandedString := os.ExpandEnv(string(dataSource))
 	dataSource = []byte(expandedString)
 
+	if err := validateSchema(dataSource); err != nil {
+		return Config{}, err
+	}
+
 	var yamlConfig YAMLConfig
 	if err := yaml.UnmarshalStrict(dataSource, &yamlConfig); err != nil {
 		return Config{}, err
 	}
+	if err := yamlConfig.GlobalConfig.validate(); err != nil {
+		return Config{}, err
+	}
+
+	var conf Config
+	conf.Data = yamlConfig
+	if err := conf.index(); err != nil {
+		return Config{}, err
+	}
 
-	if yamlConfig.GlobalConfig.HTTPBindPort == 0 {
-		return Config{}, errors.New("port 0 is reserved and cannot be used")
+	return conf, nil
+}
+
+// fieldError is a problem with the value of a single setting, so that lint can
+// report it at the line of the setting
+type fieldError struct {
+	field string // Path of the setting, e.g. global.port
+	err   error
+}
+
+func (e *fieldError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fieldError) Unwrap() error {
+	return e.err
+}
+
+// validate checks the global settings, and normalizes the Cloud Controller URL
+// to its scheme and host. Every problem found is returned as a fieldError.
+func (g *GlobalConfig) validate() error {
+	var errs []error
+	if g.HTTPBindPort == 0 {
+		errs = append(errs, &fieldError{"global.port", errors.New("port 0 is reserved and cannot be used")})
+	}
+	if g.RefreshInterval < minRefreshInterval {
+		errs = append(errs, &fieldError{"global.refresh_interval", errors.New("Refresh interval cannot be less than " + minRefreshInterval.String())})
 	}
-	if yamlConfig.GlobalConfig.RefreshInterval < minRefreshInterval {
-		return Config{}, errors.New("Refresh interval cannot be less than " + minRefreshInterval.String())
+	if err := g.normalizeCloudControllerURL(); err != nil {
+		errs = append(errs, &fieldError{"global.cloud_controller_url", err})
 	}
+	return errors.Join(errs...)
+}
 
-	// Do some basic validation on the provided Cloud Controller URL
-	ccURL, err := url.ParseRequestURI(yamlConfig.GlobalConfig.CloudControllerURL)
+// normalizeCloudControllerURL does some basic validation on the provided Cloud
+// Controller URL, and normalizes it to its scheme and host
+func (g *GlobalConfig) normalizeCloudControllerURL() error {
+	ccURL, err := url.ParseRequestURI(g.CloudControllerURL)
 	if err != nil {
-		return Config{}, errors.New("provided cloud controller URL could not be parsed")
+		return errors.New("provided cloud controller URL could not be parsed")
 	}
 
 	switch {
 	case !ccURL.IsAbs():
-		return Config{}, errors.New("provided cloud controller URL was not an absolute URL")
+		return errors.New("provided cloud controller URL was not an absolute URL")
 	case ccURL.Scheme != "https":
-		return Config{}, errors.New("unsupported scheme in cloud controller URL")
+		return errors.New("unsupported scheme in cloud controller URL")
 	case strings.Contains(ccURL.String(), ".."):
-		return Config{}, errors.New("suspected directory traversal in cloud controller URL")
+		return errors.New("suspected directory traversal in cloud controller URL")
 	case ccURL.Fragment != "":
-		return Config{}, errors.New("fragments unsupported in cloud controller URL")
+		return errors.New("fragments unsupported in cloud controller URL")
 	case ccURL.RawQuery != "":
-		return Config{}, errors.New("queries unsupported in cloud controller URL")
+		return errors.New("queries unsupported in cloud controller URL")
 	}
 
-	yamlConfig.GlobalConfig.CloudControllerURL = ccURL.Scheme + "://" + ccURL.Host
-
-	var conf Config
-	conf.Data = yamlConfig
-	conf.Apps = make(map[string]AppEntry)
-	conf.Spaces = make(map[string]SpaceEntry)
+	g.CloudControllerURL = ccURL.Scheme + "://" + ccURL.Host
+	return nil
+}
 
-	for _, app := range conf.Data.AppConfig.Apps {
-		conf.Apps[app.Name] = app
+// Parse parses config file data into a Config. Unlike Load, 'include' patterns
+// 'terraform_states' and 'apps:manifests' in the data are not resolved.
+func Parse(data []byte) (Config, error) {
+	conf, err := loadData(data)
+	if err != nil {
+		return Config{}, err
 	}
-
-	for _, space := range conf.Data.SpaceConfig.Spaces {
-		conf.Spaces[space.Name] = space
+	// Load reports duplicates along with those of its fragments
+	if err := mergeFragments(&conf, "config", nil); err != nil {
+		return Config{}, err
 	}
-
 	return conf, nil
 }
 
-// Load reads the named file and returns a Config.
+// Load reads the named file and returns a Config. If filename is a directory,
+// the main config is read from the config.yaml file within it and every other
+// YAML file beneath the directory is merged in as a fragment. Files matching the
+// 'include' patterns of the main config are merged in as fragments as well, as
+// are the apps of any CF manifests listed under 'apps:manifests' and the apps
+// and spaces of any Terraform states listed under 'terraform_states'.
 func Load(filename string) (Config, error) {
-	configFileName := filepath.Clean(filename)
+	configFileName, fragmentFiles, err := findConfigFiles(filename)
+	if err != nil {
+		return Config{}, err
+	}
+
 	data, err := os.ReadFile(configFileName)
 	if err != nil {
 		return Config{}, err
 	}
 
-	return loadData(data)
+	conf, err := loadData(data)
+	if err != nil {
+		return Config{}, err
+	}
+	baseDir := filepath.Dir(configFileName)
+
+	includedFiles, err := expandIncludes(baseDir, conf.Data.Include)
+	if err != nil {
+		return Config{}, err
+	}
+
+	manifestFragments, manifestFiles, err := loadManifests(baseDir, conf.Data.AppConfig.Manifests)
+	if err != nil {
+		return Config{}, err
+	}
+
+	stateFragments, stateFiles, err := loadTerraformStates(baseDir, conf.Data.TerraformStates)
+	if err != nil {
+		return Config{}, err
+	}
+	manifestFragments = append(manifestFragments, stateFragments...)
+	manifestFiles = append(manifestFiles, stateFiles...)
+
+	// Manifests, vars files and Terraform states are never treated as config
+	// fragments, even when they are found within a config directory.
+	exclude := append([]string{configFileName}, manifestFiles...)
+	fragmentFiles = uniqueSortedFiles(append(fragmentFiles, includedFiles...), exclude...)
+
+	fragments, err := loadFragments(fragmentFiles)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if err := mergeFragments(&conf, configFileName, append(fragments, manifestFragments...)); err != nil {
+		return Config{}, err
+	}
+	if err := conf.index(); err != nil {
+		return Config{}, err
+	}
+	conf.configFiles = append([]string{configFileName}, fragmentFiles...)
+	conf.Sources = append(append([]string{}, conf.configFiles...), manifestFiles...)
+
+	return conf, nil
 }
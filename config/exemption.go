@@ -0,0 +1,97 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// exemptionDateFormat is the format of exemption expiry dates without a time
+const exemptionDateFormat = "2006-01-02"
+
+// ExemptionEntry represents allowed values under the 'exemptions' key. An
+// exemption accepts drift of one kind for the resources it matches, until it
+// expires.
+type ExemptionEntry struct {
+	Name     string `yaml:"name,omitempty" doc:"Name of the exempted app or space, or a name pattern when match is glob or regex"`
+	Match    string `yaml:"match,omitempty" doc:"How the name is matched against app and space names" enum:"exact,glob,regex"`
+	Selector string `yaml:"selector,omitempty" doc:"Label selector the resource's CF metadata labels must match"`
+	Kind     string `yaml:"kind,omitempty" doc:"Kind of drift that is exempted. Omit to exempt every kind" enum:"unknown_app,missing_app,unknown_route,missing_route,app_ssh,app_settings,app_labels,space_ssh,space_labels"`
+	Reason   string `yaml:"reason" doc:"Why the drift is accepted"`
+	Ticket   string `yaml:"ticket,omitempty" doc:"Reference to the ticket tracking the drift"`
+	Expires  string `yaml:"expires" doc:"When the exemption stops applying, as a date (YYYY-MM-DD, midnight UTC) or an RFC 3339 time"`
+
+	expires  time.Time
+	pattern  *namePattern
+	selector labelSelector
+}
+
+// ID returns a description of the resources and drift kind the exemption applies to
+func (e *ExemptionEntry) ID() string {
+	id := e.Name
+	if e.Selector != "" {
+		id += "{" + e.Selector + "}"
+	}
+	if e.Kind != "" {
+		id += ":" + e.Kind
+	}
+	return id
+}
+
+// ExpiresAt returns the time at which the exemption stops applying
+func (e *ExemptionEntry) ExpiresAt() time.Time {
+	return e.expires
+}
+
+// Applies returns true if the exemption covers drift of the given kind for the
+// named resource with the given labels at time now.
+func (e *ExemptionEntry) Applies(kind, name string, labels map[string]string, now time.Time) bool {
+	return (e.Kind == "" || e.Kind == kind) && now.Before(e.expires) &&
+		nameMatches(e.pattern, e.Name, name) && e.selector.matches(labels)
+}
+
+// parseExemptionExpiry parses the expiry of an exemption, which is either a
+// date or an RFC 3339 time.
+func parseExemptionExpiry(expires string) (time.Time, error) {
+	if expires == "" {
+		return time.Time{}, errors.New("exemptions must have an expiry date")
+	}
+	if t, err := time.Parse(exemptionDateFormat, expires); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, expires)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("exemption expiry %q must be a date (YYYY-MM-DD) or an RFC 3339 time", expires)
+	}
+	return t, nil
+}
+
+// compile validates the ExemptionEntry and compiles its name pattern, selector
+// and expiry.
+func (e *ExemptionEntry) compile() error {
+	pattern, selector, err := compileEntry(e.Name, e.Match, e.Selector)
+	if err != nil {
+		return err
+	}
+	if e.Reason == "" {
+		return fmt.Errorf("exemption %q must have a reason", e.ID())
+	}
+	expires, err := parseExemptionExpiry(e.Expires)
+	if err != nil {
+		return fmt.Errorf("exemption %q: %w", e.ID(), err)
+	}
+
+	e.pattern, e.selector, e.expires = pattern, selector, expires
+	return nil
+}
+
+// FindExemption returns the first exemption covering drift of the given kind
+// for the named resource with the given labels at time now.
+func (c *Config) FindExemption(kind, name string, labels map[string]string, now time.Time) (ExemptionEntry, bool) {
+	for _, exemption := range c.Data.Exemptions {
+		if exemption.Applies(kind, name, labels, now) {
+			return exemption, true
+		}
+	}
+	return ExemptionEntry{}, false
+}
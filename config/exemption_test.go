@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+const exemptionConfig = `---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+exemptions:
+  - name: debug-*
+    match: glob
+    kind: app_ssh
+    reason: Debugging a memory leak
+    ticket: OPS-123
+    expires: 2026-11-01
+  - selector: team=data
+    reason: Data team apps are managed elsewhere
+    expires: 2026-11-01T12:00:00Z`
+
+// TestExemptions ensures that exemptions apply to matching drift until they expire.
+func TestExemptions(t *testing.T) {
+	conf, err := Parse([]byte(exemptionConfig))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	before := time.Date(2026, 10, 31, 0, 0, 0, 0, time.UTC)
+	if exemption, ok := conf.FindExemption("app_ssh", "debug-app", nil, before); !ok || exemption.Ticket != "OPS-123" {
+		t.Fatalf("Exemption did not apply to matching drift. Found: %+v", exemption)
+	}
+	if _, ok := conf.FindExemption("unknown_app", "debug-app", nil, before); ok {
+		t.Fatal("Exemption applied to drift of another kind")
+	}
+	if _, ok := conf.FindExemption("app_ssh", "debug-app", nil, before.Add(48*time.Hour)); ok {
+		t.Fatal("Exemption applied after its expiry date")
+	}
+
+	labels := map[string]string{"team": "data"}
+	if _, ok := conf.FindExemption("missing_app", "etl", labels, before.Add(35*time.Hour)); !ok {
+		t.Fatal("Exemption without a kind did not apply before its expiry time")
+	}
+	if _, ok := conf.FindExemption("missing_app", "etl", labels, before.Add(36*time.Hour)); ok {
+		t.Fatal("Exemption applied after its expiry time")
+	}
+}
+
+// TestInvalidExemptions ensures that exemptions without a reason or valid expiry are load errors.
+func TestInvalidExemptions(t *testing.T) {
+	base := "global:\n  port: 8443\n  refresh_interval: 15s\n  cloud_controller_url: https://api.fr.cloud.gov\nexemptions:\n"
+	invalid := []string{
+		"  - name: app\n    expires: 2026-11-01",
+		"  - name: app\n    reason: testing",
+		"  - name: app\n    reason: testing\n    expires: next week",
+		"  - reason: testing\n    expires: 2026-11-01",
+		"  - name: app\n    kind: app_memory\n    reason: testing\n    expires: 2026-11-01",
+	}
+	for _, exemption := range invalid {
+		if _, err := Parse([]byte(fmt.Sprintf("%s%s", base, exemption))); err == nil {
+			t.Fatalf("Invalid exemption loaded without erroring:\n%s", exemption)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// mainConfigFileName is the name of the main config file when Load is given a directory
+const mainConfigFileName = "config.yaml"
+
+// fragmentConfig represents the keys allowed in config fragments. Fragments may
+// only list resources; all other settings belong in the main config file.
+type fragmentConfig struct {
+	AppConfig struct {
+		Apps []AppEntry `yaml:"resources"`
+	} `yaml:"apps"`
+	SpaceConfig struct {
+		Spaces []SpaceEntry `yaml:"resources"`
+	} `yaml:"spaces"`
+}
+
+// isYAMLFile returns true if the named file has a YAML file extension
+func isYAMLFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// findConfigFiles returns the main config file named by filename. If filename is
+// a directory, the main config file is the config.yaml file within it, and every
+// other YAML file beneath the directory is returned as a fragment.
+func findConfigFiles(filename string) (string, []string, error) {
+	configFileName := filepath.Clean(filename)
+	info, err := os.Stat(configFileName)
+	if err != nil {
+		return "", nil, err
+	}
+	if !info.IsDir() {
+		return configFileName, nil, nil
+	}
+
+	mainFile := filepath.Join(configFileName, mainConfigFileName)
+	fragments, err := findDirFragments(configFileName, mainFile)
+	if err != nil {
+		return "", nil, err
+	}
+	return mainFile, fragments, nil
+}
+
+// findDirFragments returns the paths of all YAML files beneath dir, excluding mainFile.
+func findDirFragments(dir, mainFile string) ([]string, error) {
+	var fragments []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && isYAMLFile(path) && path != mainFile {
+			fragments = append(fragments, path)
+		}
+		return nil
+	})
+	return fragments, err
+}
+
+// expandIncludes resolves the glob patterns listed under 'include'. Relative
+// patterns are resolved against baseDir, the directory of the main config file.
+func expandIncludes(baseDir string, patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(baseDir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// loadedFragment is a fragmentConfig along with the path of the file it was loaded from
+type loadedFragment struct {
+	source string
+	config fragmentConfig
+}
+
+// loadFragments loads each of the named fragment files
+func loadFragments(filenames []string) ([]loadedFragment, error) {
+	var fragments []loadedFragment
+	var errs []error
+	for _, filename := range filenames {
+		fragment, err := loadFragment(filename)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fragments = append(fragments, loadedFragment{source: filename, config: fragment})
+	}
+	return fragments, errors.Join(errs...)
+}
+
+// loadFragment reads the named file and parses it into a fragmentConfig
+func loadFragment(filename string) (fragmentConfig, error) {
+	data, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return fragmentConfig{}, err
+	}
+
+	data = []byte(os.ExpandEnv(string(data)))
+	if err := validateSchema(data); err != nil {
+		return fragmentConfig{}, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	var fragment fragmentConfig
+	if err := yaml.UnmarshalStrict(data, &fragment); err != nil {
+		return fragmentConfig{}, fmt.Errorf("%s: %w", filename, err)
+	}
+	return fragment, nil
+}
+
+// mergeFragments appends the resources of each fragment, in order, to conf.Data.
+// Resources defined more than once, whether in the same file or in different
+// files, are reported as errors.
+func mergeFragments(conf *Config, mainFile string, fragments []loadedFragment) error {
+	var errs []error
+	appSources := make(map[string]string)
+	spaceSources := make(map[string]string)
+	addApp := func(app AppEntry, filename string) bool {
+		if source, ok := appSources[app.ID()]; ok {
+			errs = append(errs, duplicateError("app", app.ID(), source, filename))
+			return false
+		}
+		appSources[app.ID()] = filename
+		return true
+	}
+	addSpace := func(space SpaceEntry, filename string) bool {
+		if source, ok := spaceSources[space.ID()]; ok {
+			errs = append(errs, duplicateError("space", space.ID(), source, filename))
+			return false
+		}
+		spaceSources[space.ID()] = filename
+		return true
+	}
+
+	for _, app := range conf.Data.AppConfig.Apps {
+		addApp(app, mainFile)
+	}
+	for _, space := range conf.Data.SpaceConfig.Spaces {
+		addSpace(space, mainFile)
+	}
+	for _, fragment := range fragments {
+		for _, app := range fragment.config.AppConfig.Apps {
+			if addApp(app, fragment.source) {
+				conf.Data.AppConfig.Apps = append(conf.Data.AppConfig.Apps, app)
+			}
+		}
+		for _, space := range fragment.config.SpaceConfig.Spaces {
+			if addSpace(space, fragment.source) {
+				conf.Data.SpaceConfig.Spaces = append(conf.Data.SpaceConfig.Spaces, space)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// duplicateError reports a resource of the given kind that is defined in both
+// files, or more than once in a single file
+func duplicateError(kind, id, first, second string) error {
+	if first == second {
+		return fmt.Errorf("duplicate %s %q defined more than once in %s", kind, id, first)
+	}
+	return fmt.Errorf("duplicate %s %q defined in %s and %s", kind, id, first, second)
+}
+
+// uniqueSortedFiles returns the sorted, de-duplicated list of files, excluding
+// any files listed in exclude.
+func uniqueSortedFiles(files []string, exclude ...string) []string {
+	seen := make(map[string]bool)
+	for _, file := range exclude {
+		seen[filepath.Clean(file)] = true
+	}
+	var unique []string
+	for _, file := range files {
+		file = filepath.Clean(file)
+		if !seen[file] {
+			seen[file] = true
+			unique = append(unique, file)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const includeMainConfig = `---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+include:
+  - apps.d/*.yaml
+apps:
+  enabled: true
+  resources:
+    - name: main-app
+spaces:
+  enabled: true
+  resources:
+    - name: prod`
+
+func writeTestFile(t *testing.T, path, data string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		t.Fatalf("Failed creating test directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed writing test file: %v", err)
+	}
+}
+
+// TestLoadIncludes ensures that fragments matching 'include' patterns are merged in sorted order.
+func TestLoadIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), includeMainConfig)
+	writeTestFile(t, filepath.Join(dir, "apps.d", "team-b.yaml"), "apps:\n  resources:\n    - name: b-app")
+	writeTestFile(t, filepath.Join(dir, "apps.d", "team-a.yaml"), "apps:\n  resources:\n    - name: a-app\nspaces:\n  resources:\n    - name: dev")
+
+	conf, err := Load(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	apps := conf.Data.AppConfig.Apps
+	if len(apps) != 3 || apps[0].Name != "main-app" || apps[1].Name != "a-app" || apps[2].Name != "b-app" {
+		t.Fatalf("Fragments were not merged in order. Found: %+v", apps)
+	}
+	if _, ok := conf.Spaces["dev"]; !ok {
+		t.Fatalf("Fragment space was not merged. Found: %+v", conf.Spaces)
+	}
+	if len(conf.Sources) != 3 {
+		t.Fatalf("Incorrect number of sources. Found: %+v", conf.Sources)
+	}
+}
+
+// TestLoadDirectory ensures that every YAML file beneath a config directory is merged in.
+func TestLoadDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), includeMainConfig)
+	writeTestFile(t, filepath.Join(dir, "team-a", "apps.yml"), "apps:\n  resources:\n    - name: a-app")
+	writeTestFile(t, filepath.Join(dir, "README.md"), "not a fragment")
+
+	conf, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+	if _, ok := conf.Apps["a-app"]; !ok {
+		t.Fatalf("Directory fragment was not merged. Found: %+v", conf.Apps)
+	}
+}
+
+// TestDuplicateFragments ensures that resources defined in more than one file are load errors.
+func TestDuplicateFragments(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), includeMainConfig)
+	writeTestFile(t, filepath.Join(dir, "apps.d", "team-a.yaml"), "apps:\n  resources:\n    - name: main-app")
+
+	if _, err := Load(filepath.Join(dir, "config.yaml")); err == nil {
+		t.Fatal("Duplicate app across fragments did not result in error")
+	}
+
+	writeTestFile(t, filepath.Join(dir, "apps.d", "team-a.yaml"), "spaces:\n  resources:\n    - name: prod")
+	if _, err := Load(filepath.Join(dir, "config.yaml")); err == nil {
+		t.Fatal("Duplicate space across fragments did not result in error")
+	}
+}
+
+// TestDuplicateWithinFile ensures that resources defined more than once in the
+// same file are load errors, and that every duplicate is reported.
+func TestDuplicateWithinFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), includeMainConfig+"\n    - name: prod")
+	writeTestFile(t, filepath.Join(dir, "apps.d", "team-a.yaml"), "apps:\n  resources:\n    - name: a-app\n    - name: a-app")
+
+	_, err := Load(filepath.Join(dir, "config.yaml"))
+	if err == nil || !strings.Contains(err.Error(), `duplicate app "a-app" defined more than once in `+filepath.Join(dir, "apps.d", "team-a.yaml")) ||
+		!strings.Contains(err.Error(), `duplicate space "prod" defined more than once in `+filepath.Join(dir, "config.yaml")) {
+		t.Fatalf("Duplicates within a file were not reported. Found: %v", err)
+	}
+
+	if _, err := Parse([]byte(includeMainConfig + "\n    - name: prod")); err == nil {
+		t.Fatal("Duplicate space in parsed config did not result in error")
+	}
+}
+
+// TestFragmentGlobalRejected ensures that fragments may only contain resources.
+func TestFragmentGlobalRejected(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), includeMainConfig)
+	writeTestFile(t, filepath.Join(dir, "apps.d", "team-a.yaml"), "global:\n  port: 8080")
+
+	if _, err := Load(filepath.Join(dir, "config.yaml")); err == nil {
+		t.Fatal("Fragment with global settings loaded without erroring")
+	}
+}
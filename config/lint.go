@@ -0,0 +1,411 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Problem is an issue found in a config file by Lint. Line is 0 when the
+// location of the issue within the file is not known.
+type Problem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+// String formats the Problem as file:line: message
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+// yamlErrorLine matches the line number yaml.v2 and yaml.v3 errors begin with
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// Lint strictly validates the named config, and returns every problem found in
+// it. The main config, each fragment, CF manifest and Terraform state are linted
+// separately, so that a problem in one file does not hide those in the others,
+// and each problem is reported against the file and, where it is known, the line
+// it was found on. Beyond the errors reported by Load, Lint reports routes
+// without a domain, and exact app entries that are also matched by a pattern
+// entry with different optional or ssh_disabled settings.
+func Lint(filename string) []Problem {
+	mainFile, fragmentFiles, err := findConfigFiles(filename)
+	if err != nil {
+		return []Problem{{File: filename, Message: err.Error()}}
+	}
+
+	l := &linter{apps: make(map[string]entryLocation), spaces: make(map[string]entryLocation)}
+	main, conf := l.lintMainFile(mainFile)
+	baseDir := filepath.Dir(mainFile)
+
+	includedFiles, err := expandIncludes(baseDir, conf.Include)
+	if err != nil {
+		main.report("include", "%s", err)
+	}
+
+	// Manifests, vars files and Terraform states are never treated as config
+	// fragments, even when they are found within a config directory.
+	exclude := []string{mainFile}
+	for i := range conf.AppConfig.Manifests {
+		manifestPath, varsFiles := conf.AppConfig.Manifests[i].resolve(baseDir)
+		exclude = append(append(exclude, manifestPath), varsFiles...)
+	}
+	for _, path := range conf.TerraformStates {
+		exclude = append(exclude, resolvePath(baseDir, path))
+	}
+
+	// Files are linted in the order Load merges them, so that each duplicate is
+	// reported where Load finds it
+	for _, file := range uniqueSortedFiles(append(fragmentFiles, includedFiles...), exclude...) {
+		l.lintFragment(file)
+	}
+	for i := range conf.AppConfig.Manifests {
+		l.lintManifest(main, i, conf.AppConfig.Manifests[i], baseDir)
+	}
+	for _, path := range conf.TerraformStates {
+		l.lintTerraformState(resolvePath(baseDir, path))
+	}
+
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		if l.problems[i].File != l.problems[j].File {
+			return l.problems[i].File < l.problems[j].File
+		}
+		return l.problems[i].Line < l.problems[j].Line
+	})
+	return l.problems
+}
+
+// entryLocation is the file and line an app or space entry is defined on
+type entryLocation struct {
+	file string
+	line int
+}
+
+// String formats the entryLocation as file:line, or file if the line is not known
+func (e entryLocation) String() string {
+	if e.line == 0 {
+		return e.file
+	}
+	return fmt.Sprintf("%s:%d", e.file, e.line)
+}
+
+// linter collects the problems found in every file of a config, along with
+// where each app and space entry was first defined
+type linter struct {
+	problems []Problem
+	apps     map[string]entryLocation
+	spaces   map[string]entryLocation
+}
+
+// openFile reads the named YAML file, returning its fileLinter along with its
+// data. The data is nil if the file could not be read or parsed, which is
+// reported.
+func (l *linter) openFile(filename string) (*fileLinter, []byte) {
+	f := &fileLinter{linter: l, file: filename}
+	data, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		f.reportError("", err)
+		return f, nil
+	}
+
+	var root yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &root); err != nil {
+		f.reportError("", err)
+		return f, nil
+	}
+	f.root = &root
+	return f, data
+}
+
+// lintMainFile lints the main config file, returning its fileLinter along with
+// as much of the config as could be parsed
+func (l *linter) lintMainFile(filename string) (*fileLinter, YAMLConfig) {
+	var conf YAMLConfig
+	f, data := l.openFile(filename)
+	if data == nil {
+		return f, conf
+	}
+
+	f.decode([]byte(os.ExpandEnv(string(data))), &conf)
+	if err := conf.GlobalConfig.validate(); err != nil {
+		for _, err := range unwrapErrors(err) {
+			path := "global"
+			var fieldErr *fieldError
+			if errors.As(err, &fieldErr) {
+				path = fieldErr.field
+			}
+			f.report(path, "%s", err)
+		}
+	}
+	for _, section := range conf.settingsSections() {
+		if err := section.compile(); err != nil {
+			f.report(section.path, "%s", err)
+		}
+	}
+	f.lintApps(conf.AppConfig.Apps)
+	f.lintSpaces(conf.SpaceConfig.Spaces)
+	return f, conf
+}
+
+// lintFragment lints a config fragment
+func (l *linter) lintFragment(filename string) {
+	f, data := l.openFile(filename)
+	if data == nil {
+		return
+	}
+
+	var fragment fragmentConfig
+	f.decode([]byte(os.ExpandEnv(string(data))), &fragment)
+	f.lintApps(fragment.AppConfig.Apps)
+	f.lintSpaces(fragment.SpaceConfig.Spaces)
+}
+
+// lintManifest lints the CF manifest of source, which is entry i of
+// 'apps:manifests' in the main config. Vars files that cannot be read are
+// reported against the entry.
+func (l *linter) lintManifest(main *fileLinter, i int, source ManifestSource, baseDir string) {
+	manifestPath, varsFiles := source.resolve(baseDir)
+	vars, err := loadManifestVars(varsFiles, source.Vars)
+	if err != nil {
+		main.report(fmt.Sprintf("apps.manifests[%d]", i), "%s", err)
+		return
+	}
+
+	f, data := l.openFile(manifestPath)
+	if data == nil {
+		return
+	}
+	manifest, err := parseManifest(manifestPath, vars)
+	if err != nil {
+		f.reportError("", err)
+		return
+	}
+
+	for i := range manifest.Applications {
+		line := f.line(fmt.Sprintf("applications[%d]", i))
+		app, err := manifest.manifestAppEntry(i, source.DefaultDomain)
+		if err == nil {
+			err = app.compile()
+		}
+		if err != nil {
+			f.reportLine(line, "%s", err)
+			continue
+		}
+		f.addEntry("app", l.apps, app.ID(), line)
+	}
+}
+
+// lintTerraformState lints a Terraform state. The lines of its resources are not known.
+func (l *linter) lintTerraformState(filename string) {
+	f := &fileLinter{linter: l, file: filename}
+	fragment, err := loadTerraformState(filename)
+	if err != nil {
+		f.reportError("", err)
+		return
+	}
+
+	for i := range fragment.AppConfig.Apps {
+		app := &fragment.AppConfig.Apps[i]
+		if err := app.compile(); err != nil {
+			f.reportLine(0, "%s", err)
+			continue
+		}
+		f.addEntry("app", l.apps, app.ID(), 0)
+	}
+	for i := range fragment.SpaceConfig.Spaces {
+		f.addEntry("space", l.spaces, fragment.SpaceConfig.Spaces[i].ID(), 0)
+	}
+}
+
+// fileLinter reports the problems found in a single file
+type fileLinter struct {
+	*linter
+	file string
+	root *yamlv3.Node // nil if the file is not YAML, or could not be parsed
+}
+
+// reportLine records a problem found on the given line
+func (f *fileLinter) reportLine(line int, format string, args ...interface{}) {
+	f.problems = append(f.problems, Problem{File: f.file, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+// report records a problem found at path within the file. See line.
+func (f *fileLinter) report(path, format string, args ...interface{}) {
+	f.reportLine(f.line(path), format, args...)
+}
+
+// reportError records each error joined in err as a problem found at path,
+// unless the error gives its own line. Errors prefixed with the name of the
+// file have the prefix removed.
+func (f *fileLinter) reportError(path string, err error) {
+	for _, err := range unwrapErrors(err) {
+		messages := []string{err.Error()}
+		var typeErr *yaml.TypeError
+		var typeErrV3 *yamlv3.TypeError
+		if errors.As(err, &typeErr) {
+			messages = typeErr.Errors
+		} else if errors.As(err, &typeErrV3) {
+			messages = typeErrV3.Errors
+		}
+
+		for _, message := range messages {
+			message = strings.TrimPrefix(message, f.file+": ")
+			line := f.line(path)
+			if match := yamlErrorLine.FindStringSubmatch(message); match != nil {
+				line, _ = strconv.Atoi(match[1])
+				message = match[2]
+			}
+			f.reportLine(line, "%s", message)
+		}
+	}
+}
+
+// unwrapErrors returns the errors joined in err, or err itself if it is not a
+// joined error
+func unwrapErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+// decode unmarshals config data into out, strictly if data is valid against
+// the config schema. Each schema violation is reported at its path, and as much
+// of the data as possible is decoded so that the rest of the file is linted.
+func (f *fileLinter) decode(data []byte, out interface{}) {
+	if err := validateSchema(data); err != nil {
+		for _, violation := range unwrapErrors(err) {
+			path, _, _ := strings.Cut(violation.Error(), ": ")
+			f.reportError(path, violation)
+		}
+		_ = yaml.Unmarshal(data, out)
+		return
+	}
+
+	if err := yaml.UnmarshalStrict(data, out); err != nil {
+		f.reportError("", err)
+		_ = yaml.Unmarshal(data, out)
+	}
+}
+
+// line returns the line of the value at path within the file, such as
+// "apps.resources[2].memory", or of its closest ancestor that is found. Mapping
+// values are located by the line of their key. It returns 0 if no part of path
+// is found.
+func (f *fileLinter) line(path string) int {
+	if f.root == nil || len(f.root.Content) == 0 || path == "" {
+		return 0
+	}
+
+	node, line := f.root.Content[0], 0
+	for _, segment := range strings.Split(path, ".") {
+		key, indexes, _ := strings.Cut(segment, "[")
+		if key != "" {
+			value, keyLine := mappingValue(node, key)
+			if value == nil {
+				return line
+			}
+			node, line = value, keyLine
+		}
+
+		for _, index := range strings.FieldsFunc(indexes, func(r rune) bool { return r == '[' || r == ']' }) {
+			i, err := strconv.Atoi(index)
+			if err != nil || node.Kind != yamlv3.SequenceNode || i >= len(node.Content) {
+				return line
+			}
+			node = node.Content[i]
+			line = node.Line
+		}
+	}
+	return line
+}
+
+// mappingValue returns the value of key within a mapping node, along with the
+// line of the key. It returns nil if node is not a mapping or has no such key.
+func mappingValue(node *yamlv3.Node, key string) (*yamlv3.Node, int) {
+	if node.Kind != yamlv3.MappingNode {
+		return nil, 0
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1], node.Content[i].Line
+		}
+	}
+	return nil, 0
+}
+
+// addEntry records the app or space entry with the given ID defined on line,
+// reporting it if it was already defined in seen
+func (f *fileLinter) addEntry(kind string, seen map[string]entryLocation, id string, line int) {
+	first, ok := seen[id]
+	switch {
+	case !ok:
+		seen[id] = entryLocation{file: f.file, line: line}
+	case first.file == f.file && first.line != 0:
+		f.reportLine(line, "duplicate %s %q (first defined on line %d)", kind, id, first.line)
+	default:
+		f.reportLine(line, "duplicate %s %q (first defined in %s)", kind, id, first)
+	}
+}
+
+// lintApps reports invalid and duplicate apps, routes without a domain, and exact
+// apps that are also matched by a pattern with contradictory settings.
+func (f *fileLinter) lintApps(apps []AppEntry) {
+	appLines := make([]int, len(apps))
+	for i := range apps {
+		app := &apps[i]
+		path := fmt.Sprintf("apps.resources[%d]", i)
+		appLines[i] = f.line(path)
+		if err := app.compile(); err != nil {
+			f.reportLine(appLines[i], "%s", err)
+		}
+		f.addEntry("app", f.apps, app.ID(), appLines[i])
+
+		for j, route := range app.Routes {
+			if !strings.Contains(string(route), ".") {
+				f.report(fmt.Sprintf("%s.routes[%d]", path, j), "route %q of app %q has no domain", route, app.ID())
+			}
+		}
+	}
+
+	for i := range apps {
+		app := &apps[i]
+		if app.IsPattern() || app.Name == "" {
+			continue
+		}
+		for j := range apps {
+			pattern := &apps[j]
+			if !pattern.pattern.isPattern() || pattern.Selector != "" || !pattern.Matches(app.Name, nil) {
+				continue
+			}
+			if app.Optional != pattern.Optional || app.SSHDisabled != pattern.SSHDisabled {
+				f.reportLine(appLines[i], "app %q is also matched by pattern %q (line %d) with different optional or ssh_disabled settings",
+					app.Name, pattern.Name, appLines[j])
+			}
+		}
+	}
+}
+
+// lintSpaces reports invalid and duplicate spaces
+func (f *fileLinter) lintSpaces(spaces []SpaceEntry) {
+	for i := range spaces {
+		space := &spaces[i]
+		line := f.line(fmt.Sprintf("spaces.resources[%d]", i))
+		if err := space.compile(); err != nil {
+			f.reportLine(line, "%s", err)
+		}
+		f.addEntry("space", f.spaces, space.ID(), line)
+	}
+}
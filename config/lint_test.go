@@ -0,0 +1,119 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+const lintConfig = `---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+apps:
+  enabled: true
+  resources:
+    - name: web
+      routes:
+        - web.app.cloud.gov
+        - localhost # no domain
+    - name: worker
+      ssh_disabled: true
+    - name: web
+    - name: work*
+      match: glob
+      optional: true
+spaces:
+  enabled: true
+  resources:
+    - name: dev
+    - name: prod
+    - name: dev`
+
+// TestLint ensures that every problem in a config is reported with its line number.
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "config.yaml")
+	writeTestFile(t, filename, lintConfig)
+
+	expected := []string{
+		filename + `:12: route "localhost" of app "web" has no domain`,
+		filename + `:13: app "worker" is also matched by pattern "work*" (line 16) with different optional or ssh_disabled settings`,
+		filename + `:15: duplicate app "web" (first defined on line 9)`,
+		filename + `:24: duplicate space "dev" (first defined on line 22)`,
+	}
+
+	problems := Lint(filename)
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems. Found: %+v", len(expected), problems)
+	}
+	for i, problem := range problems {
+		if problem.String() != expected[i] {
+			t.Fatalf("Problem %d incorrect.\nFound:    %s\nExpected: %s", i, problem, expected[i])
+		}
+	}
+}
+
+// TestLintLoadErrors ensures that errors reported by Load are included in the lint problems.
+func TestLintLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), lintConfig)
+	writeTestFile(t, filepath.Join(dir, "more.yaml"), "spaces:\n  resources:\n    - name: prod\n    - name: qa\n    - name: qa")
+
+	problems := Lint(dir)
+	if len(problems) != 6 {
+		t.Fatalf("Expected 6 problems. Found: %+v", problems)
+	}
+	if problems[len(problems)-1].String() != filepath.Join(dir, "more.yaml")+`:5: duplicate space "qa" (first defined on line 4)` {
+		t.Fatalf("Fragment problem incorrect. Found: %s", problems[len(problems)-1])
+	}
+}
+
+// TestLintFiles ensures that each fragment, manifest and Terraform state is
+// linted separately, and that problems after the first are still reported with
+// their line.
+func TestLintFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), `---
+global:
+  port: 0
+  refresh_interval: 1s
+  cloud_controller_url: http://api.fr.cloud.gov
+terraform_states:
+  - terraform.tfstate
+apps:
+  enabled: true
+  manifests:
+    - path: manifest.yml
+  resources:
+    - name: web
+      memroy: 64M
+    - name: "web-["
+      match: glob`)
+	writeTestFile(t, filepath.Join(dir, "more.yaml"), "apps:\n  resources:\n    - name: worker\n      memory: 64K\n    - name: web")
+	writeTestFile(t, filepath.Join(dir, "manifest.yml"), "---\napplications:\n- name: api\n- name: db\n  routes:\n    - route: localhost")
+	writeTestFile(t, filepath.Join(dir, "terraform.tfstate"), `{"resources": [{"mode": "managed", "type": "cloudfoundry_app",
+  "instances": [{"attributes": {"name": "api"}}]}]}`)
+
+	expected := []string{
+		filepath.Join(dir, "config.yaml") + `:3: port 0 is reserved and cannot be used`,
+		filepath.Join(dir, "config.yaml") + `:4: Refresh interval cannot be less than 10s`,
+		filepath.Join(dir, "config.yaml") + `:5: unsupported scheme in cloud controller URL`,
+		filepath.Join(dir, "config.yaml") + `:14: apps.resources[0].memroy: unknown key`,
+		filepath.Join(dir, "config.yaml") + `:15: invalid glob pattern "web-[": syntax error in pattern`,
+		filepath.Join(dir, "manifest.yml") + `:4: route "localhost" of application "db" must be of the form <hostname>.<domain>`,
+		filepath.Join(dir, "more.yaml") + `:3: invalid memory for app "worker": memory "64K" must have a unit of M, MB, G, GB, T or TB`,
+		filepath.Join(dir, "more.yaml") + `:5: duplicate app "web" (first defined in ` + filepath.Join(dir, "config.yaml") + `:13)`,
+		filepath.Join(dir, "terraform.tfstate") + `: duplicate app "api" (first defined in ` + filepath.Join(dir, "manifest.yml") + `:3)`,
+	}
+
+	problems := Lint(dir)
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems. Found: %+v", len(expected), problems)
+	}
+	for i, problem := range problems {
+		if problem.String() != expected[i] {
+			t.Fatalf("Problem %d incorrect.\nFound:    %s\nExpected: %s", i, problem, expected[i])
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// manifestVarPattern matches ((var)) placeholders in CF manifests
+var manifestVarPattern = regexp.MustCompile(`\(\(([^()\s]+)\)\)`)
+
+// cfManifest represents the parts of a CF application manifest used by Watchtower
+type cfManifest struct {
+	Applications []cfManifestApp `yaml:"applications"`
+}
+
+// cfManifestApp represents the parts of a single application in a CF manifest used by Watchtower
+type cfManifestApp struct {
+	Name                    string          `yaml:"name"`
+	Instances               int             `yaml:"instances"`
+	Memory                  string          `yaml:"memory"`
+	Buildpack               string          `yaml:"buildpack"`
+	Buildpacks              []string        `yaml:"buildpacks"`
+	Routes                  []cfRoute       `yaml:"routes"`
+	Services                []cfServiceName `yaml:"services"`
+	HealthCheckType         string          `yaml:"health-check-type"`
+	HealthCheckHTTPEndpoint string          `yaml:"health-check-http-endpoint"`
+	NoRoute                 bool            `yaml:"no-route"`
+	RandomRoute             bool            `yaml:"random-route"`
+}
+
+// cfRoute represents an entry under 'routes' in a CF manifest
+type cfRoute struct {
+	Route string `yaml:"route"`
+}
+
+// cfServiceName represents an entry under 'services' in a CF manifest, which is
+// either the name of a service instance or a map containing the name.
+type cfServiceName string
+
+// UnmarshalYAML implements yaml.Unmarshaler for both forms of manifest services
+func (s *cfServiceName) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*s = cfServiceName(name)
+		return nil
+	}
+
+	var service struct {
+		Name string `yaml:"name"`
+	}
+	if err := unmarshal(&service); err != nil {
+		return err
+	}
+	*s = cfServiceName(service.Name)
+	return nil
+}
+
+// resolvePath resolves a relative path against baseDir
+func resolvePath(baseDir, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(baseDir, path)
+}
+
+// resolve returns the paths of the manifest and vars files of the
+// ManifestSource, resolving relative paths against baseDir
+func (s *ManifestSource) resolve(baseDir string) (string, []string) {
+	var varsFiles []string
+	for _, varsFile := range s.VarsFiles {
+		varsFiles = append(varsFiles, resolvePath(baseDir, varsFile))
+	}
+	return resolvePath(baseDir, s.Path), varsFiles
+}
+
+// loadManifestVars reads the vars files of a ManifestSource in order, followed
+// by its inline vars. Later values take precedence over earlier ones.
+func loadManifestVars(varsFiles []string, inlineVars map[string]string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, filename := range varsFiles {
+		data, err := os.ReadFile(filepath.Clean(filename))
+		if err != nil {
+			return nil, err
+		}
+
+		var fileVars map[string]interface{}
+		if err := yaml.Unmarshal(data, &fileVars); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		for key, value := range fileVars {
+			vars[key] = fmt.Sprint(value)
+		}
+	}
+
+	for key, value := range inlineVars {
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// interpolateManifest replaces each ((var)) placeholder in the values of the
+// decoded manifest node with its value, as the CF CLI does, so that values
+// containing YAML syntax cannot change the structure of the manifest. A value
+// that is only a placeholder takes the type of its value, such as a number for
+// 'instances'; placeholders within other text are replaced as text. Placeholders
+// without a value are reported as errors.
+func interpolateManifest(node *yamlv3.Node, vars map[string]string) error {
+	var missing []string
+	var interpolate func(node *yamlv3.Node)
+	interpolate = func(node *yamlv3.Node) {
+		switch node.Kind {
+		case yamlv3.DocumentNode, yamlv3.SequenceNode:
+			for _, child := range node.Content {
+				interpolate(child)
+			}
+			return
+		case yamlv3.MappingNode:
+			for i := 1; i < len(node.Content); i += 2 {
+				interpolate(node.Content[i])
+			}
+			return
+		case yamlv3.ScalarNode:
+		default:
+			return
+		}
+
+		if match := manifestVarPattern.FindStringSubmatch(node.Value); match != nil && match[0] == node.Value {
+			value, ok := vars[match[1]]
+			if !ok {
+				missing = append(missing, match[1])
+				return
+			}
+			node.Value, node.Tag, node.Style = value, manifestValueTag(value), 0
+			return
+		}
+
+		found := false
+		node.Value = manifestVarPattern.ReplaceAllStringFunc(node.Value, func(placeholder string) string {
+			found = true
+			name := manifestVarPattern.FindStringSubmatch(placeholder)[1]
+			value, ok := vars[name]
+			if !ok {
+				missing = append(missing, name)
+				return placeholder
+			}
+			return value
+		})
+		if found {
+			node.Tag = "!!str"
+		}
+	}
+	interpolate(node)
+
+	if len(missing) != 0 {
+		return fmt.Errorf("no value provided for manifest vars: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// manifestValueTag returns the YAML tag of a manifest var value substituted for a
+// whole value: booleans and numbers keep their type, everything else is a string
+func manifestValueTag(value string) string {
+	switch tag := (&yamlv3.Node{Kind: yamlv3.ScalarNode, Value: value}).ShortTag(); tag {
+	case "!!bool", "!!int", "!!float":
+		return tag
+	default:
+		return "!!str"
+	}
+}
+
+// manifestRoute converts a CF manifest route into a RouteEntry. Paths are not
+// part of a RouteEntry and are dropped. TCP routes are not supported.
+func manifestRoute(route string) (RouteEntry, bool) {
+	route, _, _ = strings.Cut(route, "/")
+	if route == "" || strings.Contains(route, ":") {
+		return "", false
+	}
+	return RouteEntry(route), true
+}
+
+// toAppEntry converts an application in a CF manifest into an AppEntry. An
+// application without routes is given the route CF maps by default on
+// defaultDomain, unless it has no-route set or defaultDomain is empty.
+func (app *cfManifestApp) toAppEntry(defaultDomain string) (AppEntry, error) {
+	entry := AppEntry{
+		Name:                    app.Name,
+		Instances:               app.Instances,
+		Memory:                  app.Memory,
+		Buildpacks:              app.Buildpacks,
+		HealthCheckType:         app.HealthCheckType,
+		HealthCheckHTTPEndpoint: app.HealthCheckHTTPEndpoint,
+	}
+
+	// 'buildpack' is the deprecated, single-buildpack form of 'buildpacks'
+	if len(entry.Buildpacks) == 0 && app.Buildpack != "" {
+		entry.Buildpacks = []string{app.Buildpack}
+	}
+
+	for _, route := range app.Routes {
+		routeEntry, ok := manifestRoute(route.Route)
+		if !ok || slices.Contains(entry.Routes, routeEntry) {
+			continue
+		}
+		if !strings.Contains(string(routeEntry), ".") {
+			return AppEntry{}, fmt.Errorf("route %q of application %q must be of the form <hostname>.<domain>", route.Route, app.Name)
+		}
+		entry.Routes = append(entry.Routes, routeEntry)
+	}
+
+	// CF maps a default route, or with random-route a route with a random
+	// hostname starting with the app name, to apps pushed without routes
+	if len(app.Routes) == 0 && !app.NoRoute && defaultDomain != "" {
+		if app.RandomRoute {
+			entry.RoutePatterns = []RouteEntry{RouteEntry(app.Name + "-*." + defaultDomain)}
+		} else {
+			entry.Routes = []RouteEntry{RouteEntry(app.Name + "." + defaultDomain)}
+		}
+	}
+
+	for _, service := range app.Services {
+		entry.Services = append(entry.Services, string(service))
+	}
+
+	return entry, nil
+}
+
+// parseManifest reads a CF application manifest, interpolating its ((var))
+// placeholders.
+func parseManifest(manifestPath string, vars map[string]string) (cfManifest, error) {
+	data, err := os.ReadFile(filepath.Clean(manifestPath))
+	if err != nil {
+		return cfManifest{}, err
+	}
+
+	var root yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &root); err != nil {
+		return cfManifest{}, fmt.Errorf("%s: %w", manifestPath, err)
+	}
+	if err := interpolateManifest(&root, vars); err != nil {
+		return cfManifest{}, fmt.Errorf("%s: %w", manifestPath, err)
+	}
+
+	var manifest cfManifest
+	if err := root.Decode(&manifest); err != nil {
+		return cfManifest{}, fmt.Errorf("%s: %w", manifestPath, err)
+	}
+	return manifest, nil
+}
+
+// manifestAppEntry converts application i of a CF manifest into an AppEntry
+func (m *cfManifest) manifestAppEntry(i int, defaultDomain string) (AppEntry, error) {
+	if m.Applications[i].Name == "" {
+		return AppEntry{}, fmt.Errorf("application %d has no name", i)
+	}
+	return m.Applications[i].toAppEntry(defaultDomain)
+}
+
+// loadManifest reads a CF application manifest, interpolating its ((var))
+// placeholders, and returns its applications as a config fragment. Apps without
+// routes are given their default route on defaultDomain.
+func loadManifest(manifestPath string, vars map[string]string, defaultDomain string) (fragmentConfig, error) {
+	manifest, err := parseManifest(manifestPath, vars)
+	if err != nil {
+		return fragmentConfig{}, err
+	}
+
+	var fragment fragmentConfig
+	for i := range manifest.Applications {
+		entry, err := manifest.manifestAppEntry(i, defaultDomain)
+		if err != nil {
+			return fragmentConfig{}, fmt.Errorf("%s: %w", manifestPath, err)
+		}
+		fragment.AppConfig.Apps = append(fragment.AppConfig.Apps, entry)
+	}
+	return fragment, nil
+}
+
+// loadManifests loads each CF manifest listed under 'apps:manifests'. Relative
+// paths are resolved against baseDir. The loaded manifests are returned along
+// with the paths of every manifest and vars file that was read.
+func loadManifests(baseDir string, sources []ManifestSource) ([]loadedFragment, []string, error) {
+	var fragments []loadedFragment
+	var files []string
+	var errs []error
+
+	for _, source := range sources {
+		manifestPath, varsFiles := source.resolve(baseDir)
+		files = append(append(files, manifestPath), varsFiles...)
+
+		vars, err := loadManifestVars(varsFiles, source.Vars)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		fragment, err := loadManifest(manifestPath, vars, source.DefaultDomain)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fragments = append(fragments, loadedFragment{source: manifestPath, config: fragment})
+	}
+
+	return fragments, files, errors.Join(errs...)
+}
+
+// memoryUnits maps the memory units accepted by CF to their size in megabytes
+var memoryUnits = map[string]int{
+	"M": 1, "MB": 1,
+	"G": 1024, "GB": 1024,
+	"T": 1024 * 1024, "TB": 1024 * 1024,
+}
+
+// parseMemoryMB parses a CF memory limit such as "64M" or "1G" into megabytes.
+// An empty limit is parsed as 0.
+func parseMemoryMB(memory string) (int, error) {
+	memory = strings.ToUpper(strings.TrimSpace(memory))
+	if memory == "" {
+		return 0, nil
+	}
+
+	number := strings.TrimRight(memory, "BGMT")
+	multiplier, ok := memoryUnits[memory[len(number):]]
+	if !ok {
+		return 0, fmt.Errorf("memory %q must have a unit of M, MB, G, GB, T or TB", memory)
+	}
+
+	value, err := strconv.Atoi(number)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("memory %q must be a positive whole number", memory)
+	}
+	return value * multiplier, nil
+}
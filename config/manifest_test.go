@@ -0,0 +1,196 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const manifestMainConfig = `---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+apps:
+  enabled: true
+  manifests:
+    - path: manifest.yml
+      vars_files:
+        - vars.yml
+      vars:
+        instances: 3
+  resources:
+    - name: other-app`
+
+const testManifest = `---
+applications:
+- name: ((app_name))
+  instances: ((instances))
+  memory: 64M
+  buildpacks:
+    - go_buildpack
+  routes:
+    - route: ((app_name)).app.cloud.gov
+    - route: ((app_name)).app.cloud.gov/api
+    - route: tcp.app.cloud.gov:1234
+  services:
+    - my-db
+    - name: my-s3
+      parameters:
+        key: value
+  health-check-type: http
+  health-check-http-endpoint: /health
+- name: legacy-app
+  buildpack: python_buildpack`
+
+// TestLoadManifest ensures that CF manifests are imported as app entries.
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), manifestMainConfig)
+	writeTestFile(t, filepath.Join(dir, "manifest.yml"), testManifest)
+	writeTestFile(t, filepath.Join(dir, "vars.yml"), "app_name: my-app\ninstances: 1")
+
+	conf, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	app, ok := conf.Apps["my-app"]
+	if !ok {
+		t.Fatalf("Manifest app was not imported. Found: %+v", conf.Apps)
+	}
+	if app.Instances != 3 {
+		t.Fatalf("Inline vars did not take precedence over vars files. Found: %d", app.Instances)
+	}
+	if app.MemoryMB() != 64 {
+		t.Fatalf("Manifest memory incorrect. Found: %s", app.Memory)
+	}
+	if len(app.Buildpacks) != 1 || app.Buildpacks[0] != "go_buildpack" {
+		t.Fatalf("Manifest buildpacks incorrect. Found: %+v", app.Buildpacks)
+	}
+	if len(app.Routes) != 1 || app.Routes[0] != "my-app.app.cloud.gov" {
+		t.Fatalf("Manifest routes incorrect. Found: %+v", app.Routes)
+	}
+	if len(app.Services) != 2 || app.Services[0] != "my-db" || app.Services[1] != "my-s3" {
+		t.Fatalf("Manifest services incorrect. Found: %+v", app.Services)
+	}
+	if app.HealthCheckType != "http" || app.HealthCheckHTTPEndpoint != "/health" {
+		t.Fatalf("Manifest health check incorrect. Found: %+v", app)
+	}
+
+	if legacy := conf.Apps["legacy-app"]; len(legacy.Buildpacks) != 1 || legacy.Buildpacks[0] != "python_buildpack" {
+		t.Fatalf("Deprecated manifest buildpack incorrect. Found: %+v", legacy.Buildpacks)
+	}
+	if len(conf.Sources) != 3 {
+		t.Fatalf("Manifest and vars files were not recorded as sources. Found: %+v", conf.Sources)
+	}
+}
+
+// TestManifestMissingVar ensures that manifest vars without a value are load errors.
+func TestManifestMissingVar(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), manifestMainConfig)
+	writeTestFile(t, filepath.Join(dir, "manifest.yml"), testManifest)
+	writeTestFile(t, filepath.Join(dir, "vars.yml"), "instances: 1")
+
+	if _, err := Load(filepath.Join(dir, "config.yaml")); err == nil {
+		t.Fatal("Manifest with missing vars loaded without erroring")
+	}
+}
+
+// TestManifestVarSyntax ensures that manifest var values containing YAML syntax
+// are substituted as values, without changing the structure of the manifest.
+func TestManifestVarSyntax(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), manifestMainConfig)
+	writeTestFile(t, filepath.Join(dir, "manifest.yml"), `---
+applications:
+- name: ((app_name))
+  instances: ((instances))
+  health-check-http-endpoint: ((endpoint))
+  buildpacks:
+    - ((buildpack))`)
+	writeTestFile(t, filepath.Join(dir, "vars.yml"), `app_name: my-app
+endpoint: "/health # status: ok\ninstances: 9"
+buildpack: '"go": [1]'`)
+
+	conf, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+	app, ok := conf.Apps["my-app"]
+	if !ok || app.Instances != 3 || app.HealthCheckHTTPEndpoint != "/health # status: ok\ninstances: 9" ||
+		len(app.Buildpacks) != 1 || app.Buildpacks[0] != `"go": [1]` {
+		t.Fatalf("Manifest vars were not substituted as values. Found: %+v", conf.Apps)
+	}
+}
+
+// TestManifestDuplicateApp ensures that apps defined in both a manifest and the config are load errors.
+func TestManifestDuplicateApp(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), manifestMainConfig)
+	writeTestFile(t, filepath.Join(dir, "manifest.yml"), testManifest)
+	writeTestFile(t, filepath.Join(dir, "vars.yml"), "app_name: other-app")
+
+	if _, err := Load(filepath.Join(dir, "config.yaml")); err == nil {
+		t.Fatal("Duplicate manifest app loaded without erroring")
+	}
+}
+
+// TestParseMemory tests parsing of CF memory limits.
+func TestParseMemory(t *testing.T) {
+	valid := map[string]int{"": 0, "64M": 64, "256mb": 256, "1G": 1024, "2GB": 2048}
+	for memory, expected := range valid {
+		if megabytes, err := parseMemoryMB(memory); err != nil || megabytes != expected {
+			t.Fatalf("Memory %q parsed as %d (error: %v). Expected: %d", memory, megabytes, err, expected)
+		}
+	}
+
+	for _, memory := range []string{"64", "M", "-1G", "1.5G", "64K"} {
+		if _, err := parseMemoryMB(memory); err == nil {
+			t.Fatalf("Invalid memory %q parsed without erroring", memory)
+		}
+	}
+}
+
+// TestManifestRoutes ensures that routes without a domain are load errors, and
+// that apps without routes are given their default route.
+func TestManifestRoutes(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), `---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+apps:
+  enabled: true
+  manifests:
+    - path: manifest.yml
+      default_domain: app.cloud.gov`)
+	writeTestFile(t, filepath.Join(dir, "manifest.yml"), `---
+applications:
+- name: default
+- name: random
+  random-route: true
+- name: internal
+  no-route: true`)
+
+	conf, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+	if app := conf.Apps["default"]; len(app.Routes) != 1 || app.Routes[0] != "default.app.cloud.gov" {
+		t.Fatalf("Default route incorrect. Found: %+v", app.Routes)
+	}
+	if app := conf.Apps["random"]; len(app.Routes) != 0 || !app.ContainsRoute("random-quiet-otter-xy.app.cloud.gov") {
+		t.Fatalf("Random route incorrect. Found: %+v", app)
+	}
+	if app := conf.Apps["internal"]; len(app.Routes) != 0 || len(app.RoutePatterns) != 0 {
+		t.Fatalf("App with no-route was given a route. Found: %+v", app)
+	}
+
+	writeTestFile(t, filepath.Join(dir, "manifest.yml"), "---\napplications:\n- name: web\n  routes:\n    - route: localhost")
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), `route "localhost" of application "web"`) {
+		t.Fatalf("Route without a domain was not reported. Found: %v", err)
+	}
+}
@@ -0,0 +1,496 @@
+package config
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// redacted replaces secret values when a config is marshalled
+const redacted = "<redacted>"
+
+// Defaults for HTTP deliveries
+const (
+	defaultHTTPRetries = 3
+	defaultHTTPBackoff = time.Second
+	defaultHTTPTimeout = 10 * time.Second
+)
+
+// Defaults for email digests
+const (
+	defaultSMTPPort    = 587
+	defaultDigestTime  = "08:00"
+	defaultDigestTitle = "Watchtower drift digest"
+	digestTimeFormat   = "15:04"
+)
+
+// Defaults for Slack rate limiting
+const (
+	defaultSlackMaxMessages = 10
+	defaultSlackRatePeriod  = time.Hour
+)
+
+// NotificationsConfig represents allowed values under the 'notifications' key
+type NotificationsConfig struct {
+	Webhooks    []WebhookConfig     `yaml:"webhooks,omitempty" doc:"Webhooks that are sent a POST request when drift is detected or resolved"`
+	Slack       []SlackConfig       `yaml:"slack,omitempty" doc:"Slack incoming webhooks that are sent a message for each group of similar drift events"`
+	Email       []EmailConfig       `yaml:"email,omitempty" doc:"Recipients of a daily email digest of the open drift findings"`
+	Syslog      []SyslogConfig      `yaml:"syslog,omitempty" doc:"Syslog servers that are sent an RFC 5424 message with a CEF payload for each drift event"`
+	CloudEvents []CloudEventsConfig `yaml:"cloudevents,omitempty" doc:"HTTP endpoints that are sent a CloudEvent for each drift event"`
+}
+
+// WebhookConfig represents allowed values under the 'notifications:webhooks' key
+type WebhookConfig struct {
+	Name         string            `yaml:"name" doc:"Name of the webhook, used in logs and metrics"`
+	URL          string            `yaml:"url" doc:"URL the webhook requests are sent to"`
+	Headers      map[string]string `yaml:"headers,omitempty" doc:"Headers added to every webhook request"`
+	Secret       string            `yaml:"secret,omitempty" doc:"Secret used to sign requests with HMAC-SHA256 in the X-Watchtower-Signature header"`
+	ContentType  string            `yaml:"content_type,omitempty" doc:"Content type of the request body. Defaults to application/json"`
+	Template     string            `yaml:"template,omitempty" doc:"Go text/template rendering the request body from each event. Defaults to the event as JSON"`
+	HTTPDelivery `yaml:",inline"`
+
+	template *template.Template
+}
+
+// HTTPDelivery represents the delivery settings shared by notifiers that send
+// HTTP requests
+type HTTPDelivery struct {
+	MaxRetries   *int          `yaml:"max_retries,omitempty" doc:"Number of times a failed request is retried. Defaults to 3"`
+	RetryBackoff time.Duration `yaml:"retry_backoff,omitempty" doc:"Delay before the first retry, doubled for each later retry. Defaults to 1s"`
+	Timeout      time.Duration `yaml:"timeout,omitempty" doc:"Timeout of each request. Defaults to 10s"`
+}
+
+// templateFuncs are the functions available to webhook templates, in addition
+// to the text/template builtins.
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// BodyTemplate returns the parsed body template of the webhook, or nil if the
+// webhook has no template.
+func (w *WebhookConfig) BodyTemplate() *template.Template {
+	return w.template
+}
+
+// Retries returns the number of times a failed request is retried
+func (d *HTTPDelivery) Retries() int {
+	if d.MaxRetries == nil {
+		return defaultHTTPRetries
+	}
+	return *d.MaxRetries
+}
+
+// Backoff returns the delay before the first retry of a failed request
+func (d *HTTPDelivery) Backoff() time.Duration {
+	if d.RetryBackoff == 0 {
+		return defaultHTTPBackoff
+	}
+	return d.RetryBackoff
+}
+
+// RequestTimeout returns the timeout of each request
+func (d *HTTPDelivery) RequestTimeout() time.Duration {
+	if d.Timeout == 0 {
+		return defaultHTTPTimeout
+	}
+	return d.Timeout
+}
+
+// validate returns an error if the delivery settings are negative
+func (d *HTTPDelivery) validate() error {
+	if d.MaxRetries != nil && *d.MaxRetries < 0 {
+		return errors.New("max_retries cannot be negative")
+	}
+	if d.RetryBackoff < 0 || d.Timeout < 0 {
+		return errors.New("durations cannot be negative")
+	}
+	return nil
+}
+
+// redactHeaders returns a copy of headers with their values redacted
+func redactHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	out := make(map[string]string, len(headers))
+	for name := range headers {
+		out[name] = redacted
+	}
+	return out
+}
+
+// MarshalYAML redacts the secret and header values of the webhook, so that
+// they are not served by the /config endpoint.
+func (w WebhookConfig) MarshalYAML() (interface{}, error) {
+	type plain WebhookConfig
+	out := plain(w)
+	if out.Secret != "" {
+		out.Secret = redacted
+	}
+	out.Headers = redactHeaders(w.Headers)
+	return out, nil
+}
+
+// compile validates the webhook and parses its body template
+func (w *WebhookConfig) compile() error {
+	if w.Name == "" {
+		return fmt.Errorf("webhook %q must have a name", w.URL)
+	}
+	webhookURL, err := url.ParseRequestURI(w.URL)
+	if err != nil || (webhookURL.Scheme != "https" && webhookURL.Scheme != "http") {
+		return fmt.Errorf("webhook %q must have an http or https url", w.Name)
+	}
+	if err := w.HTTPDelivery.validate(); err != nil {
+		return fmt.Errorf("webhook %q %w", w.Name, err)
+	}
+
+	if w.Template != "" {
+		tmpl, err := template.New(w.Name).Funcs(templateFuncs).Parse(w.Template)
+		if err != nil {
+			return fmt.Errorf("webhook %q template: %w", w.Name, err)
+		}
+		w.template = tmpl
+	}
+	return nil
+}
+
+// CloudEventsConfig represents allowed values under the 'notifications:cloudevents' key
+type CloudEventsConfig struct {
+	Name         string            `yaml:"name" doc:"Name of the CloudEvents sink, used in logs and metrics"`
+	URL          string            `yaml:"url" doc:"URL the CloudEvents are sent to, e.g. a Knative broker"`
+	Mode         string            `yaml:"mode,omitempty" doc:"HTTP content mode of the CloudEvents. Defaults to structured" enum:"structured,binary"`
+	Source       string            `yaml:"source,omitempty" doc:"Source attribute of the CloudEvents. Defaults to the Cloud Controller URL"`
+	Headers      map[string]string `yaml:"headers,omitempty" doc:"Headers added to every request"`
+	HTTPDelivery `yaml:",inline"`
+}
+
+// BinaryMode returns true if CloudEvents are sent in binary content mode
+func (c *CloudEventsConfig) BinaryMode() bool {
+	return c.Mode == "binary"
+}
+
+// MarshalYAML redacts the header values of the CloudEvents sink
+func (c CloudEventsConfig) MarshalYAML() (interface{}, error) {
+	type plain CloudEventsConfig
+	out := plain(c)
+	out.Headers = redactHeaders(c.Headers)
+	return out, nil
+}
+
+// compile validates the CloudEvents sink
+func (c *CloudEventsConfig) compile() error {
+	if c.Name == "" {
+		return fmt.Errorf("cloudevents sink %q must have a name", c.URL)
+	}
+	sinkURL, err := url.ParseRequestURI(c.URL)
+	if err != nil || (sinkURL.Scheme != "https" && sinkURL.Scheme != "http") {
+		return fmt.Errorf("cloudevents sink %q must have an http or https url", c.Name)
+	}
+	if c.Source != "" {
+		if _, err := url.Parse(c.Source); err != nil {
+			return fmt.Errorf("cloudevents sink %q source must be a URI reference: %w", c.Name, err)
+		}
+	}
+	if err := c.HTTPDelivery.validate(); err != nil {
+		return fmt.Errorf("cloudevents sink %q %w", c.Name, err)
+	}
+	return nil
+}
+
+// SlackConfig represents allowed values under the 'notifications:slack' key
+type SlackConfig struct {
+	Name            string        `yaml:"name" doc:"Name of the Slack notifier, used in logs and metrics"`
+	WebhookURL      string        `yaml:"webhook_url" doc:"URL of the Slack incoming webhook"`
+	WatchtowerURL   string        `yaml:"watchtower_url,omitempty" doc:"External URL of Watchtower, used to link messages to findings in /drift"`
+	MaxMessages     int           `yaml:"max_messages,omitempty" doc:"Maximum number of messages sent per rate_limit_period. Defaults to 10"`
+	RateLimitPeriod time.Duration `yaml:"rate_limit_period,omitempty" doc:"Period over which max_messages is enforced. Defaults to 1h"`
+}
+
+// MessageLimit returns the maximum number of messages sent per RatePeriod
+func (s *SlackConfig) MessageLimit() int {
+	if s.MaxMessages == 0 {
+		return defaultSlackMaxMessages
+	}
+	return s.MaxMessages
+}
+
+// RatePeriod returns the period over which MessageLimit is enforced
+func (s *SlackConfig) RatePeriod() time.Duration {
+	if s.RateLimitPeriod == 0 {
+		return defaultSlackRatePeriod
+	}
+	return s.RateLimitPeriod
+}
+
+// MarshalYAML redacts the webhook URL, which contains the credentials of the
+// Slack incoming webhook.
+func (s SlackConfig) MarshalYAML() (interface{}, error) {
+	type plain SlackConfig
+	out := plain(s)
+	if out.WebhookURL != "" {
+		out.WebhookURL = redacted
+	}
+	return out, nil
+}
+
+// compile validates the Slack notifier
+func (s *SlackConfig) compile() error {
+	if s.Name == "" {
+		return errors.New("slack notifiers must have a name")
+	}
+	if webhookURL, err := url.ParseRequestURI(s.WebhookURL); err != nil || webhookURL.Scheme != "https" {
+		return fmt.Errorf("slack notifier %q must have an https webhook_url", s.Name)
+	}
+	if s.WatchtowerURL != "" {
+		if watchtowerURL, err := url.ParseRequestURI(s.WatchtowerURL); err != nil || !watchtowerURL.IsAbs() {
+			return fmt.Errorf("slack notifier %q watchtower_url must be an absolute URL", s.Name)
+		}
+	}
+	if s.MaxMessages < 0 || s.RateLimitPeriod < 0 {
+		return fmt.Errorf("slack notifier %q rate limit cannot be negative", s.Name)
+	}
+	return nil
+}
+
+// EmailConfig represents allowed values under the 'notifications:email' key
+type EmailConfig struct {
+	Name     string   `yaml:"name" doc:"Name of the email digest, used in logs and metrics"`
+	Host     string   `yaml:"host" doc:"Host name of the SMTP server"`
+	Port     uint16   `yaml:"port,omitempty" doc:"Port of the SMTP server. Defaults to 587"`
+	StartTLS *bool    `yaml:"starttls,omitempty" doc:"Whether to require STARTTLS before authenticating and sending. Defaults to true"`
+	Username string   `yaml:"username,omitempty" doc:"Username for SMTP PLAIN authentication. Authentication is skipped if not set"`
+	Password string   `yaml:"password,omitempty" doc:"Password for SMTP PLAIN authentication"`
+	From     string   `yaml:"from" doc:"Sender address of the digest"`
+	To       []string `yaml:"to" doc:"Recipient addresses of the digest"`
+	Subject  string   `yaml:"subject,omitempty" doc:"Subject of the digest. Defaults to Watchtower drift digest"`
+	SendAt   string   `yaml:"send_at,omitempty" doc:"Time of day the digest is sent, as HH:MM. Defaults to 08:00"`
+	TimeZone string   `yaml:"time_zone,omitempty" doc:"IANA time zone of send_at, e.g. America/New_York. Defaults to UTC"`
+
+	sendAt   time.Time // Time of day of SendAt
+	location *time.Location
+}
+
+// Address returns the host:port address of the SMTP server
+func (e *EmailConfig) Address() string {
+	port := e.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	return net.JoinHostPort(e.Host, strconv.Itoa(int(port)))
+}
+
+// UseStartTLS returns true if STARTTLS is required
+func (e *EmailConfig) UseStartTLS() bool {
+	return e.StartTLS == nil || *e.StartTLS
+}
+
+// DigestSubject returns the subject of the digest
+func (e *EmailConfig) DigestSubject() string {
+	if e.Subject == "" {
+		return defaultDigestTitle
+	}
+	return e.Subject
+}
+
+// Location returns the time zone of the digest schedule
+func (e *EmailConfig) Location() *time.Location {
+	if e.location == nil {
+		return time.UTC
+	}
+	return e.location
+}
+
+// NextDigest returns the first time the digest is due after the given time
+func (e *EmailConfig) NextDigest(after time.Time) time.Time {
+	location := e.Location()
+	local := after.In(location)
+	next := time.Date(local.Year(), local.Month(), local.Day(), e.sendAt.Hour(), e.sendAt.Minute(), 0, 0, location)
+	for !next.After(after) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// MarshalYAML redacts the SMTP password
+func (e EmailConfig) MarshalYAML() (interface{}, error) {
+	type plain EmailConfig
+	out := plain(e)
+	if out.Password != "" {
+		out.Password = redacted
+	}
+	return out, nil
+}
+
+// compile validates the email digest and parses its schedule
+func (e *EmailConfig) compile() error {
+	if e.Name == "" {
+		return errors.New("email digests must have a name")
+	}
+	if e.Host == "" || e.From == "" || len(e.To) == 0 {
+		return fmt.Errorf("email digest %q must have a host, from and to addresses", e.Name)
+	}
+	for _, address := range append([]string{e.From}, e.To...) {
+		if _, err := mail.ParseAddress(address); err != nil {
+			return fmt.Errorf("email digest %q address %q: %w", e.Name, address, err)
+		}
+	}
+	if e.Password != "" && e.Username == "" {
+		return fmt.Errorf("email digest %q has a password but no username", e.Name)
+	}
+
+	sendAt := e.SendAt
+	if sendAt == "" {
+		sendAt = defaultDigestTime
+	}
+	var err error
+	if e.sendAt, err = time.Parse(digestTimeFormat, sendAt); err != nil {
+		return fmt.Errorf("email digest %q send_at must be a time of day as HH:MM", e.Name)
+	}
+
+	e.location = time.UTC
+	if e.TimeZone != "" {
+		if e.location, err = time.LoadLocation(e.TimeZone); err != nil {
+			return fmt.Errorf("email digest %q time_zone: %w", e.Name, err)
+		}
+	}
+	return nil
+}
+
+// syslogFacilities are the syslog facility names, in facility code order
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp", "cron", "authpriv", "ftp",
+	"ntp", "audit", "alert", "clock", "local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// SyslogConfig represents allowed values under the 'notifications:syslog' key
+type SyslogConfig struct {
+	Name     string `yaml:"name" doc:"Name of the syslog output, used in logs and metrics"`
+	Address  string `yaml:"address" doc:"host:port address of the syslog server"`
+	Protocol string `yaml:"protocol,omitempty" doc:"Transport used to send messages. Defaults to udp" enum:"udp,tcp,tls"`
+	CAFile   string `yaml:"ca_file,omitempty" doc:"PEM file of the CA certificates trusted for tls. Defaults to the system roots"`
+	Facility string `yaml:"facility,omitempty" doc:"Syslog facility of the messages. Defaults to local0" enum:"kern,user,mail,daemon,auth,syslog,lpr,news,uucp,cron,authpriv,ftp,ntp,audit,alert,clock,local0,local1,local2,local3,local4,local5,local6,local7"`
+	Hostname string `yaml:"hostname,omitempty" doc:"Hostname sent in messages. Defaults to the hostname of the machine"`
+	AppName  string `yaml:"app_name,omitempty" doc:"App name sent in messages. Defaults to watchtower"`
+
+	rootCAs *x509.CertPool
+}
+
+// Transport returns the transport used to send messages: udp, tcp or tls
+func (s *SyslogConfig) Transport() string {
+	if s.Protocol == "" {
+		return "udp"
+	}
+	return s.Protocol
+}
+
+// FacilityCode returns the numeric code of the syslog facility
+func (s *SyslogConfig) FacilityCode() int {
+	if s.Facility == "" {
+		return slices.Index(syslogFacilities, "local0")
+	}
+	return slices.Index(syslogFacilities, s.Facility)
+}
+
+// RootCAs returns the CA certificates trusted for tls, or nil to use the system roots
+func (s *SyslogConfig) RootCAs() *x509.CertPool {
+	return s.rootCAs
+}
+
+// isSyslogName returns true if name can be sent as a syslog HOSTNAME or
+// APP-NAME, which are limited to printable ASCII without spaces.
+func isSyslogName(name string, maxLength int) bool {
+	if len(name) > maxLength {
+		return false
+	}
+	for _, c := range name {
+		if c < 33 || c > 126 {
+			return false
+		}
+	}
+	return true
+}
+
+// compile validates the syslog output and loads its CA certificates
+func (s *SyslogConfig) compile() error {
+	if s.Name == "" {
+		return errors.New("syslog outputs must have a name")
+	}
+	if _, _, err := net.SplitHostPort(s.Address); err != nil {
+		return fmt.Errorf("syslog output %q address must be host:port: %w", s.Name, err)
+	}
+	if s.FacilityCode() == -1 {
+		return fmt.Errorf("syslog output %q has unknown facility %q", s.Name, s.Facility)
+	}
+	if !isSyslogName(s.Hostname, 255) || !isSyslogName(s.AppName, 48) {
+		return fmt.Errorf("syslog output %q hostname and app_name must be printable ASCII without spaces", s.Name)
+	}
+
+	if s.CAFile != "" {
+		if s.Transport() != "tls" {
+			return fmt.Errorf("syslog output %q ca_file requires the tls protocol", s.Name)
+		}
+		pem, err := os.ReadFile(s.CAFile)
+		if err != nil {
+			return fmt.Errorf("syslog output %q: %w", s.Name, err)
+		}
+		s.rootCAs = x509.NewCertPool()
+		if !s.rootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("syslog output %q ca_file contains no PEM certificates", s.Name)
+		}
+	}
+	return nil
+}
+
+// notifier is the config of a single notifier
+type notifier interface {
+	compile() error
+}
+
+// compileNotifiers compiles the notifiers of one type, whose names must be unique
+func compileNotifiers[T any, P interface {
+	*T
+	notifier
+}](description string, notifiers []T, name func(*T) string) error {
+	names := make(map[string]bool)
+	for i := range notifiers {
+		if err := P(&notifiers[i]).compile(); err != nil {
+			return err
+		}
+		if names[name(&notifiers[i])] {
+			return fmt.Errorf("%s %q is defined more than once", description, name(&notifiers[i]))
+		}
+		names[name(&notifiers[i])] = true
+	}
+	return nil
+}
+
+// compile validates the notification settings
+func (n *NotificationsConfig) compile() error {
+	if err := compileNotifiers("webhook", n.Webhooks, func(w *WebhookConfig) string { return w.Name }); err != nil {
+		return err
+	}
+	if err := compileNotifiers("slack notifier", n.Slack, func(s *SlackConfig) string { return s.Name }); err != nil {
+		return err
+	}
+	if err := compileNotifiers("email digest", n.Email, func(e *EmailConfig) string { return e.Name }); err != nil {
+		return err
+	}
+	if err := compileNotifiers("syslog output", n.Syslog, func(s *SyslogConfig) string { return s.Name }); err != nil {
+		return err
+	}
+	return compileNotifiers("cloudevents sink", n.CloudEvents, func(c *CloudEventsConfig) string { return c.Name })
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const webhookBase = "global:\n  port: 8443\n  refresh_interval: 15s\n  cloud_controller_url: https://api.fr.cloud.gov\nnotifications:\n  webhooks:\n"
+
+// TestWebhookRedacted ensures that webhook secrets and headers are not marshalled.
+func TestWebhookRedacted(t *testing.T) {
+	conf, err := Parse([]byte(webhookBase + "    - name: chat\n      url: https://hooks.example.com\n      secret: s3cret\n      headers:\n        Authorization: Bearer token"))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	data, err := yaml.Marshal(conf.Data)
+	if err != nil {
+		t.Fatalf("Config failed to marshal: %v", err)
+	}
+	if strings.Contains(string(data), "s3cret") || strings.Contains(string(data), "Bearer token") {
+		t.Fatalf("Webhook secrets were marshalled. Found:\n%s", data)
+	}
+	if conf.Data.Notifications.Webhooks[0].Secret != "s3cret" {
+		t.Fatal("Marshalling redacted the loaded webhook secret")
+	}
+}
+
+// TestInvalidWebhooks ensures that invalid webhooks are load errors.
+func TestInvalidWebhooks(t *testing.T) {
+	invalid := []string{
+		"    - url: https://hooks.example.com",
+		"    - name: chat\n      url: hooks.example.com",
+		"    - name: chat\n      url: https://hooks.example.com\n      max_retries: -1",
+		"    - name: chat\n      url: https://hooks.example.com\n      template: '{{.Finding'",
+		"    - name: chat\n      url: https://hooks.example.com\n    - name: chat\n      url: https://hooks.example.com",
+	}
+	for _, webhooks := range invalid {
+		if _, err := Parse([]byte(webhookBase + webhooks)); err == nil {
+			t.Fatalf("Invalid webhook loaded without erroring:\n%s", webhooks)
+		}
+	}
+}
+
+// TestSlackRedacted ensures that Slack webhook URLs are not marshalled.
+func TestSlackRedacted(t *testing.T) {
+	conf, err := Parse([]byte(strings.Replace(webhookBase, "webhooks:", "slack:", 1) +
+		"    - name: platform\n      webhook_url: https://hooks.slack.com/services/T000/B000/XXXX"))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	data, err := yaml.Marshal(conf.Data)
+	if err != nil {
+		t.Fatalf("Config failed to marshal: %v", err)
+	}
+	if strings.Contains(string(data), "hooks.slack.com") {
+		t.Fatalf("Slack webhook URL was marshalled. Found:\n%s", data)
+	}
+	if slack := conf.Data.Notifications.Slack[0]; slack.MessageLimit() != 10 || slack.RatePeriod() != time.Hour {
+		t.Fatalf("Slack rate limit defaults incorrect. Found: %d per %s", slack.MessageLimit(), slack.RatePeriod())
+	}
+}
+
+// TestEmailSchedule ensures that digests are scheduled at the same local time every day.
+func TestEmailSchedule(t *testing.T) {
+	conf, err := Parse([]byte(strings.Replace(webhookBase, "webhooks:", "email:", 1) +
+		"    - name: compliance\n      host: smtp.example.gov\n      password: s3cret\n      username: watchtower\n" +
+		"      from: watchtower@example.gov\n      to: [officer@example.gov]\n      send_at: \"07:15\"\n      time_zone: America/New_York"))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+	email := conf.Data.Notifications.Email[0]
+
+	// Daylight saving time ends in New York on 2026-11-01
+	after := time.Date(2026, 10, 31, 12, 0, 0, 0, time.UTC)
+	first := email.NextDigest(after)
+	second := email.NextDigest(first)
+	if first.Format(time.RFC3339) != "2026-11-01T07:15:00-05:00" || second.Format(time.RFC3339) != "2026-11-02T07:15:00-05:00" {
+		t.Fatalf("Digest schedule incorrect. Found: %v, %v", first, second)
+	}
+	if email.Address() != "smtp.example.gov:587" {
+		t.Fatalf("Default SMTP address incorrect. Found: %s", email.Address())
+	}
+
+	data, _ := yaml.Marshal(conf.Data)
+	if strings.Contains(string(data), "s3cret") {
+		t.Fatalf("SMTP password was marshalled. Found:\n%s", data)
+	}
+}
+
+// TestInvalidSyslog ensures that invalid syslog outputs are load errors.
+func TestInvalidSyslog(t *testing.T) {
+	base := strings.Replace(webhookBase, "webhooks:", "syslog:", 1)
+	invalid := []string{
+		"    - name: soc\n      address: siem.example.gov",
+		"    - name: soc\n      address: siem.example.gov:514\n      protocol: relp",
+		"    - name: soc\n      address: siem.example.gov:514\n      facility: local9",
+		"    - name: soc\n      address: siem.example.gov:514\n      hostname: watchtower 0",
+		"    - name: soc\n      address: siem.example.gov:514\n      ca_file: ca.pem",
+		"    - name: soc\n      address: siem.example.gov:6514\n      protocol: tls\n      ca_file: missing.pem",
+	}
+	for _, syslog := range invalid {
+		if _, err := Parse([]byte(base + syslog)); err == nil {
+			t.Fatalf("Invalid syslog output loaded without erroring:\n%s", syslog)
+		}
+	}
+
+	conf, err := Parse([]byte(base + "    - name: soc\n      address: siem.example.gov:514\n      facility: auth"))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+	if syslog := conf.Data.Notifications.Syslog[0]; syslog.FacilityCode() != 4 || syslog.Transport() != "udp" {
+		t.Fatalf("Syslog defaults incorrect. Found: facility %d, transport %s", syslog.FacilityCode(), syslog.Transport())
+	}
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Supported values of the 'match' key for app and space entries
+const (
+	MatchExact = "exact"
+	MatchGlob  = "glob"
+	MatchRegex = "regex"
+)
+
+// namePattern matches resource names against the name of a config entry
+// according to the entry's match type.
+type namePattern struct {
+	name  string
+	match string
+	regex *regexp.Regexp
+}
+
+// newNamePattern validates and compiles the given name for the given match type
+func newNamePattern(name, match string) (*namePattern, error) {
+	pattern := &namePattern{name: name, match: match}
+
+	switch match {
+	case "", MatchExact:
+		pattern.match = MatchExact
+	case MatchGlob:
+		if _, err := path.Match(name, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %w", name, err)
+		}
+	case MatchRegex:
+		// Regular expressions must match the entire name
+		regex, err := regexp.Compile("^(?:" + name + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex pattern %q: %w", name, err)
+		}
+		pattern.regex = regex
+	default:
+		return nil, fmt.Errorf("unsupported match type %q for %q", match, name)
+	}
+
+	return pattern, nil
+}
+
+// isPattern returns true if the pattern matches anything other than its exact name
+func (p *namePattern) isPattern() bool {
+	return p != nil && p.match != MatchExact
+}
+
+// matches returns true if the given name matches the pattern
+func (p *namePattern) matches(name string) bool {
+	switch {
+	case p.match == MatchGlob:
+		matched, err := path.Match(p.name, name)
+		return err == nil && matched
+	case p.match == MatchRegex:
+		return p.regex.MatchString(name)
+	default:
+		return p.name == name
+	}
+}
+
+// nameMatches returns true if name matches the name of a config entry. Entries
+// without a name match every name, and entries that have not been compiled into a
+// pattern match their exact name only.
+func nameMatches(pattern *namePattern, entryName, name string) bool {
+	switch {
+	case entryName == "":
+		return true
+	case pattern == nil:
+		return entryName == name
+	default:
+		return pattern.matches(name)
+	}
+}
+
+// matchesHost returns true if the given host and domain match the RouteEntry,
+// treating the host of the RouteEntry as a glob pattern.
+func (r *RouteEntry) matchesHost(host, domain string) bool {
+	matched, err := path.Match(r.Host(), host)
+	return err == nil && matched && r.Domain() == domain
+}
+
+// validateRoutePattern ensures that the RouteEntry is a valid route pattern
+func (r *RouteEntry) validateRoutePattern() error {
+	if !strings.Contains(string(*r), ".") {
+		return fmt.Errorf("route pattern %q must be of the form <hostname>.<domain>", string(*r))
+	}
+	if _, err := path.Match(r.Host(), ""); err != nil {
+		return fmt.Errorf("invalid route pattern %q: %w", string(*r), err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package config
+
+import "testing"
+
+const patternConfig = `---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+apps:
+  enabled: true
+  resources:
+    - name: myapp
+      ssh_disabled: true
+    - name: myapp*
+      match: glob
+    - name: pr-[0-9]+-web
+      match: regex
+      route_patterns:
+        - pr-*.app.cloud.gov
+spaces:
+  enabled: true
+  resources:
+    - name: prod
+    - name: review-*
+      match: glob
+      allow_ssh: true`
+
+// TestFindAppPrecedence ensures that exact names take precedence over patterns, and patterns over nothing.
+func TestFindAppPrecedence(t *testing.T) {
+	conf := loadCustomConfig(t, []byte(patternConfig))
+
+	if app, ok := conf.FindApp("myapp", nil); !ok || app.Match != "" {
+		t.Fatalf("Exact app entry did not take precedence. Found: %+v", app)
+	}
+	if app, ok := conf.FindApp("myapp-venerable", nil); !ok || app.Name != "myapp*" {
+		t.Fatalf("Glob app entry did not match. Found: %+v", app)
+	}
+	if app, ok := conf.FindApp("pr-123-web", nil); !ok || app.Name != "pr-[0-9]+-web" {
+		t.Fatalf("Regex app entry did not match. Found: %+v", app)
+	}
+	if _, ok := conf.FindApp("pr-123-web-venerable", nil); ok {
+		t.Fatal("Regex app entry matched a partial name")
+	}
+	if _, ok := conf.FindApp("other-app", nil); ok {
+		t.Fatal("Unknown app matched an app entry")
+	}
+}
+
+// TestFindSpacePattern ensures that space entries can be matched by pattern.
+func TestFindSpacePattern(t *testing.T) {
+	conf := loadCustomConfig(t, []byte(patternConfig))
+
+	if space, ok := conf.FindSpace("review-42", nil); !ok || !space.AllowSSH {
+		t.Fatalf("Glob space entry did not match. Found: %+v", space)
+	}
+	if _, ok := conf.FindSpace("staging", nil); ok {
+		t.Fatal("Unknown space matched a space entry")
+	}
+}
+
+// TestRoutePatterns ensures that route patterns match hostnames on the exact domain only.
+func TestRoutePatterns(t *testing.T) {
+	conf := loadCustomConfig(t, []byte(patternConfig))
+	app, _ := conf.FindApp("pr-123-web", nil)
+
+	if !app.ContainsRoute("pr-123.app.cloud.gov") {
+		t.Fatal("Route pattern did not match route")
+	}
+	if app.ContainsRoute("pr-123.other.cloud.gov") {
+		t.Fatal("Route pattern matched route on a different domain")
+	}
+}
+
+// TestInvalidPatterns ensures that invalid patterns and match types are load errors.
+func TestInvalidPatterns(t *testing.T) {
+	header := "global:\n  port: 8443\n  refresh_interval: 15s\n  cloud_controller_url: https://api.fr.cloud.gov\n"
+	invalid := []string{
+		"apps:\n  resources:\n    - name: \"[\"\n      match: glob",
+		"apps:\n  resources:\n    - name: \"(\"\n      match: regex",
+		"apps:\n  resources:\n    - name: app\n      match: fuzzy",
+		"apps:\n  resources:\n    - name: app\n      route_patterns:\n        - no-domain",
+	}
+
+	for _, data := range invalid {
+		if _, err := loadData([]byte(header + data)); err == nil {
+			t.Fatalf("Invalid pattern loaded without erroring: %s", data)
+		}
+	}
+}
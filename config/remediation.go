@@ -0,0 +1,219 @@
+package config
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// defaultMaxActions is the default maximum number of remediation actions taken per run
+const defaultMaxActions = 5
+
+// defaultGracePeriod is how long unknown apps and routes are reported before
+// they are remediated by default
+const defaultGracePeriod = time.Hour
+
+// Actions that can be taken to quarantine unknown apps
+const (
+	QuarantineStop        = "stop"
+	QuarantineUnmapRoutes = "unmap_routes"
+)
+
+// RemediationConfig represents allowed values under the 'remediation' key
+type RemediationConfig struct {
+	DryRun     *bool  `yaml:"dry_run,omitempty" doc:"Whether remediation actions are only logged instead of taken. Defaults to true"`
+	MaxActions int    `yaml:"max_actions_per_run,omitempty" doc:"Maximum number of remediation actions taken per run. Defaults to 5"`
+	AuditLog   string `yaml:"audit_log,omitempty" doc:"File every remediation action is appended to as a JSON line"`
+
+	Quarantine QuarantineConfig       `yaml:"quarantine,omitempty" doc:"Actions taken on unknown apps in the listed spaces"`
+	Routes     RouteRemediationConfig `yaml:"routes,omitempty" doc:"Unmapping of unknown routes on the listed domains"`
+	Approval   ApprovalConfig         `yaml:"approval,omitempty" doc:"Spaces in which remediation actions wait for approval, and who can approve them"`
+}
+
+// ApprovalConfig represents allowed values under the 'remediation:approval' key
+type ApprovalConfig struct {
+	Spaces    []string   `yaml:"spaces,omitempty" doc:"Spaces in which remediation actions are only taken once approved through the /actions endpoints"`
+	Approvers []Approver `yaml:"approvers,omitempty" doc:"Users who can list, approve and reject remediation actions"`
+}
+
+// Approver represents allowed values under the 'remediation:approval:approvers' key
+type Approver struct {
+	Name  string `yaml:"name" doc:"Name of the approver, recorded in the audit log with every decision"`
+	Token string `yaml:"token" doc:"Bearer token the approver authenticates with. Use environment variable expansion to keep it out of the config file"`
+}
+
+// MarshalYAML redacts the token of the approver, so that it is not served by
+// the /config endpoint.
+func (a Approver) MarshalYAML() (interface{}, error) {
+	type plain Approver
+	out := plain(a)
+	if out.Token != "" {
+		out.Token = redacted
+	}
+	return out, nil
+}
+
+// RequiresApproval returns true if remediation actions in the named space wait for approval
+func (a *ApprovalConfig) RequiresApproval(space string) bool {
+	return slices.Contains(a.Spaces, space)
+}
+
+// Authenticate returns the name of the approver with the given token, and false
+// if no approver has it
+func (a *ApprovalConfig) Authenticate(token string) (string, bool) {
+	for _, approver := range a.Approvers {
+		if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(approver.Token)) == 1 {
+			return approver.Name, true
+		}
+	}
+	return "", false
+}
+
+// RouteRemediationConfig represents allowed values under the 'remediation:routes' key
+type RouteRemediationConfig struct {
+	GracePeriod   time.Duration `yaml:"grace_period,omitempty" doc:"How long an unknown route is reported before it is unmapped, e.g. 30m. Defaults to 1h"`
+	Domains       []string      `yaml:"domains,omitempty" doc:"Domains on which unknown routes are unmapped. Unknown routes on other domains are only reported"`
+	DeleteOrphans bool          `yaml:"delete_orphans,omitempty" doc:"Whether unknown routes that are not mapped to any other app are deleted instead of unmapped"`
+	DryRun        *bool         `yaml:"dry_run,omitempty" doc:"Whether the actions are only logged instead of taken. Defaults to remediation.dry_run"`
+}
+
+// Grace returns how long an unknown route is reported before it is unmapped
+func (r *RouteRemediationConfig) Grace() time.Duration {
+	if r.GracePeriod == 0 {
+		return defaultGracePeriod
+	}
+	return r.GracePeriod
+}
+
+// Enforced returns true if unknown routes on the domain are unmapped
+func (r *RouteRemediationConfig) Enforced(domain string) bool {
+	return slices.Contains(r.Domains, domain)
+}
+
+// QuarantineConfig represents allowed values under the 'remediation:quarantine' key
+type QuarantineConfig struct {
+	GracePeriod time.Duration     `yaml:"grace_period,omitempty" doc:"How long an unknown app is reported before it is quarantined, e.g. 30m. Defaults to 1h"`
+	Spaces      []QuarantineSpace `yaml:"spaces,omitempty" doc:"Spaces in which unknown apps are quarantined, and the actions allowed in each"`
+}
+
+// QuarantineSpace represents allowed values under the 'remediation:quarantine:spaces' key
+type QuarantineSpace struct {
+	Name    string   `yaml:"name" doc:"Name of the space"`
+	Actions []string `yaml:"actions" doc:"Actions taken on unknown apps in the space: stop, unmap_routes, or both"`
+	DryRun  *bool    `yaml:"dry_run,omitempty" doc:"Whether the actions are only logged instead of taken. Defaults to remediation.dry_run"`
+}
+
+// Grace returns how long an unknown app is reported before it is quarantined
+func (q *QuarantineConfig) Grace() time.Duration {
+	if q.GracePeriod == 0 {
+		return defaultGracePeriod
+	}
+	return q.GracePeriod
+}
+
+// Space returns the quarantine settings of the named space, and false if unknown
+// apps in the space are not quarantined
+func (q *QuarantineConfig) Space(name string) (QuarantineSpace, bool) {
+	for _, space := range q.Spaces {
+		if space.Name == name {
+			return space, true
+		}
+	}
+	return QuarantineSpace{}, false
+}
+
+// Allows returns true if the quarantine action is allowed in the space
+func (s *QuarantineSpace) Allows(action string) bool {
+	return slices.Contains(s.Actions, action)
+}
+
+// IsDryRun returns true unless dry runs are disabled
+func (r *RemediationConfig) IsDryRun() bool {
+	return r.DryRun == nil || *r.DryRun
+}
+
+// ActionLimit returns the maximum number of remediation actions taken per run
+func (r *RemediationConfig) ActionLimit() int {
+	if r.MaxActions == 0 {
+		return defaultMaxActions
+	}
+	return r.MaxActions
+}
+
+// compile validates the remediation config
+func (r *RemediationConfig) compile() error {
+	if r.MaxActions < 0 {
+		return errors.New("remediation max_actions_per_run cannot be negative")
+	}
+	if r.Quarantine.GracePeriod < 0 {
+		return errors.New("quarantine grace_period cannot be negative")
+	}
+	if r.Routes.GracePeriod < 0 {
+		return errors.New("routes grace_period cannot be negative")
+	}
+	names := make(map[string]bool)
+	tokens := make(map[string]bool)
+	for _, approver := range r.Approval.Approvers {
+		if approver.Name == "" || approver.Token == "" {
+			return errors.New("approvers must have a name and a token")
+		}
+		if names[approver.Name] || tokens[approver.Token] {
+			return fmt.Errorf("approver %q must have a unique name and token", approver.Name)
+		}
+		names[approver.Name] = true
+		tokens[approver.Token] = true
+	}
+	seen := make(map[string]bool)
+	for _, space := range r.Quarantine.Spaces {
+		if space.Name == "" {
+			return errors.New("quarantine spaces must have a name")
+		}
+		if seen[space.Name] {
+			return fmt.Errorf("quarantine space %q is listed more than once", space.Name)
+		}
+		seen[space.Name] = true
+		if len(space.Actions) == 0 {
+			return fmt.Errorf("quarantine space %q must allow at least one action", space.Name)
+		}
+		for _, action := range space.Actions {
+			if action != QuarantineStop && action != QuarantineUnmapRoutes {
+				return fmt.Errorf("quarantine action %q of space %q must be one of: %s, %s", action, space.Name, QuarantineStop, QuarantineUnmapRoutes)
+			}
+		}
+	}
+	return nil
+}
+
+// QuarantineDryRun returns true if the quarantine actions of the space are only logged
+func (c *Config) QuarantineDryRun(space *QuarantineSpace) bool {
+	if space.DryRun != nil {
+		return *space.DryRun
+	}
+	return c.Data.Remediation.IsDryRun()
+}
+
+// RouteDryRun returns true if the unmapping of unknown routes is only logged
+func (c *Config) RouteDryRun() bool {
+	if c.Data.Remediation.Routes.DryRun != nil {
+		return *c.Data.Remediation.Routes.DryRun
+	}
+	return c.Data.Remediation.IsDryRun()
+}
+
+// AppSSHEnforced returns true if ssh drift of an app matching the entry is remediated
+func (c *Config) AppSSHEnforced(entry *AppEntry) bool {
+	if entry.EnforceSSH != nil {
+		return *entry.EnforceSSH
+	}
+	return c.Data.Checks.Enforced("app_ssh")
+}
+
+// SpaceSSHEnforced returns true if ssh drift of a space matching the entry is remediated
+func (c *Config) SpaceSSHEnforced(entry *SpaceEntry) bool {
+	if entry.EnforceSSH != nil {
+		return *entry.EnforceSSH
+	}
+	return c.Data.Checks.Enforced("spaces")
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TestInvalidRemediation ensures that invalid remediation settings are load errors.
+func TestInvalidRemediation(t *testing.T) {
+	base := "global:\n  port: 8443\n  refresh_interval: 15s\n  cloud_controller_url: https://api.fr.cloud.gov\nremediation:\n"
+	invalid := map[string]string{
+		"  max_actions_per_run: -1": "max_actions_per_run cannot be negative",
+		"  quarantine:\n    spaces:\n      - name: prod\n        actions: []":                                                  `quarantine space "prod" must allow at least one action`,
+		"  quarantine:\n    spaces:\n      - name: prod\n        actions: [delete]":                                            `quarantine action "delete" of space "prod"`,
+		"  quarantine:\n    spaces:\n      - name: prod\n        actions: [stop]\n      - name: prod\n        actions: [stop]": `quarantine space "prod" is listed more than once`,
+		"  approval:\n    approvers:\n      - name: ops":                                                                       "approvers must have a name and a token",
+		"  approval:\n    approvers:\n      - name: ops\n        token: a\n      - name: ops\n        token: b":                `approver "ops" must have a unique name and token`,
+	}
+	for remediation, message := range invalid {
+		_, err := Parse([]byte(base + remediation))
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Fatalf("Invalid remediation config did not report %q. Found: %v", message, err)
+		}
+	}
+}
+
+// TestApprovers ensures that approvers are authenticated by their token, and that
+// tokens are not marshalled.
+func TestApprovers(t *testing.T) {
+	conf, err := Parse([]byte("global:\n  port: 8443\n  refresh_interval: 15s\n  cloud_controller_url: https://api.fr.cloud.gov\n" +
+		"remediation:\n  approval:\n    spaces: [prod]\n    approvers:\n      - name: ops\n        token: s3cret-token"))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+	approval := &conf.Data.Remediation.Approval
+	if name, ok := approval.Authenticate("s3cret-token"); !ok || name != "ops" {
+		t.Fatalf("Approver was not authenticated. Found: %q", name)
+	}
+	if _, ok := approval.Authenticate(""); ok {
+		t.Fatal("Empty token was authenticated")
+	}
+	if !approval.RequiresApproval("prod") || approval.RequiresApproval("dev") {
+		t.Fatal("Incorrect spaces require approval")
+	}
+
+	data, err := yaml.Marshal(conf.Data)
+	if err != nil {
+		t.Fatalf("Config failed to marshal: %v", err)
+	}
+	if strings.Contains(string(data), "s3cret-token") {
+		t.Fatalf("Approver token was marshalled. Found:\n%s", data)
+	}
+}
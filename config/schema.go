@@ -0,0 +1,247 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SchemaID is the identifier of the published config JSON Schema
+const SchemaID = "https://raw.githubusercontent.com/18F/watchtower/main/config.schema.json"
+
+// durationPattern matches the durations accepted by time.ParseDuration
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// jsonSchema is the subset of JSON Schema used to describe the config. Type is
+// either a single type name or a list of type names.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	ID                   string                 `json:"$id,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 interface{}            `json:"type,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// configSchema is the schema generated from YAMLConfig when the package is initialized
+var configSchema = newConfigSchema()
+
+// newConfigSchema generates the JSON Schema of YAMLConfig
+func newConfigSchema() *jsonSchema {
+	schema := schemaForType(reflect.TypeOf(YAMLConfig{}))
+	schema.Schema = "http://json-schema.org/draft-07/schema#"
+	schema.ID = SchemaID
+	schema.Title = "Watchtower config"
+	return schema
+}
+
+// Schema returns the JSON Schema of the Watchtower config file, generated from
+// the yaml and doc tags of YAMLConfig and the types it contains.
+func Schema() ([]byte, error) {
+	data, err := json.MarshalIndent(configSchema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// schemaForType returns the JSON Schema of a config type. Lists, maps and
+// structs may be null, since an empty YAML key decodes as null.
+func schemaForType(t reflect.Type) *jsonSchema {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return &jsonSchema{Type: "string", Pattern: durationPattern, pattern: regexp.MustCompile(durationPattern)}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaForType(t.Elem())
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Uint16:
+		minimum, maximum := 0.0, float64(math.MaxUint16)
+		return &jsonSchema{Type: "integer", Minimum: &minimum, Maximum: &maximum}
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Slice:
+		return &jsonSchema{Type: []string{"array", "null"}, Items: schemaForType(t.Elem())}
+	case reflect.Map:
+		// Scalar map values, such as manifest vars, are decoded into strings
+		return &jsonSchema{Type: []string{"object", "null"}, AdditionalProperties: &jsonSchema{
+			Type: []string{"string", "number", "boolean"},
+		}}
+	case reflect.Struct:
+		schema := &jsonSchema{
+			Type:                 []string{"object", "null"},
+			Properties:           make(map[string]*jsonSchema),
+			AdditionalProperties: false,
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if field.IsExported() && options == "inline" {
+				for inlineName, property := range schemaForType(field.Type).Properties {
+					schema.Properties[inlineName] = property
+				}
+				continue
+			}
+			if !field.IsExported() || name == "" || name == "-" {
+				continue
+			}
+			property := schemaForType(field.Type)
+			property.Description = field.Tag.Get("doc")
+			if enum := field.Tag.Get("enum"); enum != "" {
+				property.Enum = strings.Split(enum, ",")
+			}
+			schema.Properties[name] = property
+		}
+		return schema
+	}
+	panic(fmt.Sprintf("no JSON Schema type for %s", t))
+}
+
+// types returns the type names allowed by the schema
+func (s *jsonSchema) types() []string {
+	switch types := s.Type.(type) {
+	case string:
+		return []string{types}
+	case []string:
+		return types
+	}
+	return nil
+}
+
+// jsonType returns the JSON Schema type name of a decoded YAML value
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[interface{}]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// toFloat returns a decoded YAML number as a float64
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// validate checks a decoded YAML value against the schema, returning an error
+// for each violation. path is the location of the value within the config.
+func (s *jsonSchema) validate(path string, value interface{}) []error {
+	valueType := jsonType(value)
+	allowed := s.types()
+	typeOK := false
+	for _, t := range allowed {
+		if t == valueType || (t == "number" && valueType == "integer") {
+			typeOK = true
+		}
+	}
+	if !typeOK {
+		if path == "" {
+			path = "config"
+		}
+		return []error{fmt.Errorf("%s: expected %s, found %s", path, strings.Join(allowed, " or "), valueType)}
+	}
+
+	var errs []error
+	switch v := value.(type) {
+	case string:
+		if len(s.Enum) != 0 && !slices.Contains(s.Enum, v) {
+			errs = append(errs, fmt.Errorf("%s: %q must be one of: %s", path, v, strings.Join(s.Enum, ", ")))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			errs = append(errs, fmt.Errorf("%s: %q must match %s", path, v, s.Pattern))
+		}
+	case int, int64, uint64, float64:
+		if n := toFloat(v); (s.Minimum != nil && n < *s.Minimum) || (s.Maximum != nil && n > *s.Maximum) {
+			errs = append(errs, fmt.Errorf("%s: %v is out of range", path, v))
+		}
+	case []interface{}:
+		for i, item := range v {
+			errs = append(errs, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+		}
+	case map[interface{}]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, fmt.Sprint(key))
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			keyPath := strings.TrimPrefix(path+"."+key, ".")
+			property, ok := s.Properties[key]
+			if !ok {
+				additional, isSchema := s.AdditionalProperties.(*jsonSchema)
+				if !isSchema {
+					errs = append(errs, fmt.Errorf("%s: unknown key", keyPath))
+					continue
+				}
+				property = additional
+			}
+			errs = append(errs, property.validate(keyPath, lookupKey(v, key))...)
+		}
+	}
+	return errs
+}
+
+// lookupKey returns the value of a YAML mapping key by its string form
+func lookupKey(mapping map[interface{}]interface{}, key string) interface{} {
+	for k, value := range mapping {
+		if fmt.Sprint(k) == key {
+			return value
+		}
+	}
+	return nil
+}
+
+// validateSchema checks YAML config data against the config JSON Schema,
+// returning every violation found.
+func validateSchema(data []byte) error {
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	return errors.Join(configSchema.validate("", value)...)
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestSchemaUpToDate ensures that the published schema matches the config types.
+// Run 'go generate' to update it.
+func TestSchemaUpToDate(t *testing.T) {
+	published, err := os.ReadFile("../config.schema.json")
+	if err != nil {
+		t.Fatalf("Failed reading published schema: %v", err)
+	}
+	generated, err := Schema()
+	if err != nil {
+		t.Fatalf("Failed generating schema: %v", err)
+	}
+	if string(published) != string(generated) {
+		t.Fatal("config.schema.json is out of date. Run 'go generate' to update it.")
+	}
+}
+
+// TestSchemaValidation ensures that every schema violation in a config is reported.
+func TestSchemaValidation(t *testing.T) {
+	data := `---
+global:
+  port: 70000
+  refresh_interval: soon
+  cloud_controller_url: https://api.fr.cloud.gov
+apps:
+  enabled: yes please
+  resources:
+    - name: web
+      match: fuzzy
+      instances: many
+      colour: blue`
+
+	_, err := Parse([]byte(data))
+	if err == nil {
+		t.Fatal("Config violating the schema loaded without erroring")
+	}
+
+	expected := []string{
+		"global.port: 70000 is out of range",
+		`global.refresh_interval: "soon" must match`,
+		"apps.enabled: expected boolean, found string",
+		"apps.resources[0].colour: unknown key",
+		"apps.resources[0].instances: expected integer, found string",
+		`apps.resources[0].match: "fuzzy" must be one of: exact, glob, regex`,
+	}
+	for _, message := range expected {
+		if !strings.Contains(err.Error(), message) {
+			t.Fatalf("Schema error %q was not reported. Found:\n%v", message, err)
+		}
+	}
+}
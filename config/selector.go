@@ -0,0 +1,169 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Operators supported in label selector requirements. These follow the label
+// selector syntax of the Cloud Foundry V3 API.
+const (
+	selectorEquals    = "="
+	selectorNotEquals = "!="
+	selectorIn        = "in"
+	selectorNotIn     = "notin"
+	selectorExists    = "exists"
+	selectorNotExists = "!exists"
+)
+
+// labelRequirement is a single comma-separated requirement of a label selector
+type labelRequirement struct {
+	key      string
+	operator string
+	values   []string
+}
+
+// labelSelector matches resources whose labels satisfy every requirement
+type labelSelector []labelRequirement
+
+// splitSelector splits a label selector on the commas that are not within a set
+// of values such as "(a,b)".
+func splitSelector(selector string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, char := range selector {
+		switch char {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, selector[start:])
+}
+
+// parseSetRequirement parses requirements of the form "key in (a,b)" and "key notin (a,b)"
+func parseSetRequirement(part string) (labelRequirement, bool, error) {
+	for _, operator := range []string{selectorNotIn, selectorIn} {
+		index := strings.Index(part, " "+operator+" ")
+		if index < 0 {
+			continue
+		}
+
+		key := strings.TrimSpace(part[:index])
+		set := strings.TrimSpace(part[index+len(operator)+2:])
+		if !strings.HasPrefix(set, "(") || !strings.HasSuffix(set, ")") {
+			return labelRequirement{}, true, fmt.Errorf("invalid set in label selector requirement %q", part)
+		}
+
+		var values []string
+		for _, value := range strings.Split(set[1:len(set)-1], ",") {
+			values = append(values, strings.TrimSpace(value))
+		}
+		return labelRequirement{key: key, operator: operator, values: values}, true, nil
+	}
+	return labelRequirement{}, false, nil
+}
+
+// parseRequirement parses a single label selector requirement
+func parseRequirement(part string) (labelRequirement, error) {
+	part = strings.TrimSpace(part)
+	if part == "" {
+		return labelRequirement{}, fmt.Errorf("empty label selector requirement")
+	}
+
+	if requirement, ok, err := parseSetRequirement(part); ok {
+		return requirement, err
+	}
+
+	var requirement labelRequirement
+	switch {
+	case strings.Contains(part, "!="):
+		tokens := strings.SplitN(part, "!=", 2)
+		requirement = labelRequirement{key: tokens[0], operator: selectorNotEquals, values: []string{tokens[1]}}
+	case strings.Contains(part, "=="):
+		tokens := strings.SplitN(part, "==", 2)
+		requirement = labelRequirement{key: tokens[0], operator: selectorEquals, values: []string{tokens[1]}}
+	case strings.Contains(part, "="):
+		tokens := strings.SplitN(part, "=", 2)
+		requirement = labelRequirement{key: tokens[0], operator: selectorEquals, values: []string{tokens[1]}}
+	case strings.HasPrefix(part, "!"):
+		requirement = labelRequirement{key: part[1:], operator: selectorNotExists}
+	default:
+		requirement = labelRequirement{key: part, operator: selectorExists}
+	}
+
+	requirement.key = strings.TrimSpace(requirement.key)
+	for i := range requirement.values {
+		requirement.values[i] = strings.TrimSpace(requirement.values[i])
+	}
+	if requirement.key == "" || strings.ContainsAny(requirement.key, " ()!=") {
+		return labelRequirement{}, fmt.Errorf("invalid key in label selector requirement %q", part)
+	}
+	return requirement, nil
+}
+
+// parseLabelSelector parses a label selector such as "env=prod,team in (a,b)"
+func parseLabelSelector(selector string) (labelSelector, error) {
+	var parsed labelSelector
+	for _, part := range splitSelector(selector) {
+		requirement, err := parseRequirement(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label selector %q: %w", selector, err)
+		}
+		parsed = append(parsed, requirement)
+	}
+	return parsed, nil
+}
+
+// containsValue returns true if value is one of the requirement's values
+func (r *labelRequirement) containsValue(value string) bool {
+	for _, v := range r.values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns true if the given labels satisfy the requirement
+func (r *labelRequirement) matches(labels map[string]string) bool {
+	value, ok := labels[r.key]
+	switch r.operator {
+	case selectorEquals, selectorIn:
+		return ok && r.containsValue(value)
+	case selectorNotEquals, selectorNotIn:
+		return !ok || !r.containsValue(value)
+	case selectorExists:
+		return ok
+	case selectorNotExists:
+		return !ok
+	}
+	return false
+}
+
+// matches returns true if the given labels satisfy every requirement of the selector
+func (s labelSelector) matches(labels map[string]string) bool {
+	for i := range s {
+		if !s[i].matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// MissingLabels returns the labels in required that are not set in labels
+func MissingLabels(required []string, labels map[string]string) []string {
+	var missing []string
+	for _, key := range required {
+		if _, ok := labels[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
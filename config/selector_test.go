@@ -0,0 +1,101 @@
+package config
+
+import "testing"
+
+const selectorConfig = `---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+apps:
+  enabled: true
+  required_labels:
+    - owner
+  resources:
+    - name: myapp
+    - selector: env=prod,team in (payments, billing)
+      ssh_disabled: true
+    - name: worker-*
+      match: glob
+      selector: "!deprecated"
+spaces:
+  enabled: true
+  resources:
+    - selector: env
+      allow_ssh: true`
+
+// TestLabelSelectorMatches tests each of the supported label selector operators.
+func TestLabelSelectorMatches(t *testing.T) {
+	labels := map[string]string{"env": "prod", "team": "payments"}
+	tests := map[string]bool{
+		"env=prod":                    true,
+		"env==prod":                   true,
+		"env=dev":                     false,
+		"env!=dev":                    true,
+		"team in (payments, billing)": true,
+		"team notin (payments)":       false,
+		"env,team":                    true,
+		"owner":                       false,
+		"!owner":                      true,
+		"env=prod,owner":              false,
+	}
+
+	for selector, expected := range tests {
+		parsed, err := parseLabelSelector(selector)
+		if err != nil {
+			t.Fatalf("Selector %q failed to parse: %v", selector, err)
+		}
+		if matched := parsed.matches(labels); matched != expected {
+			t.Fatalf("Selector %q matched: %v. Expected: %v", selector, matched, expected)
+		}
+	}
+}
+
+// TestInvalidLabelSelectors ensures that malformed selectors are rejected.
+func TestInvalidLabelSelectors(t *testing.T) {
+	for _, selector := range []string{"", "env=prod,", "team in payments", "=prod"} {
+		if _, err := parseLabelSelector(selector); err == nil {
+			t.Fatalf("Invalid selector %q parsed without erroring", selector)
+		}
+	}
+}
+
+// TestFindAppBySelector ensures that app entries can select apps by label.
+func TestFindAppBySelector(t *testing.T) {
+	conf := loadCustomConfig(t, []byte(selectorConfig))
+
+	if app, ok := conf.FindApp("payments-api", map[string]string{"env": "prod", "team": "payments"}); !ok || !app.SSHDisabled {
+		t.Fatalf("Selector app entry did not match. Found: %+v", app)
+	}
+	if _, ok := conf.FindApp("payments-api", map[string]string{"env": "dev", "team": "payments"}); ok {
+		t.Fatal("Selector app entry matched app with wrong labels")
+	}
+	if _, ok := conf.FindApp("worker-1", nil); !ok {
+		t.Fatal("Name and selector app entry did not match")
+	}
+	if _, ok := conf.FindApp("worker-1", map[string]string{"deprecated": "true"}); ok {
+		t.Fatal("Name and selector app entry matched app excluded by selector")
+	}
+	if _, ok := conf.Apps["{env=prod,team in (payments, billing)}"]; !ok {
+		t.Fatalf("Selector app entry was not indexed by its selector. Found: %+v", conf.Apps)
+	}
+	if _, ok := conf.FindSpace("dev", map[string]string{"env": "dev"}); !ok {
+		t.Fatal("Selector space entry did not match")
+	}
+	if !conf.HasSpaceSelectors() {
+		t.Fatal("Selector space entry was not reported as a space selector")
+	}
+}
+
+// TestMissingLabels ensures that missing required labels are reported.
+func TestMissingLabels(t *testing.T) {
+	conf := loadCustomConfig(t, []byte(selectorConfig))
+	required := conf.Data.AppConfig.RequiredLabels
+
+	if missing := MissingLabels(required, map[string]string{"owner": "me"}); len(missing) != 0 {
+		t.Fatalf("Labels reported missing when present. Found: %+v", missing)
+	}
+	if missing := MissingLabels(required, nil); len(missing) != 1 || missing[0] != "owner" {
+		t.Fatalf("Missing labels incorrect. Found: %+v", missing)
+	}
+}
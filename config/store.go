@@ -0,0 +1,30 @@
+package config
+
+import "sync"
+
+// Store provides a concurrency-safe way of accessing the currently loaded
+// Config, allowing it to be replaced while Watchtower is running.
+type Store struct {
+	conf Config
+	mut  sync.RWMutex
+}
+
+// NewStore returns a Store holding the given Config
+func NewStore(conf Config) *Store {
+	return &Store{conf: conf}
+}
+
+// Get returns the current Config
+func (s *Store) Get() Config {
+	s.mut.RLock()
+	conf := s.conf
+	s.mut.RUnlock()
+	return conf
+}
+
+// Set replaces the current Config
+func (s *Store) Set(conf Config) {
+	s.mut.Lock()
+	s.conf = conf
+	s.mut.Unlock()
+}
@@ -0,0 +1,314 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// tfManagedMode is the mode of resources managed by Terraform, as opposed to
+// data sources, which only read existing resources
+const tfManagedMode = "managed"
+
+// Terraform resource types of the cloudfoundry provider that are imported
+const (
+	tfAppType                 = "cloudfoundry_app"
+	tfRouteType               = "cloudfoundry_route"
+	tfSpaceType               = "cloudfoundry_space"
+	tfDomainType              = "cloudfoundry_domain"
+	tfServiceInstanceType     = "cloudfoundry_service_instance"
+	tfUserProvidedServiceType = "cloudfoundry_user_provided_service"
+)
+
+// tfResource is a single resource instance found in Terraform state
+type tfResource struct {
+	mode         string
+	resourceType string
+	values       map[string]interface{}
+}
+
+// tfState represents the parts of a terraform.tfstate file used by Watchtower
+type tfState struct {
+	Resources []struct {
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Instances []struct {
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+// tfModule represents a module in the output of 'terraform show -json'
+type tfModule struct {
+	Resources []struct {
+		Mode   string                 `json:"mode"`
+		Type   string                 `json:"type"`
+		Values map[string]interface{} `json:"values"`
+	} `json:"resources"`
+	ChildModules []tfModule `json:"child_modules"`
+}
+
+// tfShowOutput represents the parts of the output of 'terraform show -json' used by Watchtower
+type tfShowOutput struct {
+	Values *struct {
+		RootModule tfModule `json:"root_module"`
+	} `json:"values"`
+}
+
+// resources returns the resources of the module and all of its child modules
+func (m *tfModule) resources() []tfResource {
+	var resources []tfResource
+	for _, resource := range m.Resources {
+		resources = append(resources, tfResource{mode: resource.Mode, resourceType: resource.Type, values: resource.Values})
+	}
+	for i := range m.ChildModules {
+		resources = append(resources, m.ChildModules[i].resources()...)
+	}
+	return resources
+}
+
+// parseTerraformResources returns every resource instance found in either a
+// terraform.tfstate file or the output of 'terraform show -json'.
+func parseTerraformResources(data []byte) ([]tfResource, error) {
+	var show tfShowOutput
+	if err := json.Unmarshal(data, &show); err != nil {
+		return nil, err
+	}
+	if show.Values != nil {
+		return show.Values.RootModule.resources(), nil
+	}
+
+	var state tfState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	var resources []tfResource
+	for _, resource := range state.Resources {
+		for _, instance := range resource.Instances {
+			resources = append(resources, tfResource{mode: resource.Mode, resourceType: resource.Type, values: instance.Attributes})
+		}
+	}
+	return resources, nil
+}
+
+// tfString returns the named string attribute, or "" if it is not a string
+func tfString(values map[string]interface{}, key string) string {
+	value, _ := values[key].(string)
+	return value
+}
+
+// tfInt returns the named numeric attribute, or 0 if it is not a number
+func tfInt(values map[string]interface{}, key string) int {
+	value, _ := values[key].(float64)
+	return int(value)
+}
+
+// tfBool returns the named boolean attribute, or fallback if it is not set
+func tfBool(values map[string]interface{}, key string, fallback bool) bool {
+	value, ok := values[key].(bool)
+	if !ok {
+		return fallback
+	}
+	return value
+}
+
+// tfStrings returns the named list of strings attribute
+func tfStrings(values map[string]interface{}, key string) []string {
+	list, _ := values[key].([]interface{})
+	var strs []string
+	for _, elem := range list {
+		if str, ok := elem.(string); ok && str != "" {
+			strs = append(strs, str)
+		}
+	}
+	return strs
+}
+
+// tfBlocks returns the named list of nested blocks attribute
+func tfBlocks(values map[string]interface{}, key string) []map[string]interface{} {
+	list, _ := values[key].([]interface{})
+	var blocks []map[string]interface{}
+	for _, elem := range list {
+		if block, ok := elem.(map[string]interface{}); ok {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// tfResourceIndex holds the names of Terraform resources that apps refer to by
+// ID, and the routes that refer to apps by ID
+type tfResourceIndex struct {
+	routes    map[string]string   // route ID -> <hostname>.<domain>
+	services  map[string]string   // service instance ID -> name
+	appRoutes map[string][]string // app ID -> URLs of the routes with the app as a destination
+}
+
+// newTFResourceIndex indexes the routes, domains and service instances in resources
+func newTFResourceIndex(resources []tfResource) tfResourceIndex {
+	domains := make(map[string]string)
+	index := tfResourceIndex{
+		routes:    make(map[string]string),
+		services:  make(map[string]string),
+		appRoutes: make(map[string][]string),
+	}
+
+	for _, resource := range resources {
+		switch resource.resourceType {
+		case tfDomainType:
+			domains[tfString(resource.values, "id")] = tfString(resource.values, "name")
+		case tfServiceInstanceType, tfUserProvidedServiceType:
+			index.services[tfString(resource.values, "id")] = tfString(resource.values, "name")
+		}
+	}
+
+	for _, resource := range resources {
+		if resource.resourceType != tfRouteType {
+			continue
+		}
+		url := tfString(resource.values, "endpoint")
+		if url == "" {
+			url = tfString(resource.values, "url")
+		}
+		// The hostname is 'hostname' in the community provider, and 'host' in the
+		// official provider
+		if domain, ok := domains[tfString(resource.values, "domain")]; url == "" && ok {
+			host := tfString(resource.values, "hostname")
+			if host == "" {
+				host = tfString(resource.values, "host")
+			}
+			url = host + "." + domain
+		}
+		if url == "" {
+			continue
+		}
+		index.routes[tfString(resource.values, "id")] = url
+
+		// Routes of the official provider map themselves to apps with 'destinations'
+		for _, destination := range tfBlocks(resource.values, "destinations") {
+			if appID := tfString(destination, "app_id"); appID != "" {
+				index.appRoutes[appID] = append(index.appRoutes[appID], url)
+			}
+		}
+	}
+
+	return index
+}
+
+// tfAppEntry converts a cloudfoundry_app resource into an AppEntry. Routes and
+// service instances may be referenced either by ID or by name, and routes may
+// instead list the app among their destinations.
+func (index *tfResourceIndex) tfAppEntry(values map[string]interface{}) AppEntry {
+	entry := AppEntry{
+		Name:                    tfString(values, "name"),
+		Instances:               tfInt(values, "instances"),
+		Buildpacks:              tfStrings(values, "buildpacks"),
+		HealthCheckType:         tfString(values, "health_check_type"),
+		HealthCheckHTTPEndpoint: tfString(values, "health_check_http_endpoint"),
+		SSHDisabled:             !tfBool(values, "enable_ssh", true),
+	}
+
+	// Memory is a number of megabytes in the community provider, and a string with
+	// a unit in the official provider.
+	if memory := tfInt(values, "memory"); memory != 0 {
+		entry.Memory = fmt.Sprintf("%dM", memory)
+	} else {
+		entry.Memory = tfString(values, "memory")
+	}
+	if buildpack := tfString(values, "buildpack"); len(entry.Buildpacks) == 0 && buildpack != "" {
+		entry.Buildpacks = []string{buildpack}
+	}
+
+	addRoute := func(ref string) {
+		if url, ok := index.routes[ref]; ok {
+			ref = url
+		}
+		// Routes whose ID is not found in the state cannot be resolved to a URL
+		if routeEntry, ok := manifestRoute(ref); ok && strings.Contains(ref, ".") && !slices.Contains(entry.Routes, routeEntry) {
+			entry.Routes = append(entry.Routes, routeEntry)
+		}
+	}
+	for _, route := range tfBlocks(values, "routes") {
+		addRoute(tfString(route, "route"))
+	}
+	if id := tfString(values, "id"); id != "" {
+		for _, url := range index.appRoutes[id] {
+			addRoute(url)
+		}
+	}
+
+	for _, bindingKey := range []string{"service_binding", "service_bindings"} {
+		for _, binding := range tfBlocks(values, bindingKey) {
+			ref := tfString(binding, "service_instance")
+			if name, ok := index.services[ref]; ok {
+				ref = name
+			}
+			if ref != "" {
+				entry.Services = append(entry.Services, ref)
+			}
+		}
+	}
+
+	return entry
+}
+
+// loadTerraformState reads a terraform.tfstate file, or the output of
+// 'terraform show -json', and returns the apps and spaces managed by the
+// cloudfoundry provider as a config fragment. Data sources are only used to
+// resolve the routes, domains and service instances that apps refer to.
+func loadTerraformState(filename string) (fragmentConfig, error) {
+	data, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return fragmentConfig{}, err
+	}
+
+	resources, err := parseTerraformResources(data)
+	if err != nil {
+		return fragmentConfig{}, fmt.Errorf("%s: %w", filename, err)
+	}
+	index := newTFResourceIndex(resources)
+
+	var fragment fragmentConfig
+	for _, resource := range resources {
+		if resource.mode != tfManagedMode {
+			continue
+		}
+		switch resource.resourceType {
+		case tfAppType:
+			fragment.AppConfig.Apps = append(fragment.AppConfig.Apps, index.tfAppEntry(resource.values))
+		case tfSpaceType:
+			fragment.SpaceConfig.Spaces = append(fragment.SpaceConfig.Spaces, SpaceEntry{
+				Name:     tfString(resource.values, "name"),
+				AllowSSH: tfBool(resource.values, "allow_ssh", true),
+			})
+		}
+	}
+	return fragment, nil
+}
+
+// loadTerraformStates loads each Terraform state file listed under
+// 'terraform_states'. Relative paths are resolved against baseDir. The loaded
+// states are returned along with the paths of every file that was read.
+func loadTerraformStates(baseDir string, paths []string) ([]loadedFragment, []string, error) {
+	var fragments []loadedFragment
+	var files []string
+	var errs []error
+
+	for _, path := range paths {
+		statePath := resolvePath(baseDir, path)
+		files = append(files, statePath)
+
+		fragment, err := loadTerraformState(statePath)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fragments = append(fragments, loadedFragment{source: statePath, config: fragment})
+	}
+
+	return fragments, files, errors.Join(errs...)
+}
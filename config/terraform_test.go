@@ -0,0 +1,137 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+const terraformMainConfig = `---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+terraform_states:
+  - terraform.tfstate
+  - show.json
+apps:
+  enabled: true
+  resources: []
+spaces:
+  enabled: true
+  resources: []`
+
+const testTerraformState = `{
+  "version": 4,
+  "resources": [
+    {"mode": "data", "type": "cloudfoundry_domain", "name": "app",
+     "instances": [{"attributes": {"id": "domain-guid", "name": "app.cloud.gov"}}]},
+    {"mode": "data", "type": "cloudfoundry_space", "name": "shared",
+     "instances": [{"attributes": {"id": "shared-guid", "name": "shared", "allow_ssh": true}}]},
+    {"mode": "managed", "type": "cloudfoundry_route", "name": "web",
+     "instances": [{"attributes": {"id": "route-guid", "domain": "domain-guid", "hostname": "web"}}]},
+    {"mode": "managed", "type": "cloudfoundry_service_instance", "name": "db",
+     "instances": [{"attributes": {"id": "db-guid", "name": "my-db"}}]},
+    {"mode": "managed", "type": "cloudfoundry_space", "name": "dev",
+     "instances": [{"attributes": {"id": "space-guid", "name": "dev", "allow_ssh": false}}]},
+    {"mode": "managed", "type": "cloudfoundry_app", "name": "web",
+     "instances": [{"attributes": {
+       "name": "web", "instances": 2, "memory": 256, "buildpack": "go_buildpack",
+       "enable_ssh": false, "health_check_type": "http",
+       "routes": [{"route": "route-guid"}, {"route": "unknown-guid"}],
+       "service_binding": [{"service_instance": "db-guid"}]
+     }}]}
+  ]
+}`
+
+const testTerraformShow = `{
+  "format_version": "1.0",
+  "values": {
+    "root_module": {
+      "child_modules": [{
+        "resources": [
+          {"mode": "data", "type": "cloudfoundry_app", "name": "legacy",
+           "values": {"name": "legacy", "memory": "64M"}},
+          {"mode": "managed", "type": "cloudfoundry_route", "name": "api",
+           "values": {"id": "api-route-guid", "host": "api", "url": "api.app.cloud.gov",
+                      "destinations": [{"app_id": "api-guid", "port": 8080}]}},
+          {"mode": "managed", "type": "cloudfoundry_app", "name": "api",
+           "values": {"id": "api-guid", "name": "api", "memory": "128M"}},
+          {"mode": "managed", "type": "cloudfoundry_app", "name": "worker",
+           "values": {"name": "worker", "memory": "1G", "buildpacks": ["python_buildpack"],
+                      "routes": [{"route": "worker.app.cloud.gov"}],
+                      "service_bindings": [{"service_instance": "my-s3"}]}}
+        ]
+      }]
+    }
+  }
+}`
+
+// TestLoadTerraformState ensures that cloudfoundry provider resources in Terraform state are imported.
+func TestLoadTerraformState(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), terraformMainConfig)
+	writeTestFile(t, filepath.Join(dir, "terraform.tfstate"), testTerraformState)
+	writeTestFile(t, filepath.Join(dir, "show.json"), testTerraformShow)
+
+	conf, err := Load(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	web, ok := conf.Apps["web"]
+	if !ok {
+		t.Fatalf("Terraform state app was not imported. Found: %+v", conf.Apps)
+	}
+	if web.Instances != 2 || web.MemoryMB() != 256 || !web.SSHDisabled || web.HealthCheckType != "http" {
+		t.Fatalf("Terraform state app settings incorrect. Found: %+v", web)
+	}
+	if len(web.Buildpacks) != 1 || web.Buildpacks[0] != "go_buildpack" {
+		t.Fatalf("Terraform state buildpacks incorrect. Found: %+v", web.Buildpacks)
+	}
+	if len(web.Routes) != 1 || web.Routes[0] != "web.app.cloud.gov" {
+		t.Fatalf("Terraform state routes incorrect. Found: %+v", web.Routes)
+	}
+	if len(web.Services) != 1 || web.Services[0] != "my-db" {
+		t.Fatalf("Terraform state services incorrect. Found: %+v", web.Services)
+	}
+
+	worker, ok := conf.Apps["worker"]
+	if !ok {
+		t.Fatalf("Terraform show app in child module was not imported. Found: %+v", conf.Apps)
+	}
+	if worker.MemoryMB() != 1024 || worker.SSHDisabled {
+		t.Fatalf("Terraform show app settings incorrect. Found: %+v", worker)
+	}
+	if len(worker.Routes) != 1 || worker.Routes[0] != "worker.app.cloud.gov" {
+		t.Fatalf("Terraform show routes incorrect. Found: %+v", worker.Routes)
+	}
+	if len(worker.Services) != 1 || worker.Services[0] != "my-s3" {
+		t.Fatalf("Terraform show services incorrect. Found: %+v", worker.Services)
+	}
+
+	if api, ok := conf.Apps["api"]; !ok || len(api.Routes) != 1 || api.Routes[0] != "api.app.cloud.gov" {
+		t.Fatalf("Terraform route destinations were not imported as app routes. Found: %+v", conf.Apps["api"])
+	}
+
+	if space, ok := conf.Spaces["dev"]; !ok || space.AllowSSH || len(conf.Spaces) != 1 {
+		t.Fatalf("Terraform state spaces incorrect. Found: %+v", conf.Spaces)
+	}
+	if _, ok := conf.Apps["legacy"]; ok {
+		t.Fatalf("Terraform data source app was imported. Found: %+v", conf.Apps)
+	}
+	if len(conf.Sources) != 3 {
+		t.Fatalf("Terraform states were not recorded as sources. Found: %+v", conf.Sources)
+	}
+}
+
+// TestTerraformStateInvalid ensures that unreadable Terraform states are load errors.
+func TestTerraformStateInvalid(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), terraformMainConfig)
+	writeTestFile(t, filepath.Join(dir, "terraform.tfstate"), "not json")
+	writeTestFile(t, filepath.Join(dir, "show.json"), testTerraformShow)
+
+	if _, err := Load(filepath.Join(dir, "config.yaml")); err == nil {
+		t.Fatal("Invalid Terraform state loaded without erroring")
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultInitPort            = 8080
+	defaultInitRefreshInterval = time.Minute * 5
+
+	// initConnectAttempts is the number of attempts to connect to Cloud Foundry
+	// before init gives up
+	initConnectAttempts = 3
+)
+
+// runInit implements the 'init' subcommand, which generates a Watchtower config
+// describing every resource currently visible in the Cloud Foundry environment.
+// The generated config is intended to be reviewed and committed as a baseline.
+func runInit(args []string, logger *zap.SugaredLogger) error {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	ccURL := flags.String("api", getEnv("CLOUD_CONTROLLER_URL", ""), "URL of the Cloud Controller to generate the config from. Defaults to $CLOUD_CONTROLLER_URL.")
+	port := flags.Uint("port", defaultInitPort, "Port to set in the generated config.")
+	interval := flags.Duration("refresh-interval", defaultInitRefreshInterval, "Refresh interval to set in the generated config.")
+	output := flags.String("output", "", "Path to write the generated config to. Defaults to stdout.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *ccURL == "" {
+		return errors.New("a cloud controller URL must be provided with -api or CLOUD_CONTROLLER_URL")
+	}
+	if *port > math.MaxUint16 {
+		return fmt.Errorf("port %d is out of range", *port)
+	}
+
+	cache, err := NewCFResourceCache(*ccURL, initConnectAttempts, logger)
+	if err != nil {
+		return err
+	}
+	if !cache.isValid() {
+		return errors.New("failed reading resources from the cloud controller")
+	}
+
+	yamlConfig := buildInitConfig(&cache, config.GlobalConfig{
+		HTTPBindPort:       uint16(*port),
+		RefreshInterval:    *interval,
+		CloudControllerURL: *ccURL,
+	})
+	data := writeInitConfig(&cache, &yamlConfig)
+
+	// Make sure the generated config can be loaded before handing it back
+	if _, err := config.Parse(data); err != nil {
+		return fmt.Errorf("generated config is invalid: %w", err)
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(filepath.Clean(*output), data, 0o600)
+}
+
+// buildInitConfig returns a YAMLConfig allowing exactly the apps, routes and
+// spaces found in the cache, with their current SSH settings. Resources are
+// sorted by name.
+func buildInitConfig(cache *CFResourceCache, global config.GlobalConfig) config.YAMLConfig {
+	appRoutes := cache.getAppRoutes()
+
+	var apps []config.AppEntry
+	for name := range cache.Apps.nameMap {
+		var routes []config.RouteEntry
+		for _, route := range appRoutes[name] {
+			routes = append(routes, config.RouteEntry(route))
+		}
+		apps = append(apps, config.AppEntry{
+			Name:        name,
+			Routes:      routes,
+			SSHDisabled: !cache.Apps.sshMap[name],
+		})
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].Name < apps[j].Name })
+
+	var spaces []config.SpaceEntry
+	for name, space := range cache.Spaces.nameMap {
+		spaces = append(spaces, config.SpaceEntry{Name: name, AllowSSH: space.AllowSSH})
+	}
+	sort.Slice(spaces, func(i, j int) bool { return spaces[i].Name < spaces[j].Name })
+
+	return config.YAMLConfig{
+		GlobalConfig: global,
+		AppConfig:    config.AppConfig{Enabled: true, Apps: apps},
+		SpaceConfig:  config.SpaceConfig{Enabled: true, Spaces: spaces},
+	}
+}
+
+// yamlScalar returns value formatted as a YAML scalar, quoted where necessary
+func yamlScalar(value interface{}) string {
+	out, err := yaml.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%q", fmt.Sprint(value))
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// writeInitConfig formats the YAMLConfig generated by buildInitConfig as a
+// commented config file.
+func writeInitConfig(cache *CFResourceCache, yamlConfig *config.YAMLConfig) []byte {
+	var out bytes.Buffer
+	global := yamlConfig.GlobalConfig
+
+	fmt.Fprintf(&out, "# Watchtower config generated by 'watchtower init' from %s at %s.\n",
+		global.CloudControllerURL, time.Now().UTC().Format(time.RFC3339))
+	out.WriteString("# It allows exactly the resources that were deployed at that time. Review each\n")
+	out.WriteString("# resource before committing this file as the expected state of the environment.\n")
+	out.WriteString("---\n")
+	out.WriteString("global:\n")
+	fmt.Fprintf(&out, "  port: %d\n", global.HTTPBindPort)
+	fmt.Fprintf(&out, "  refresh_interval: %s\n", global.RefreshInterval)
+	fmt.Fprintf(&out, "  cloud_controller_url: %s\n", yamlScalar(global.CloudControllerURL))
+
+	out.WriteString("\n# Every app deployed to the spaces Watchtower can read, with its mapped routes.\n")
+	out.WriteString("apps:\n")
+	fmt.Fprintf(&out, "  enabled: %t\n", yamlConfig.AppConfig.Enabled)
+	out.WriteString("  resources:\n")
+	for _, app := range yamlConfig.AppConfig.Apps {
+		fmt.Fprintf(&out, "    # space: %s\n", appSpaceName(cache, app.Name))
+		fmt.Fprintf(&out, "    - name: %s\n", yamlScalar(app.Name))
+		fmt.Fprintf(&out, "      ssh_disabled: %t\n", app.SSHDisabled)
+		if len(app.Routes) != 0 {
+			out.WriteString("      routes:\n")
+			for _, route := range app.Routes {
+				fmt.Fprintf(&out, "        - %s\n", yamlScalar(string(route)))
+			}
+		}
+	}
+
+	out.WriteString("\n# Every space Watchtower can read, with its SSH setting.\n")
+	out.WriteString("spaces:\n")
+	fmt.Fprintf(&out, "  enabled: %t\n", yamlConfig.SpaceConfig.Enabled)
+	out.WriteString("  resources:\n")
+	for _, space := range yamlConfig.SpaceConfig.Spaces {
+		fmt.Fprintf(&out, "    - name: %s\n", yamlScalar(space.Name))
+		fmt.Fprintf(&out, "      allow_ssh: %t\n", space.AllowSSH)
+	}
+
+	return out.Bytes()
+}
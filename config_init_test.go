@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"github.com/cloudfoundry-community/go-cfclient"
+)
+
+// newInitTestCache returns a CFResourceCache populated with two apps in one space
+func newInitTestCache() CFResourceCache {
+	space := cfclient.Space{Guid: "space-guid", Name: "dev", AllowSSH: true}
+	spaceRelationship := map[string]cfclient.V3ToOneRelationship{
+		"space": {Data: cfclient.V3Relationship{GUID: space.Guid}},
+	}
+	webApp := cfclient.V3App{GUID: "web-guid", Name: "web", Relationships: spaceRelationship}
+	workerApp := cfclient.V3App{GUID: "worker-guid", Name: "worker", Relationships: spaceRelationship}
+	route := cfclient.Route{Guid: "route-guid", Host: "web", DomainGuid: "domain-guid"}
+	mapping := cfclient.RouteMapping{Guid: "mapping-guid", AppGUID: webApp.GUID, RouteGUID: route.Guid}
+
+	return CFResourceCache{
+		Apps: AppCache{
+			Valid:   true,
+			guidMap: map[string]cfclient.V3App{webApp.GUID: webApp, workerApp.GUID: workerApp},
+			nameMap: map[string]cfclient.V3App{webApp.Name: webApp, workerApp.Name: workerApp},
+			sshMap:  map[string]bool{webApp.Name: true, workerApp.Name: false},
+		},
+		Routes: RouteCache{Valid: true, guidMap: map[string]cfclient.Route{route.Guid: route}},
+		RouteMappings: RouteMappingCache{
+			Valid:         true,
+			routeMappings: []cfclient.RouteMapping{mapping},
+			guidMap:       map[string]cfclient.RouteMapping{mapping.Guid: mapping},
+		},
+		SharedDomains: SharedDomainCache{
+			Valid:   true,
+			guidMap: map[string]cfclient.SharedDomain{"domain-guid": {Guid: "domain-guid", Name: "app.cloud.gov"}},
+		},
+		Domains: DomainCache{Valid: true},
+		Spaces: SpaceCache{
+			Valid:   true,
+			guidMap: map[string]cfclient.Space{space.Guid: space},
+			nameMap: map[string]cfclient.Space{space.Name: space},
+		},
+	}
+}
+
+// TestInitConfigRoundTrip ensures that the generated config loads and matches the cached resources.
+func TestInitConfigRoundTrip(t *testing.T) {
+	cache := newInitTestCache()
+	yamlConfig := buildInitConfig(&cache, config.GlobalConfig{
+		HTTPBindPort:       defaultInitPort,
+		RefreshInterval:    time.Minute,
+		CloudControllerURL: "https://api.fr.cloud.gov",
+	})
+	data := writeInitConfig(&cache, &yamlConfig)
+
+	conf, err := config.Parse(data)
+	if err != nil {
+		t.Fatalf("Generated config failed to load: %v\n%s", err, data)
+	}
+
+	apps := conf.Data.AppConfig.Apps
+	if len(apps) != 2 || apps[0].Name != "web" || apps[1].Name != "worker" {
+		t.Fatalf("Generated apps incorrect. Found: %+v", apps)
+	}
+	if len(apps[0].Routes) != 1 || apps[0].Routes[0] != "web.app.cloud.gov" {
+		t.Fatalf("Generated routes incorrect. Found: %+v", apps[0].Routes)
+	}
+	if apps[0].SSHDisabled || !apps[1].SSHDisabled {
+		t.Fatalf("Generated app ssh settings incorrect. Found: %+v", apps)
+	}
+	if space, ok := conf.Spaces["dev"]; !ok || !space.AllowSSH {
+		t.Fatalf("Generated spaces incorrect. Found: %+v", conf.Spaces)
+	}
+	if !strings.Contains(string(data), "# space: dev") {
+		t.Fatalf("Generated config is missing space comments:\n%s", data)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/18F/watchtower/config"
+)
+
+// runLint implements the 'lint' subcommand, which strictly validates a config
+// and prints every problem found in it. An error is returned if any problems
+// are found, so that the command exits non-zero.
+func runLint(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	configPath := flags.String("config", "config.yaml", "Path to the configuration file or directory to lint.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	problems := config.Lint(*configPath)
+	for _, problem := range problems {
+		fmt.Fprintln(out, problem)
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("found %d problems in %s", len(problems), *configPath)
+	}
+	return nil
+}
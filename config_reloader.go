@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"go.uber.org/zap"
+)
+
+// configWatchInterval is how often the config files are checked for modifications
+const configWatchInterval = time.Second * 5
+
+// ConfigReloader watches the Watchtower config files and swaps newly loaded configs
+// into a config.Store. A config that fails to load is rejected and the previously
+// loaded config stays in place.
+type ConfigReloader struct {
+	path        string
+	store       *config.Store
+	fingerprint string
+	logger      *zap.SugaredLogger
+}
+
+// NewConfigReloader starts and returns a ConfigReloader that reloads the config
+// at path whenever any of its files are modified or the process receives a SIGHUP.
+func NewConfigReloader(path string, store *config.Store, logger *zap.SugaredLogger) (*ConfigReloader, error) {
+	if store == nil {
+		return nil, errors.New("config reloader cannot be created with nil store")
+	}
+	if logger == nil {
+		return nil, errors.New("config reloader cannot be created with nil logger")
+	}
+
+	reloader := &ConfigReloader{
+		path:        path,
+		store:       store,
+		fingerprint: configFingerprint(path, store.Get().Sources),
+		logger:      logger.Named("reloader"),
+	}
+	configReloadSuccess.Set(1)
+
+	go reloader.start()
+	return reloader, nil
+}
+
+// configFingerprint summarizes the modification times of the config at path and
+// each of its source files. The directories containing the sources are included
+// so that fragments added alongside existing ones are noticed as well.
+func configFingerprint(path string, sources []string) string {
+	paths := []string{path}
+	for _, source := range sources {
+		paths = append(paths, source, filepath.Dir(source))
+	}
+
+	var fingerprint strings.Builder
+	for _, p := range paths {
+		fingerprint.WriteString(p)
+		if info, err := os.Stat(p); err == nil {
+			fingerprint.WriteString(info.ModTime().String())
+		}
+	}
+	return fingerprint.String()
+}
+
+// start watches for config file modifications and SIGHUP signals, calling
+// .Reload whenever either occurs.
+func (reloader *ConfigReloader) start() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	ticker := time.NewTicker(configWatchInterval)
+	reloader.logger.Infow("watching config for changes", "path", reloader.path)
+
+	for {
+		select {
+		case <-hangup:
+			reloader.logger.Info("received SIGHUP, reloading config")
+		case <-ticker.C:
+			fingerprint := configFingerprint(reloader.path, reloader.store.Get().Sources)
+			if fingerprint == reloader.fingerprint {
+				continue
+			}
+			reloader.fingerprint = fingerprint
+			reloader.logger.Info("config files modified, reloading config")
+		}
+
+		// Errors are logged and exported as metrics by .Reload
+		_ = reloader.Reload()
+	}
+}
+
+// Reload loads the config file and, if it is valid, replaces the config held by
+// the store. Invalid configs are rejected, leaving the current config in place.
+func (reloader *ConfigReloader) Reload() error {
+	conf, err := config.Load(reloader.path)
+	if err != nil {
+		reloader.logger.Errorw("failed reloading config, keeping previous config", "error", err.Error())
+		configReloadSuccess.Set(0)
+		return err
+	}
+
+	current := reloader.store.Get().Data
+	if conf.Data.GlobalConfig.HTTPBindPort != current.GlobalConfig.HTTPBindPort ||
+		conf.Data.GlobalConfig.CloudControllerURL != current.GlobalConfig.CloudControllerURL ||
+		conf.Data.History.Path != current.History.Path {
+		reloader.logger.Warn("changes to port, cloud_controller_url and history path require a restart to take effect")
+	}
+
+	reloader.store.Set(conf)
+	reloader.fingerprint = configFingerprint(reloader.path, conf.Sources)
+	configReloadSuccess.Set(1)
+	reloader.logger.Info("successfully reloaded config")
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/18F/watchtower/config"
+	"go.uber.org/zap"
+)
+
+const reloaderTestConfig = `---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+apps:
+  enabled: true
+  resources:
+    - name: %s`
+
+func writeReloaderTestConfig(t *testing.T, path, data string) {
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed writing test config: %v", err)
+	}
+}
+
+func newTestReloader(t *testing.T, path string) *ConfigReloader {
+	conf, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+	return &ConfigReloader{
+		path:   path,
+		store:  config.NewStore(conf),
+		logger: zap.NewNop().Sugar(),
+	}
+}
+
+// TestReloadValidConfig ensures that a valid config replaces the current config.
+func TestReloadValidConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeReloaderTestConfig(t, path, fmt.Sprintf(reloaderTestConfig, "first-app"))
+	reloader := newTestReloader(t, path)
+
+	writeReloaderTestConfig(t, path, fmt.Sprintf(reloaderTestConfig, "second-app"))
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("Valid config failed to reload: %v", err)
+	}
+	if _, ok := reloader.store.Get().Apps["second-app"]; !ok {
+		t.Fatalf("Reloaded config was not stored. Found: %+v", reloader.store.Get().Apps)
+	}
+}
+
+// TestReloadInvalidConfig ensures that an invalid config is rejected and the previous config kept.
+func TestReloadInvalidConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeReloaderTestConfig(t, path, fmt.Sprintf(reloaderTestConfig, "first-app"))
+	reloader := newTestReloader(t, path)
+
+	writeReloaderTestConfig(t, path, "This is not a config")
+	if err := reloader.Reload(); err == nil {
+		t.Fatal("Invalid config reloaded without erroring")
+	}
+	if _, ok := reloader.store.Get().Apps["first-app"]; !ok {
+		t.Fatalf("Previous config was not kept. Found: %+v", reloader.store.Get().Apps)
+	}
+}
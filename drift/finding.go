@@ -0,0 +1,217 @@
+// Package drift models the differences found between a Cloud Foundry
+// environment and the Watchtower config.
+package drift
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kind identifies the type of drift a Finding reports
+type Kind string
+
+// Kinds of drift reported by the drift detector
+const (
+	UnknownApp   Kind = "unknown_app"
+	MissingApp   Kind = "missing_app"
+	UnknownRoute Kind = "unknown_route"
+	MissingRoute Kind = "missing_route"
+	AppSSH       Kind = "app_ssh"
+	AppSettings  Kind = "app_settings"
+	AppLabels    Kind = "app_labels"
+	SpaceSSH     Kind = "space_ssh"
+	SpaceLabels  Kind = "space_labels"
+)
+
+// Kinds lists every Kind of drift
+var Kinds = []Kind{UnknownApp, MissingApp, UnknownRoute, MissingRoute, AppSSH, AppSettings, AppLabels, SpaceSSH, SpaceLabels}
+
+// IsSpace returns true if drift of this Kind is about a space rather than an app
+func (k Kind) IsSpace() bool {
+	return k == SpaceSSH || k == SpaceLabels
+}
+
+// Exemption describes the config exemption that accepts a Finding
+type Exemption struct {
+	Reason  string    `json:"reason" yaml:"reason"`
+	Ticket  string    `json:"ticket,omitempty" yaml:"ticket,omitempty"`
+	Expires time.Time `json:"expires" yaml:"expires"`
+}
+
+// AuditEvent describes the Cloud Controller audit event of the change that
+// caused a Finding
+type AuditEvent struct {
+	Type string `json:"type" yaml:"type"`
+
+	// Actor is the name of the user or UAA client that made the change
+	Actor     string    `json:"actor" yaml:"actor"`
+	ActorType string    `json:"actor_type" yaml:"actor_type"`
+	Time      time.Time `json:"time" yaml:"time"`
+}
+
+// Remediation describes an action taken, or to be taken, to resolve a Finding
+type Remediation struct {
+	Action string `json:"action" yaml:"action"`
+
+	// Route is the route the action unmaps or deletes, if any
+	Route string `json:"route,omitempty" yaml:"route,omitempty"`
+
+	// Status is the outcome of the action in the most recent run, or "scheduled"
+	// if the action will be taken once its grace period ends at Time
+	Status string    `json:"status" yaml:"status"`
+	Time   time.Time `json:"time" yaml:"time"`
+}
+
+// Finding is a single difference between the environment and the config
+type Finding struct {
+	Kind Kind `json:"kind" yaml:"kind"`
+
+	// Resource is the name of the app or space the finding is about. For missing
+	// apps, it is the ID of the config entry that was not matched.
+	Resource string `json:"resource" yaml:"resource"`
+
+	// Entry is the ID of the config entry matching the resource, if there is one
+	Entry string `json:"entry,omitempty" yaml:"entry,omitempty"`
+
+	// Space is the name of the space an app is deployed to, if known
+	Space string `json:"space,omitempty" yaml:"space,omitempty"`
+
+	// Route is the unknown or missing route, of the form <hostname>.<domain>
+	Route string `json:"route,omitempty" yaml:"route,omitempty"`
+
+	// Routes are the routes mapped to an unknown app
+	Routes []string `json:"routes,omitempty" yaml:"routes,omitempty"`
+
+	// SSHEnabled is whether ssh is currently enabled for an app or space
+	SSHEnabled *bool `json:"ssh_enabled,omitempty" yaml:"ssh_enabled,omitempty"`
+
+	// Details are the drifted settings or missing labels of the resource
+	Details []string `json:"details,omitempty" yaml:"details,omitempty"`
+
+	// FirstSeen is when the finding was first reported by its check, in the
+	// current run of Watchtower
+	FirstSeen time.Time `json:"first_seen" yaml:"first_seen"`
+
+	// Severity is the severity of the check that reported the finding
+	Severity string `json:"severity,omitempty" yaml:"severity,omitempty"`
+
+	// AuditEvent is the audit event of the change that caused the finding, if
+	// one was found
+	AuditEvent *AuditEvent `json:"audit_event,omitempty" yaml:"audit_event,omitempty"`
+
+	// Remediations are the actions of the most recent run to resolve the finding
+	Remediations []Remediation `json:"remediations,omitempty" yaml:"remediations,omitempty"`
+
+	// Exemption is set when the finding is accepted by a config exemption. Exempted
+	// findings are not counted as violations.
+	Exemption *Exemption `json:"exemption,omitempty" yaml:"exemption,omitempty"`
+}
+
+// Key uniquely identifies the Finding among the findings of a single run
+func (f *Finding) Key() string {
+	key := string(f.Kind) + ":" + f.Resource
+	if f.Route != "" {
+		key += ":" + f.Route
+	}
+	return key
+}
+
+// Active returns the findings that are not exempted
+func Active(findings []Finding) []Finding {
+	var active []Finding
+	for _, finding := range findings {
+		if finding.Exemption == nil {
+			active = append(active, finding)
+		}
+	}
+	return active
+}
+
+// Sort orders findings by kind, resource and route
+func Sort(findings []Finding) {
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].Key() < findings[j].Key()
+	})
+}
+
+// Findings provides a concurrency-safe way of accessing the findings of the most
+// recent run of each drift check.
+type Findings struct {
+	checks  map[string][]Finding
+	updated time.Time
+	mut     sync.RWMutex
+}
+
+// NewFindings returns an empty Findings
+func NewFindings() *Findings {
+	return &Findings{checks: make(map[string][]Finding)}
+}
+
+// Set replaces the findings of the named check. Findings that were already
+// reported by the check keep the time they were first seen.
+func (f *Findings) Set(check string, findings []Finding) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	now := time.Now()
+	firstSeen := make(map[string]time.Time)
+	for _, finding := range f.checks[check] {
+		firstSeen[finding.Key()] = finding.FirstSeen
+	}
+	for i := range findings {
+		if seen, ok := firstSeen[findings[i].Key()]; ok {
+			findings[i].FirstSeen = seen
+		} else {
+			findings[i].FirstSeen = now
+		}
+	}
+
+	f.checks[check] = findings
+	f.updated = now
+}
+
+// SetRemediations sets the remediations of the current findings, by finding
+// key. Findings that are not listed have their remediations removed.
+func (f *Findings) SetRemediations(remediations map[string][]Remediation) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	for _, findings := range f.checks {
+		for i := range findings {
+			findings[i].Remediations = remediations[findings[i].Key()]
+		}
+	}
+}
+
+// Clear removes the findings of checks that are not listed in enabled, such as
+// checks disabled by a reloaded config.
+func (f *Findings) Clear(enabled []string) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	keep := make(map[string]bool)
+	for _, check := range enabled {
+		keep[check] = true
+	}
+	for check := range f.checks {
+		if !keep[check] {
+			delete(f.checks, check)
+		}
+	}
+}
+
+// All returns the current findings of every check, sorted, along with the time
+// they were last updated.
+func (f *Findings) All() ([]Finding, time.Time) {
+	f.mut.RLock()
+	var findings []Finding
+	for _, checkFindings := range f.checks {
+		findings = append(findings, checkFindings...)
+	}
+	updated := f.updated
+	f.mut.RUnlock()
+
+	Sort(findings)
+	return findings, updated
+}
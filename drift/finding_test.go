@@ -0,0 +1,43 @@
+package drift
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/18F/watchtower/config"
+)
+
+// TestExemptionKinds ensures that every Kind can be exempted in the config.
+func TestExemptionKinds(t *testing.T) {
+	field, _ := reflect.TypeOf(config.ExemptionEntry{}).FieldByName("Kind")
+	allowed := strings.Split(field.Tag.Get("enum"), ",")
+	if len(allowed) != len(Kinds) {
+		t.Fatalf("Exemption kinds %v do not match drift kinds %v", allowed, Kinds)
+	}
+	for _, kind := range Kinds {
+		if !slices.Contains(allowed, string(kind)) {
+			t.Fatalf("Drift kind %q cannot be exempted in the config", kind)
+		}
+	}
+}
+
+// TestFindingsFirstSeen ensures that findings keep the time they were first seen across runs.
+func TestFindingsFirstSeen(t *testing.T) {
+	findings := NewFindings()
+	findings.Set("apps", []Finding{{Kind: UnknownApp, Resource: "rogue"}})
+	first, _ := findings.All()
+
+	time.Sleep(time.Millisecond)
+	findings.Set("apps", []Finding{{Kind: UnknownApp, Resource: "rogue"}, {Kind: UnknownApp, Resource: "debug"}})
+	second, _ := findings.All()
+
+	if len(second) != 2 || !second[1].FirstSeen.Equal(first[0].FirstSeen) {
+		t.Fatalf("Repeated finding did not keep its first seen time. Found: %+v", second)
+	}
+	if !second[0].FirstSeen.After(first[0].FirstSeen) {
+		t.Fatalf("New finding was not given a new first seen time. Found: %+v", second)
+	}
+}
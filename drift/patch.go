@@ -0,0 +1,216 @@
+package drift
+
+import (
+	"slices"
+
+	"github.com/18F/watchtower/config"
+)
+
+// Patch is a minimal set of changes to the config that makes it match the
+// environment: unknown apps and routes are added, missing apps and routes are
+// removed, and app and space ssh settings are flipped. Changed settings and
+// missing labels must be fixed on the foundation, so they are not patched.
+//
+// A Patch lists entries rather than a diff, since the loaded config may be
+// merged from several files, manifests and Terraform states, with environment
+// variables expanded, so it cannot be diffed against any single file.
+type Patch struct {
+	Apps   AppsPatch   `yaml:"apps"`
+	Spaces SpacesPatch `yaml:"spaces"`
+}
+
+// AppsPatch lists the app entries to add, replace or remove. Updated entries
+// are matched by name.
+type AppsPatch struct {
+	Add    []config.AppEntry `yaml:"add,omitempty"`
+	Update []config.AppEntry `yaml:"update,omitempty"`
+	Remove []string          `yaml:"remove,omitempty"`
+}
+
+// SpacesPatch lists the space entries to add or replace. Updated entries are
+// matched by name.
+type SpacesPatch struct {
+	Add    []config.SpaceEntry `yaml:"add,omitempty"`
+	Update []config.SpaceEntry `yaml:"update,omitempty"`
+}
+
+// entryState tracks how an entry has been changed by a Patch
+type entryState int
+
+const (
+	unchanged entryState = iota
+	added
+	updated
+	removed
+)
+
+// appPatcher applies findings to a copy of the app entries of a config
+type appPatcher struct {
+	apps   []config.AppEntry
+	states []entryState
+}
+
+// find returns the index of the entry with the given ID, or -1
+func (p *appPatcher) find(id string) int {
+	for i := range p.apps {
+		if p.states[i] != removed && p.apps[i].ID() == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// exact returns the index of the entry matching only the named app. If the app
+// is matched by a pattern entry, an exact copy of that entry is added so that
+// other apps matched by the pattern are unaffected.
+func (p *appPatcher) exact(name, entryID string) int {
+	if i := p.find(name); i != -1 && !p.apps[i].IsPattern() {
+		return i
+	}
+	entry := config.AppEntry{Name: name}
+	if i := p.find(entryID); i != -1 {
+		entry = p.apps[i].ExactCopy(name)
+	}
+	return p.add(entry)
+}
+
+// add appends a new entry, returning its index
+func (p *appPatcher) add(entry config.AppEntry) int {
+	p.apps = append(p.apps, entry)
+	p.states = append(p.states, added)
+	return len(p.apps) - 1
+}
+
+// update marks the entry at index i as changed
+func (p *appPatcher) update(i int) {
+	if p.states[i] == unchanged {
+		p.states[i] = updated
+	}
+}
+
+// spacePatcher applies findings to a copy of the space entries of a config
+type spacePatcher struct {
+	spaces []config.SpaceEntry
+	states []entryState
+}
+
+// exact returns the index of the entry matching only the named space, adding
+// an exact copy of its pattern entry if necessary.
+func (p *spacePatcher) exact(name, entryID string) int {
+	var source = -1
+	for i := range p.spaces {
+		if p.spaces[i].ID() == name && !p.spaces[i].IsPattern() {
+			return i
+		}
+		if p.spaces[i].ID() == entryID {
+			source = i
+		}
+	}
+
+	entry := config.SpaceEntry{Name: name}
+	if source != -1 {
+		entry = p.spaces[source].ExactCopy(name)
+	}
+	p.spaces = append(p.spaces, entry)
+	p.states = append(p.states, added)
+	return len(p.spaces) - 1
+}
+
+// NewPatch returns the Patch that makes the config data match the environment
+// described by findings. data is not modified.
+func NewPatch(data config.YAMLConfig, findings []Finding) Patch {
+	findings = slices.Clone(findings)
+	Sort(findings)
+
+	apps := appPatcher{
+		apps:   slices.Clone(data.AppConfig.Apps),
+		states: make([]entryState, len(data.AppConfig.Apps)),
+	}
+	spaces := spacePatcher{
+		spaces: slices.Clone(data.SpaceConfig.Spaces),
+		states: make([]entryState, len(data.SpaceConfig.Spaces)),
+	}
+
+	for _, finding := range findings {
+		switch finding.Kind {
+		case UnknownApp:
+			entry := config.AppEntry{Name: finding.Resource}
+			for _, route := range finding.Routes {
+				entry.Routes = append(entry.Routes, config.RouteEntry(route))
+			}
+			if finding.SSHEnabled != nil {
+				entry.SSHDisabled = !*finding.SSHEnabled
+			}
+			apps.add(entry)
+
+		case MissingApp:
+			if i := apps.find(finding.Resource); i != -1 {
+				apps.states[i] = removed
+			}
+
+		case UnknownRoute:
+			i := apps.exact(finding.Resource, finding.Entry)
+			route := config.RouteEntry(finding.Route)
+			if !slices.Contains(apps.apps[i].Routes, route) {
+				apps.apps[i].Routes = append(slices.Clone(apps.apps[i].Routes), route)
+				apps.update(i)
+			}
+
+		case MissingRoute:
+			if i := apps.find(finding.Entry); i != -1 {
+				routes := slices.DeleteFunc(slices.Clone(apps.apps[i].Routes), func(route config.RouteEntry) bool {
+					return string(route) == finding.Route
+				})
+				if len(routes) != len(apps.apps[i].Routes) {
+					apps.apps[i].Routes = routes
+					apps.update(i)
+				}
+			}
+
+		case AppSSH:
+			if finding.SSHEnabled != nil {
+				i := apps.exact(finding.Resource, finding.Entry)
+				apps.apps[i].SSHDisabled = !*finding.SSHEnabled
+				apps.update(i)
+			}
+
+		case SpaceSSH:
+			if finding.SSHEnabled != nil {
+				i := spaces.exact(finding.Resource, finding.Entry)
+				spaces.spaces[i].AllowSSH = *finding.SSHEnabled
+				if spaces.states[i] == unchanged {
+					spaces.states[i] = updated
+				}
+			}
+		}
+	}
+
+	var patch Patch
+	for i, app := range apps.apps {
+		switch apps.states[i] {
+		case added:
+			patch.Apps.Add = append(patch.Apps.Add, app)
+		case updated:
+			patch.Apps.Update = append(patch.Apps.Update, app)
+		case removed:
+			patch.Apps.Remove = append(patch.Apps.Remove, app.ID())
+		}
+	}
+
+	for i, space := range spaces.spaces {
+		switch spaces.states[i] {
+		case added:
+			patch.Spaces.Add = append(patch.Spaces.Add, space)
+		case updated:
+			patch.Spaces.Update = append(patch.Spaces.Update, space)
+		}
+	}
+
+	return patch
+}
+
+// IsEmpty returns true if the Patch makes no changes to the config
+func (p *Patch) IsEmpty() bool {
+	return len(p.Apps.Add) == 0 && len(p.Apps.Update) == 0 && len(p.Apps.Remove) == 0 &&
+		len(p.Spaces.Add) == 0 && len(p.Spaces.Update) == 0
+}
@@ -0,0 +1,96 @@
+package drift
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/18F/watchtower/config"
+)
+
+const patchTestConfig = `---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+apps:
+  enabled: true
+  resources:
+    - name: web
+      routes:
+        - web.app.cloud.gov
+        - old.app.cloud.gov
+    - name: worker-*
+      match: glob
+      ssh_disabled: true
+    - name: retired
+spaces:
+  enabled: true
+  resources:
+    - name: dev
+      allow_ssh: true`
+
+// TestNewPatch ensures that a patch adds unknown resources, removes missing ones and flips ssh settings.
+func TestNewPatch(t *testing.T) {
+	conf, err := config.Parse([]byte(patchTestConfig))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	enabled, disabled := true, false
+	findings := []Finding{
+		{Kind: UnknownApp, Resource: "new-app", Routes: []string{"new.app.cloud.gov"}, SSHEnabled: &disabled},
+		{Kind: MissingApp, Resource: "retired", Entry: "retired"},
+		{Kind: UnknownRoute, Resource: "web", Entry: "web", Route: "www.app.cloud.gov"},
+		{Kind: MissingRoute, Resource: "web", Entry: "web", Route: "old.app.cloud.gov"},
+		{Kind: AppSSH, Resource: "worker-1", Entry: "worker-*", SSHEnabled: &enabled},
+		{Kind: SpaceSSH, Resource: "dev", Entry: "dev", SSHEnabled: &disabled},
+		{Kind: AppSettings, Resource: "web", Entry: "web", Details: []string{"instances"}},
+	}
+	patch := NewPatch(conf.Data, findings)
+
+	if len(patch.Apps.Add) != 2 || patch.Apps.Add[0].Name != "worker-1" || patch.Apps.Add[1].Name != "new-app" {
+		t.Fatalf("Added apps incorrect. Found: %+v", patch.Apps.Add)
+	}
+	if patch.Apps.Add[0].SSHDisabled || patch.Apps.Add[0].IsPattern() {
+		t.Fatalf("Pattern app was not copied into an exact entry with ssh enabled. Found: %+v", patch.Apps.Add[0])
+	}
+	if !patch.Apps.Add[1].SSHDisabled || len(patch.Apps.Add[1].Routes) != 1 {
+		t.Fatalf("Unknown app added incorrectly. Found: %+v", patch.Apps.Add[1])
+	}
+	if len(patch.Apps.Update) != 1 || strings.Join(routeStrings(patch.Apps.Update[0].Routes), ",") != "web.app.cloud.gov,www.app.cloud.gov" {
+		t.Fatalf("Updated apps incorrect. Found: %+v", patch.Apps.Update)
+	}
+	if len(patch.Apps.Remove) != 1 || patch.Apps.Remove[0] != "retired" {
+		t.Fatalf("Removed apps incorrect. Found: %+v", patch.Apps.Remove)
+	}
+	if len(patch.Spaces.Update) != 1 || patch.Spaces.Update[0].AllowSSH {
+		t.Fatalf("Updated spaces incorrect. Found: %+v", patch.Spaces.Update)
+	}
+
+	// The original config must not be modified
+	if original := conf.Data.AppConfig.Apps[0]; len(original.Routes) != 2 || original.Routes[1] != "old.app.cloud.gov" {
+		t.Fatalf("Patch modified the original config. Found: %+v", original)
+	}
+}
+
+// TestEmptyPatch ensures that no findings produce an empty patch.
+func TestEmptyPatch(t *testing.T) {
+	conf, err := config.Parse([]byte(patchTestConfig))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	patch := NewPatch(conf.Data, nil)
+	if !patch.IsEmpty() {
+		t.Fatalf("Patch without findings is not empty. Found: %+v", patch)
+	}
+}
+
+// routeStrings converts routes to strings
+func routeStrings(routes []config.RouteEntry) []string {
+	var strs []string
+	for _, route := range routes {
+		strs = append(strs, string(route))
+	}
+	return strs
+}
@@ -3,41 +3,79 @@ package main
 import (
 	"errors"
 	"log"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+	"github.com/18F/watchtower/history"
+	"github.com/18F/watchtower/notify"
+	"github.com/18F/watchtower/remediation"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
 // Detector is used to find drift between the deployed Cloud Foundry resources
 // and those in the provided config allow list.
 type Detector struct {
-	cache  CFResourceCache
-	config config.Config
-	logger *zap.SugaredLogger
+	cache      CFResourceCache
+	config     *config.Store
+	findings   *drift.Findings
+	dispatcher *notify.Dispatcher
+	history    *history.Store
+	audit      *AuditCorrelator
+	remediator *remediation.Remediator
+	logger     *zap.SugaredLogger
 }
 
-// NewDetector starts and returns a new default Detector
-func NewDetector(config *config.Config, logger *zap.SugaredLogger) (Detector, error) {
-	if config == nil {
+// validationCheck is a named drift check. Each check records its findings under
+// its name, and returns false if it was skipped, such as when the resources it
+// checks could not be fetched.
+type validationCheck struct {
+	name string
+	run  func(*config.Config) bool
+}
+
+// NewDetector starts and returns a new default Detector. historyStore may be nil
+// if drift history is not recorded.
+func NewDetector(store *config.Store, findings *drift.Findings, dispatcher *notify.Dispatcher, historyStore *history.Store,
+	remediator *remediation.Remediator, logger *zap.SugaredLogger) (Detector, error) {
+	if store == nil {
 		return Detector{}, errors.New("detector cannot be created with nil config")
 	}
+	if findings == nil {
+		return Detector{}, errors.New("detector cannot be created with nil findings")
+	}
+	if dispatcher == nil {
+		return Detector{}, errors.New("detector cannot be created with nil dispatcher")
+	}
+	if remediator == nil {
+		return Detector{}, errors.New("detector cannot be created with nil remediator")
+	}
 	if logger == nil {
 		return Detector{}, errors.New("Detector cannot be created with nil logger")
 	}
 	logger = logger.Named("detector")
 
-	resourceCache, err := NewCFResourceCache(config.Data.GlobalConfig.CloudControllerURL, logger)
+	// Retry until the Cloud Foundry client is created, rather than exiting while
+	// the Cloud Controller or UAA are unavailable
+	resourceCache, err := NewCFResourceCache(store.Get().Data.GlobalConfig.CloudControllerURL, 0, logger)
 	if err != nil {
 		logger.Error("drift detector failed to create resource cache", "error", err.Error())
 		return Detector{}, err
 	}
 	detector := Detector{
-		cache:  resourceCache,
-		config: *config,
-		logger: logger,
+		cache:      resourceCache,
+		config:     store,
+		findings:   findings,
+		dispatcher: dispatcher,
+		history:    historyStore,
+		audit:      NewAuditCorrelator(logger),
+		remediator: remediator,
+		logger:     logger,
 	}
 
 	// Call .Validate() before returning the detector so that exported metrics aren't
@@ -51,27 +89,127 @@ func NewDetector(config *config.Config, logger *zap.SugaredLogger) (Detector, er
 
 // Start the Detector, calling .Validate every DetectionInterval
 func (detector *Detector) start() {
-	interval := detector.config.Data.GlobalConfig.RefreshInterval
+	interval := detector.config.Get().Data.GlobalConfig.RefreshInterval
 	ticker := time.NewTicker(interval)
 	detector.logger.Infow("starting detector", "refresh interval", interval.String())
 
 	for range ticker.C {
 		detector.cache.Refresh()
 		detector.Validate()
+
+		// Pick up refresh interval changes from reloaded configs
+		if newInterval := detector.config.Get().Data.GlobalConfig.RefreshInterval; newInterval != interval {
+			interval = newInterval
+			ticker.Reset(interval)
+			detector.logger.Infow("updated detector refresh interval", "refresh interval", interval.String())
+		}
+	}
+}
+
+// exemptionWarningPeriod is how long before expiring an exemption is reported as expiring
+const exemptionWarningPeriod = 7 * 24 * time.Hour
+
+// Names of the drift checks, under which their findings are recorded
+const (
+	appsCheck        = "apps"
+	appRoutesCheck   = "app_routes"
+	appSSHCheck      = "app_ssh"
+	appSettingsCheck = "app_settings"
+	appLabelsCheck   = "app_labels"
+	spacesCheck      = "spaces"
+	spaceLabelsCheck = "space_labels"
+)
+
+// checkGauges are the violation gauges exported by each drift check
+var checkGauges = map[string][]*prometheus.GaugeVec{
+	appsCheck:        {totalUnknownApps, totalMissingApps},
+	appRoutesCheck:   {totalUnknownRoutes, totalMissingRoutes},
+	appSSHCheck:      {totalAppSSHViolations},
+	appSettingsCheck: {totalAppSettingsViolations},
+	appLabelsCheck:   {totalAppLabelViolations},
+	spacesCheck:      {totalSpaceSSHViolations},
+	spaceLabelsCheck: {totalSpaceLabelViolations},
+}
+
+// checkKinds are the kinds of drift found by each drift check
+var checkKinds = map[string][]drift.Kind{
+	appsCheck:        {drift.UnknownApp, drift.MissingApp},
+	appRoutesCheck:   {drift.UnknownRoute, drift.MissingRoute},
+	appSSHCheck:      {drift.AppSSH},
+	appSettingsCheck: {drift.AppSettings},
+	appLabelsCheck:   {drift.AppLabels},
+	spacesCheck:      {drift.SpaceSSH},
+	spaceLabelsCheck: {drift.SpaceLabels},
+}
+
+// setViolationGauge sets the value of a violation gauge for the given severity,
+// removing the values previously exported for other severities.
+func setViolationGauge(gauge *prometheus.GaugeVec, severity string, value float64) {
+	for _, other := range config.Severities {
+		if other != severity {
+			gauge.DeleteLabelValues(other)
+		}
 	}
+	gauge.WithLabelValues(severity).Set(value)
 }
 
-func (detector *Detector) enabledValidationFunctions() []func(*sync.WaitGroup) {
-	validationFunctions := []func(*sync.WaitGroup){}
+// setActorViolationGauge sets a violation gauge with an actor label to the number
+// of active findings of the given kind caused by each actor. When the actor label
+// is disabled, or the actor of a finding is not known, the finding is counted
+// with an empty actor.
+func setActorViolationGauge(gauge *prometheus.GaugeVec, severity string, kind drift.Kind, findings []drift.Finding, actorLabel bool) {
+	counts := map[string]float64{"": 0}
+	for _, finding := range drift.Active(findings) {
+		if finding.Kind != kind {
+			continue
+		}
+		actor := ""
+		if actorLabel && finding.AuditEvent != nil {
+			actor = finding.AuditEvent.Actor
+		}
+		counts[actor]++
+	}
+
+	gauge.Reset()
+	for actor, count := range counts {
+		gauge.WithLabelValues(severity, actor).Set(count)
+	}
+}
+
+// correlate sets the audit event of the change that caused a finding, unless
+// audit event correlation is disabled
+func (detector *Detector) correlate(conf *config.Config, finding *drift.Finding, targetGUID, eventType, routeGUID string) {
+	if detector.audit == nil || !conf.Data.AuditEvents.Correlate() {
+		return
+	}
+	finding.AuditEvent = detector.audit.Find(finding, targetGUID, eventType, routeGUID)
+}
+
+func (detector *Detector) enabledValidationFunctions(conf *config.Config) []validationCheck {
+	validationFunctions := []validationCheck{}
+	checks := &conf.Data.Checks
+
+	add := func(name string, run func(*config.Config) bool) {
+		if checks.Enabled(name) {
+			validationFunctions = append(validationFunctions, validationCheck{name, run})
+		}
+	}
 
-	if detector.config.Data.AppConfig.Enabled {
-		validationFunctions = append(validationFunctions, detector.validateApps)
-		validationFunctions = append(validationFunctions, detector.validateAppRoutes)
-		validationFunctions = append(validationFunctions, detector.validateAppSSH)
+	if conf.Data.AppConfig.Enabled {
+		add(appsCheck, detector.validateApps)
+		add(appRoutesCheck, detector.validateAppRoutes)
+		add(appSSHCheck, detector.validateAppSSH)
+		add(appSettingsCheck, detector.validateAppSettings)
+		if len(conf.Data.AppConfig.RequiredLabels) != 0 {
+			add(appLabelsCheck, detector.validateAppLabels)
+		}
 	}
 
-	if detector.config.Data.SpaceConfig.Enabled {
-		validationFunctions = append(validationFunctions, detector.validateSpaces)
+	if conf.Data.SpaceConfig.Enabled {
+		add(spacesCheck, detector.validateSpaces)
+		if len(conf.Data.SpaceConfig.RequiredLabels) != 0 {
+			add(spaceLabelsCheck, detector.validateSpaceLabels)
+		}
 	}
 
 	return validationFunctions
@@ -83,40 +221,157 @@ func (detector *Detector) Validate() {
 	// Parallelize calls to validateX using goroutines and a sync.WaitGroup
 	var waitgroup sync.WaitGroup
 
-	validationFunctions := detector.enabledValidationFunctions()
+	// Take a snapshot of the config so that every check in this run validates
+	// against the same config, even if it is reloaded mid-run.
+	conf := detector.config.Get()
+	validationFunctions := detector.enabledValidationFunctions(&conf)
+
+	// Drop the findings and violation gauges of checks disabled by a reloaded config
+	var enabledChecks []string
+	var enabledKinds []drift.Kind
+	for _, check := range validationFunctions {
+		enabledChecks = append(enabledChecks, check.name)
+		enabledKinds = append(enabledKinds, checkKinds[check.name]...)
+	}
+	detector.findings.Clear(enabledChecks)
+	for check, gauges := range checkGauges {
+		if !slices.Contains(enabledChecks, check) {
+			for _, gauge := range gauges {
+				gauge.Reset()
+			}
+		}
+	}
 
 	waitgroup.Add(len(validationFunctions))
 
-	for _, function := range validationFunctions {
-		go function(&waitgroup)
+	completed := make([]bool, len(validationFunctions))
+	for i, check := range validationFunctions {
+		go func(i int, check validationCheck) {
+			defer waitgroup.Done()
+			completed[i] = check.run(&conf)
+		}(i, check)
 	}
 
 	waitgroup.Wait()
+	detector.updateExemptionMetrics(&conf)
+
+	// Findings of checks skipped in this run are neither notified nor recorded as
+	// resolved, since they may still be present
+	var checkedKinds []drift.Kind
+	for i, check := range validationFunctions {
+		if completed[i] {
+			checkedKinds = append(checkedKinds, checkKinds[check.name]...)
+		}
+	}
+
+	findings, _ := detector.findings.All()
+	if detector.audit != nil {
+		detector.audit.Prune(findings)
+	}
+	detector.remediate(&conf, findings)
+
+	// Notify about drift that appeared or resolved during this run
+	findings, _ = detector.findings.All()
+	detector.dispatcher.Update(&conf, findings, enabledKinds, checkedKinds)
+
+	if detector.history != nil {
+		if err := detector.history.Update(&conf, findings, enabledKinds, checkedKinds); err != nil {
+			detector.logger.Errorw("failed recording drift history", "error", err.Error())
+		}
+	}
+}
+
+// resourceLabels returns the CF metadata labels of the app or space a finding is about
+func (detector *Detector) resourceLabels(finding *drift.Finding) map[string]string {
+	if finding.Kind.IsSpace() {
+		return detector.cache.Spaces.labelMap[finding.Resource]
+	}
+	return detector.cache.Apps.nameMap[finding.Resource].Metadata.Labels
+}
+
+// recordFindings sets the severity of the named check on its findings, marks the
+// findings accepted by config exemptions, records the findings, and returns the
+// number of findings of each kind that are not exempted.
+func (detector *Detector) recordFindings(check string, findings []drift.Finding, conf *config.Config) map[drift.Kind]int {
+	now := time.Now()
+	severity := conf.Data.Checks.Severity(check)
+	active := make(map[drift.Kind]int)
+	for i := range findings {
+		finding := &findings[i]
+		finding.Severity = severity
+		exemption, ok := conf.FindExemption(string(finding.Kind), finding.Resource, detector.resourceLabels(finding), now)
+		if !ok {
+			active[finding.Kind]++
+			continue
+		}
+		finding.Exemption = &drift.Exemption{
+			Reason:  exemption.Reason,
+			Ticket:  exemption.Ticket,
+			Expires: exemption.ExpiresAt(),
+		}
+	}
+
+	detector.findings.Set(check, findings)
+	return active
+}
+
+// updateExemptionMetrics exports the number of exempted findings, and the number
+// of exemptions that expire within the exemption warning period.
+func (detector *Detector) updateExemptionMetrics(conf *config.Config) {
+	findings, _ := detector.findings.All()
+	totalExemptedFindings.Set(float64(len(findings) - len(drift.Active(findings))))
+
+	now := time.Now()
+	var expiring float64
+	for _, exemption := range conf.Data.Exemptions {
+		if expires := exemption.ExpiresAt(); now.Before(expires) && expires.Before(now.Add(exemptionWarningPeriod)) {
+			expiring++
+		}
+	}
+	totalExpiringExemptions.Set(expiring)
+}
+
+// isAppDeployed returns true if any deployed app matches the given AppEntry
+func (detector *Detector) isAppDeployed(app *config.AppEntry) bool {
+	if !app.IsPattern() {
+		_, ok := detector.cache.Apps.nameMap[app.Name]
+		return ok
+	}
+	for name, deployedApp := range detector.cache.Apps.nameMap {
+		if app.Matches(name, deployedApp.Metadata.Labels) {
+			return true
+		}
+	}
+	return false
 }
 
 // getMissingRoutes will return a slice of strings representing missing routes in the form
-// <app_name>:<app_hostname>.<app_domain>
-func (detector *Detector) getMissingRoutes() []string {
+// <app_name>:<app_hostname>.<app_domain>, along with the matching findings
+func (detector *Detector) getMissingRoutes(conf *config.Config) ([]string, []drift.Finding) {
 	var missingRoutes []string
-	for name, app := range detector.config.Apps {
-		_, appExists := detector.cache.Apps.nameMap[name]
+	var findings []drift.Finding
+	for id, app := range conf.Apps {
+		appExists := detector.isAppDeployed(&app)
 		if (app.Optional && appExists) || !app.Optional {
 			for _, route := range app.Routes {
 				_, ok := detector.cache.findRouteByURL(route.Host(), route.Domain())
 				if !ok {
-					missingRoutes = append(missingRoutes, app.Name+":"+route.Host()+"."+route.Domain())
+					routeURL := route.Host() + "." + route.Domain()
+					missingRoutes = append(missingRoutes, app.Name+":"+routeURL)
+					findings = append(findings, drift.Finding{Kind: drift.MissingRoute, Resource: id, Entry: id, Route: routeURL})
 				}
 			}
 		}
 	}
 
-	return missingRoutes
+	return missingRoutes, findings
 }
 
 // getUnknownRoutes will return a slice of strings representing unknown routes in the form
-// <app_name>:<app_hostname>.<app_domain>
-func (detector *Detector) getUnknownRoutes() []string {
+// <app_name>:<app_hostname>.<app_domain>, along with the matching findings
+func (detector *Detector) getUnknownRoutes(conf *config.Config) ([]string, []drift.Finding) {
 	var unknownRoutes []string
+	var findings []drift.Finding
 	for _, mapping := range detector.cache.RouteMappings.routeMappings {
 		app, route, domainName, err := detector.cache.getMappingResources(mapping.Guid)
 		if err != nil {
@@ -124,7 +379,7 @@ func (detector *Detector) getUnknownRoutes() []string {
 		}
 
 		// configApp is the AppEntry for this V3App
-		configApp, ok := detector.config.Apps[app.Name]
+		configApp, ok := conf.FindApp(app.Name, app.Metadata.Labels)
 		if !ok {
 			// The app is an 'unknown' app. There is a route mapped to it, but it is not found in the config.
 			continue
@@ -133,26 +388,33 @@ func (detector *Detector) getUnknownRoutes() []string {
 		var routeURL = route.Host + "." + domainName
 		if !configApp.ContainsRoute(routeURL) {
 			unknownRoutes = append(unknownRoutes, app.Name+":"+routeURL)
+			finding := drift.Finding{
+				Kind:     drift.UnknownRoute,
+				Resource: app.Name,
+				Entry:    configApp.ID(),
+				Space:    appSpaceName(&detector.cache, app.Name),
+				Route:    routeURL,
+			}
+			detector.correlate(conf, &finding, app.GUID, appMapRouteEvent, route.Guid)
+			findings = append(findings, finding)
 		}
 	}
 
-	return unknownRoutes
+	return unknownRoutes, findings
 }
 
 // ValidateAppRoutes performs CF App Route resource validation
-func (detector *Detector) validateAppRoutes(wg *sync.WaitGroup) {
-	defer wg.Done()
-
+func (detector *Detector) validateAppRoutes(conf *config.Config) bool {
 	var cache = &detector.cache
 
 	if !cache.isValid() {
 		detector.logger.Warn("invalid cache detected. skipping routes check.")
 		failedRouteChecks.Inc()
-		return
+		return false
 	}
 
-	missingRoutes := detector.getMissingRoutes()
-	unknownRoutes := detector.getUnknownRoutes()
+	missingRoutes, missingFindings := detector.getMissingRoutes(conf)
+	unknownRoutes, unknownFindings := detector.getUnknownRoutes(conf)
 
 	if len(unknownRoutes) != 0 {
 		sort.Strings(unknownRoutes)
@@ -162,32 +424,47 @@ func (detector *Detector) validateAppRoutes(wg *sync.WaitGroup) {
 		sort.Strings(missingRoutes)
 		detector.logger.Infow("missing routes detected", "missing routes", missingRoutes)
 	}
-	totalUnknownRoutes.Set(float64(len(unknownRoutes)))
-	totalMissingRoutes.Set(float64(len(missingRoutes)))
+	findings := append(missingFindings, unknownFindings...)
+	active := detector.recordFindings(appRoutesCheck, findings, conf)
+	setActorViolationGauge(totalUnknownRoutes, conf.Data.Checks.Severity(appRoutesCheck), drift.UnknownRoute, findings, conf.Data.AuditEvents.ActorLabel)
+	setViolationGauge(totalMissingRoutes, conf.Data.Checks.Severity(appRoutesCheck), float64(active[drift.MissingRoute]))
 	successfulRouteChecks.Inc()
+	return true
 }
 
 // ValidateApps performs CF App resource validation
-func (detector *Detector) validateApps(wg *sync.WaitGroup) {
-	defer wg.Done()
-
+func (detector *Detector) validateApps(conf *config.Config) bool {
 	if !detector.cache.Apps.Valid {
 		detector.logger.Warn("invalid app cache detected. skipping check.")
 		failedAppChecks.Inc()
-		return
+		return false
 	}
 
+	var findings []drift.Finding
+	appRoutes := detector.cache.getAppRoutes()
+
 	var unknownApps []string
-	for name := range detector.cache.Apps.nameMap {
-		if _, ok := detector.config.Apps[name]; !ok {
+	for name, app := range detector.cache.Apps.nameMap {
+		if _, ok := conf.FindApp(name, app.Metadata.Labels); !ok {
 			unknownApps = append(unknownApps, name)
+			sshEnabled := detector.cache.Apps.sshMap[name]
+			finding := drift.Finding{
+				Kind:       drift.UnknownApp,
+				Resource:   name,
+				Space:      appSpaceName(&detector.cache, name),
+				Routes:     appRoutes[name],
+				SSHEnabled: &sshEnabled,
+			}
+			detector.correlate(conf, &finding, app.GUID, appCreateEvent, "")
+			findings = append(findings, finding)
 		}
 	}
 
 	var missingApps []string
-	for name, expectedApp := range detector.config.Apps {
-		if _, ok := detector.cache.Apps.nameMap[name]; !ok && !expectedApp.Optional {
+	for name, expectedApp := range conf.Apps {
+		if !expectedApp.Optional && !detector.isAppDeployed(&expectedApp) {
 			missingApps = append(missingApps, name)
+			findings = append(findings, drift.Finding{Kind: drift.MissingApp, Resource: name, Entry: name})
 		}
 	}
 
@@ -199,26 +476,36 @@ func (detector *Detector) validateApps(wg *sync.WaitGroup) {
 		sort.Strings(missingApps)
 		detector.logger.Infow("missing apps detected", "missing apps", missingApps)
 	}
-	totalUnknownApps.Set(float64(len(unknownApps)))
-	totalMissingApps.Set(float64(len(missingApps)))
+	active := detector.recordFindings(appsCheck, findings, conf)
+	setActorViolationGauge(totalUnknownApps, conf.Data.Checks.Severity(appsCheck), drift.UnknownApp, findings, conf.Data.AuditEvents.ActorLabel)
+	setViolationGauge(totalMissingApps, conf.Data.Checks.Severity(appsCheck), float64(active[drift.MissingApp]))
 	successfulAppChecks.Inc()
+	return true
 }
 
-func (detector *Detector) validateAppSSH(wg *sync.WaitGroup) {
-	defer wg.Done()
-
+func (detector *Detector) validateAppSSH(conf *config.Config) bool {
 	var appSSHViolations []string
 
 	if !detector.cache.Apps.Valid {
 		detector.logger.Warn("invalid app cache detected. skipping ssh check.")
 		failedAppSSHChecks.Inc()
-		return
+		return false
 	}
 
-	for name, expectedApp := range detector.config.Apps {
-		// only mark violations if the app was found to be deployed AND "should ssh be disabled?" == "was ssh enabled?"
-		if enabled, ok := detector.cache.Apps.sshMap[name]; ok && expectedApp.SSHDisabled == enabled {
+	var findings []drift.Finding
+	for name, enabled := range detector.cache.Apps.sshMap {
+		// only mark violations if the app was found in the config AND "should ssh be disabled?" == "was ssh enabled?"
+		labels := detector.cache.Apps.nameMap[name].Metadata.Labels
+		if expectedApp, ok := conf.FindApp(name, labels); ok && expectedApp.SSHDisabled == enabled {
 			appSSHViolations = append(appSSHViolations, name)
+			sshEnabled := enabled
+			findings = append(findings, drift.Finding{
+				Kind:       drift.AppSSH,
+				Resource:   name,
+				Entry:      expectedApp.ID(),
+				Space:      appSpaceName(&detector.cache, name),
+				SSHEnabled: &sshEnabled,
+			})
 		}
 	}
 
@@ -226,30 +513,191 @@ func (detector *Detector) validateAppSSH(wg *sync.WaitGroup) {
 		sort.Strings(appSSHViolations)
 		detector.logger.Infow("misconfigured app ssh detected", "apps", appSSHViolations)
 	}
-	totalAppSSHViolations.Set(float64(len(appSSHViolations)))
+	active := detector.recordFindings(appSSHCheck, findings, conf)
+	setViolationGauge(totalAppSSHViolations, conf.Data.Checks.Severity(appSSHCheck), float64(active[drift.AppSSH]))
 	successfulAppSSHChecks.Inc()
+	return true
+}
+
+// normalizeHealthCheckType maps the deprecated "none" health check type to its replacement, "process"
+func normalizeHealthCheckType(healthCheckType string) string {
+	if healthCheckType == "none" {
+		return "process"
+	}
+	return healthCheckType
+}
+
+// sameElements returns true if a and b contain the same elements, in any order
+func sameElements(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	sort.Strings(a)
+	sort.Strings(b)
+	return slices.Equal(a, b)
+}
+
+// getAppSettingsDrift returns the names of the settings of the named app that do
+// not match the settings expected by its AppEntry. Settings that are not set in
+// the AppEntry are not compared.
+func (detector *Detector) getAppSettingsDrift(name string, expectedApp *config.AppEntry) []string {
+	v3App := detector.cache.Apps.nameMap[name]
+	v2App := detector.cache.Apps.v2NameMap[name]
+
+	var drift []string
+	if expectedApp.Instances != 0 && expectedApp.Instances != v2App.Instances {
+		drift = append(drift, "instances")
+	}
+	if memory := expectedApp.MemoryMB(); memory != 0 && memory != v2App.Memory {
+		drift = append(drift, "memory")
+	}
+	if len(expectedApp.Buildpacks) != 0 && !slices.Equal(expectedApp.Buildpacks, v3App.Lifecycle.BuildpackData.Buildpacks) {
+		drift = append(drift, "buildpacks")
+	}
+	if len(expectedApp.Services) != 0 && !sameElements(expectedApp.Services, detector.cache.ServiceBindings.appServices[v3App.GUID]) {
+		drift = append(drift, "services")
+	}
+	if expectedApp.HealthCheckType != "" &&
+		normalizeHealthCheckType(expectedApp.HealthCheckType) != normalizeHealthCheckType(v2App.HealthCheckType) {
+		drift = append(drift, "health_check_type")
+	}
+	if expectedApp.HealthCheckHTTPEndpoint != "" && expectedApp.HealthCheckHTTPEndpoint != v2App.HealthCheckHttpEndpoint {
+		drift = append(drift, "health_check_http_endpoint")
+	}
+	return drift
+}
+
+// validateAppSettings verifies the instances, memory, buildpacks, services and
+// health checks of deployed apps against the settings expected by the config.
+func (detector *Detector) validateAppSettings(conf *config.Config) bool {
+	if !detector.cache.Apps.Valid || !detector.cache.ServiceBindings.Valid {
+		detector.logger.Warn("invalid app or service binding cache detected. skipping settings check.")
+		failedAppSettingsChecks.Inc()
+		return false
+	}
+
+	var appSettingsViolations []string
+	var findings []drift.Finding
+	for name, app := range detector.cache.Apps.nameMap {
+		expectedApp, ok := conf.FindApp(name, app.Metadata.Labels)
+		if !ok || !expectedApp.HasSettings() {
+			continue
+		}
+		if settings := detector.getAppSettingsDrift(name, &expectedApp); len(settings) != 0 {
+			appSettingsViolations = append(appSettingsViolations, name+":"+strings.Join(settings, ","))
+			findings = append(findings, drift.Finding{
+				Kind:     drift.AppSettings,
+				Resource: name,
+				Entry:    expectedApp.ID(),
+				Space:    appSpaceName(&detector.cache, name),
+				Details:  settings,
+			})
+		}
+	}
+
+	if len(appSettingsViolations) != 0 {
+		sort.Strings(appSettingsViolations)
+		detector.logger.Infow("misconfigured app settings detected", "apps", appSettingsViolations)
+	}
+	active := detector.recordFindings(appSettingsCheck, findings, conf)
+	setViolationGauge(totalAppSettingsViolations, conf.Data.Checks.Severity(appSettingsCheck), float64(active[drift.AppSettings]))
+	successfulAppSettingsChecks.Inc()
+	return true
 }
 
 // validateSpaces verifies spaces that Watchtower has read access to against
 // the provided config. If watchtower does not have permissions to a space, it
 // will be skipped.
-func (detector *Detector) validateSpaces(wg *sync.WaitGroup) {
-	defer wg.Done()
-
+func (detector *Detector) validateSpaces(conf *config.Config) bool {
 	if !detector.cache.Spaces.Valid {
 		detector.logger.Warn("invalid space cache detected. skipping check.")
 		failedSpaceChecks.Inc()
-		return
+		return false
+	}
+	if !detector.cache.Spaces.LabelsValid && conf.HasSpaceSelectors() {
+		detector.logger.Warn("space labels could not be refreshed, and are needed by space selectors. skipping check.")
+		failedSpaceChecks.Inc()
+		return false
 	}
 
-	var spaceSSHViolations float64
+	var findings []drift.Finding
 
 	for name, space := range detector.cache.Spaces.nameMap {
-		if spaceEntry, ok := detector.config.Spaces[name]; ok && space.AllowSSH != spaceEntry.AllowSSH {
+		labels := detector.cache.Spaces.labelMap[name]
+		if spaceEntry, ok := conf.FindSpace(name, labels); ok && space.AllowSSH != spaceEntry.AllowSSH {
 			log.Printf("Misconfigured SSH access detected for space: %s. SSH access enabled: %v", name, space.AllowSSH)
-			spaceSSHViolations++
+			sshEnabled := space.AllowSSH
+			findings = append(findings, drift.Finding{
+				Kind:       drift.SpaceSSH,
+				Resource:   name,
+				Entry:      spaceEntry.ID(),
+				SSHEnabled: &sshEnabled,
+			})
 		}
 	}
-	totalSpaceSSHViolations.Set(spaceSSHViolations)
+	active := detector.recordFindings(spacesCheck, findings, conf)
+	setViolationGauge(totalSpaceSSHViolations, conf.Data.Checks.Severity(spacesCheck), float64(active[drift.SpaceSSH]))
 	successfulSpaceChecks.Inc()
+	return true
+}
+
+// validateAppLabels verifies that every deployed app has the labels listed under
+// 'apps:required_labels' in the config.
+func (detector *Detector) validateAppLabels(conf *config.Config) bool {
+	if !detector.cache.Apps.Valid {
+		detector.logger.Warn("invalid app cache detected. skipping label check.")
+		failedAppLabelChecks.Inc()
+		return false
+	}
+
+	var unlabeledApps []string
+	var findings []drift.Finding
+	for name, app := range detector.cache.Apps.nameMap {
+		if missing := config.MissingLabels(conf.Data.AppConfig.RequiredLabels, app.Metadata.Labels); len(missing) != 0 {
+			unlabeledApps = append(unlabeledApps, name)
+			findings = append(findings, drift.Finding{
+				Kind:     drift.AppLabels,
+				Resource: name,
+				Space:    appSpaceName(&detector.cache, name),
+				Details:  missing,
+			})
+			detector.logger.Debugw("app missing required labels", "app", name, "labels", missing)
+		}
+	}
+
+	if len(unlabeledApps) != 0 {
+		sort.Strings(unlabeledApps)
+		detector.logger.Infow("apps missing required labels detected", "apps", unlabeledApps)
+	}
+	active := detector.recordFindings(appLabelsCheck, findings, conf)
+	setViolationGauge(totalAppLabelViolations, conf.Data.Checks.Severity(appLabelsCheck), float64(active[drift.AppLabels]))
+	successfulAppLabelChecks.Inc()
+	return true
+}
+
+// validateSpaceLabels verifies that every space Watchtower has read access to
+// has the labels listed under 'spaces:required_labels' in the config.
+func (detector *Detector) validateSpaceLabels(conf *config.Config) bool {
+	if !detector.cache.Spaces.Valid || !detector.cache.Spaces.LabelsValid {
+		detector.logger.Warn("invalid space cache detected. skipping label check.")
+		failedSpaceLabelChecks.Inc()
+		return false
+	}
+
+	var unlabeledSpaces []string
+	var findings []drift.Finding
+	for name, labels := range detector.cache.Spaces.labelMap {
+		if missing := config.MissingLabels(conf.Data.SpaceConfig.RequiredLabels, labels); len(missing) != 0 {
+			unlabeledSpaces = append(unlabeledSpaces, name)
+			findings = append(findings, drift.Finding{Kind: drift.SpaceLabels, Resource: name, Details: missing})
+			detector.logger.Debugw("space missing required labels", "space", name, "labels", missing)
+		}
+	}
+
+	if len(unlabeledSpaces) != 0 {
+		sort.Strings(unlabeledSpaces)
+		detector.logger.Infow("spaces missing required labels detected", "spaces", unlabeledSpaces)
+	}
+	active := detector.recordFindings(spaceLabelsCheck, findings, conf)
+	setViolationGauge(totalSpaceLabelViolations, conf.Data.Checks.Severity(spaceLabelsCheck), float64(active[drift.SpaceLabels]))
+	successfulSpaceLabelChecks.Inc()
+	return true
 }
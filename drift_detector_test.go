@@ -0,0 +1,401 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+	"github.com/18F/watchtower/history"
+	"github.com/18F/watchtower/notify"
+	"github.com/18F/watchtower/remediation"
+	"go.uber.org/zap"
+)
+
+// TestRecordFindingsExemptions ensures that exempted findings are recorded but not counted as violations.
+func TestRecordFindingsExemptions(t *testing.T) {
+	conf, err := config.Parse([]byte(`---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+exemptions:
+  - name: web
+    kind: app_ssh
+    reason: Debugging
+    expires: ` + time.Now().Add(time.Hour).Format(time.RFC3339)))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	detector := Detector{cache: newInitTestCache(), findings: drift.NewFindings()}
+	active := detector.recordFindings(appSSHCheck, []drift.Finding{
+		{Kind: drift.AppSSH, Resource: "web"},
+		{Kind: drift.AppSSH, Resource: "worker"},
+	}, &conf)
+
+	if active[drift.AppSSH] != 1 {
+		t.Fatalf("Exempted finding was counted as a violation. Found: %+v", active)
+	}
+	findings, _ := detector.findings.All()
+	if len(findings) != 2 || findings[0].Exemption == nil || findings[0].Exemption.Reason != "Debugging" || findings[1].Exemption != nil {
+		t.Fatalf("Recorded findings incorrect. Found: %+v", findings)
+	}
+}
+
+// TestEnabledValidationFunctions ensures that checks can be disabled separately from their section.
+func TestEnabledValidationFunctions(t *testing.T) {
+	conf, err := config.Parse([]byte(`---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+apps:
+  enabled: true
+spaces:
+  enabled: false
+checks:
+  app_routes:
+    enabled: false
+  app_ssh:
+    enabled: false
+  spaces:
+    enabled: true`))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	detector := Detector{}
+	var names []string
+	for _, check := range detector.enabledValidationFunctions(&conf) {
+		names = append(names, check.name)
+	}
+	if !slices.Equal(names, []string{appsCheck, appSettingsCheck}) {
+		t.Fatalf("Enabled checks incorrect. Found: %v", names)
+	}
+}
+
+// TestRecordFindingsSeverity ensures that findings carry the severity of their check.
+func TestRecordFindingsSeverity(t *testing.T) {
+	conf, err := config.Parse([]byte(`---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+checks:
+  app_ssh:
+    severity: critical`))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	detector := Detector{cache: newInitTestCache(), findings: drift.NewFindings()}
+	detector.recordFindings(appSSHCheck, []drift.Finding{{Kind: drift.AppSSH, Resource: "web"}}, &conf)
+	detector.recordFindings(appLabelsCheck, []drift.Finding{{Kind: drift.AppLabels, Resource: "web"}}, &conf)
+
+	findings, _ := detector.findings.All()
+	if len(findings) != 2 || findings[0].Severity != config.SeverityWarning || findings[1].Severity != config.SeverityCritical {
+		t.Fatalf("Recorded finding severities incorrect. Found: %+v", findings)
+	}
+}
+
+// TestRemediationActions ensures that actions are only proposed for enforced ssh drift.
+func TestRemediationActions(t *testing.T) {
+	conf, err := config.Parse([]byte(`---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+checks:
+  app_ssh:
+    enforce: true
+apps:
+  enabled: true
+  resources:
+    - name: web
+      ssh_disabled: true
+    - name: worker
+      enforce_ssh: false
+spaces:
+  enabled: true
+  resources:
+    - name: dev
+      allow_ssh: false
+      enforce_ssh: true
+remediation:
+  approval:
+    spaces: [dev]`))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	enabled, disabled := true, false
+	detector := Detector{cache: newInitTestCache()}
+	actions, _ := detector.remediationActions(&conf, []drift.Finding{
+		{Kind: drift.AppSSH, Resource: "web", SSHEnabled: &enabled},
+		{Kind: drift.AppSSH, Resource: "worker", SSHEnabled: &disabled},
+		{Kind: drift.SpaceSSH, Resource: "dev", SSHEnabled: &enabled},
+		{Kind: drift.UnknownApp, Resource: "rogue"},
+	}, time.Now())
+	if len(actions) != 2 {
+		t.Fatalf("Incorrect number of actions. Found: %+v", actions)
+	}
+	if actions[0].Type != remediation.DisableAppSSH || actions[0].Target != "web-guid" {
+		t.Fatalf("App ssh action incorrect. Found: %+v", actions[0])
+	}
+	if actions[1].Type != remediation.DisableSpaceSSH || actions[1].Target != "space-guid" || !actions[1].RequiresApproval {
+		t.Fatalf("Space ssh action incorrect. Found: %+v", actions[1])
+	}
+	if actions[0].RequiresApproval {
+		t.Fatalf("App ssh action outside the approval spaces requires approval. Found: %+v", actions[0])
+	}
+}
+
+// TestQuarantineActions ensures that unknown apps are quarantined with the actions
+// allowed in their space once the grace period ends.
+func TestQuarantineActions(t *testing.T) {
+	conf, err := config.Parse([]byte(`---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+remediation:
+  quarantine:
+    grace_period: 30m
+    spaces:
+      - name: dev
+        actions: [stop, unmap_routes]`))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	detector := Detector{cache: newInitTestCache()}
+	detected := time.Now()
+	findings := []drift.Finding{
+		{Kind: drift.UnknownApp, Resource: "web", Space: "dev", FirstSeen: detected},
+		{Kind: drift.UnknownApp, Resource: "worker", Space: "prod", FirstSeen: detected},
+	}
+
+	actions, scheduled := detector.remediationActions(&conf, findings, detected)
+	if len(actions) != 0 || len(scheduled["unknown_app:web"]) != 2 || scheduled["unknown_app:web"][0].Status != scheduledStatus {
+		t.Fatalf("Quarantine was not scheduled for the grace period. Found: %+v, %+v", actions, scheduled)
+	}
+
+	actions, _ = detector.remediationActions(&conf, findings, detected.Add(time.Hour))
+	if len(actions) != 2 || actions[0].Type != remediation.StopApp || actions[1].Type != remediation.UnmapRoute ||
+		actions[1].Target != "mapping-guid" || actions[1].Route != "web.app.cloud.gov" || !actions[1].DryRun {
+		t.Fatalf("Quarantine actions incorrect. Found: %+v", actions)
+	}
+}
+
+// TestQuarantineAfterRestart ensures that the quarantine grace period continues
+// from when the drift history first detected the app, rather than restarting
+// when Watchtower does.
+func TestQuarantineAfterRestart(t *testing.T) {
+	conf, err := config.Parse([]byte(`---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+remediation:
+  quarantine:
+    grace_period: 30m
+    spaces:
+      - name: dev
+        actions: [stop]`))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	finding := drift.Finding{Kind: drift.UnknownApp, Resource: "web", Space: "dev", FirstSeen: time.Now().Add(-20 * time.Minute)}
+	before := openTestHistory(t, path)
+	if err := before.Update(&conf, []drift.Finding{finding}, drift.Kinds, drift.Kinds); err != nil {
+		t.Fatalf("Failed updating history: %s", err)
+	}
+	before.Close()
+
+	// After the restart, the app is first seen again, 20 minutes into its grace period
+	now := time.Now()
+	finding.FirstSeen = now
+	detector := Detector{cache: newInitTestCache(), history: openTestHistory(t, path)}
+	if actions, scheduled := detector.remediationActions(&conf, []drift.Finding{finding}, now); len(actions) != 0 ||
+		!scheduled[finding.Key()][0].Time.Before(now.Add(15*time.Minute)) {
+		t.Fatalf("Grace period restarted with Watchtower. Found: %+v, %+v", actions, scheduled)
+	}
+	if actions, _ := detector.remediationActions(&conf, []drift.Finding{finding}, now.Add(15*time.Minute)); len(actions) != 1 {
+		t.Fatalf("App was not quarantined when the grace period ended. Found: %+v", actions)
+	}
+}
+
+// TestValidateInvalidCache ensures that a run in which the app cache could not be
+// refreshed leaves the drift history of the app checks open.
+func TestValidateInvalidCache(t *testing.T) {
+	conf, err := config.Parse([]byte(`---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+apps:
+  enabled: true`))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	detected := time.Now().Add(-time.Hour)
+	finding := drift.Finding{Kind: drift.UnknownApp, Resource: "rogue", FirstSeen: detected}
+	before := openTestHistory(t, path)
+	if err := before.Update(&conf, []drift.Finding{finding}, drift.Kinds, drift.Kinds); err != nil {
+		t.Fatalf("Failed updating history: %s", err)
+	}
+	before.Close()
+
+	// After a restart, the first refresh of the app cache fails
+	cache := newInitTestCache()
+	cache.Apps.Valid = false
+	dispatcher, _ := notify.NewDispatcher(zap.NewNop().Sugar(), nil)
+	detector := Detector{
+		cache:      cache,
+		config:     config.NewStore(conf),
+		findings:   drift.NewFindings(),
+		dispatcher: dispatcher,
+		history:    openTestHistory(t, path),
+		logger:     zap.NewNop().Sugar(),
+	}
+	detector.Validate()
+
+	lifecycles := detector.history.Lifecycles(history.Query{})
+	if len(lifecycles) != 1 || !lifecycles[0].Open() || !lifecycles[0].Detected.Equal(detected) {
+		t.Fatalf("Drift history of a skipped check changed. Found: %+v", lifecycles)
+	}
+}
+
+// openTestHistory opens a drift history at path, closing it when the test ends
+func openTestHistory(t *testing.T, path string) *history.Store {
+	t.Helper()
+	store, err := history.Open(path, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("Failed opening history: %s", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// TestRouteActions ensures that unknown routes on enforced domains are unmapped, or
+// deleted when they would be orphaned, once the grace period ends.
+func TestRouteActions(t *testing.T) {
+	parse := func(routes string) config.Config {
+		conf, err := config.Parse([]byte(`---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+remediation:
+  routes:
+` + routes))
+		if err != nil {
+			t.Fatalf("Config failed to load: %v", err)
+		}
+		return conf
+	}
+
+	detector := Detector{cache: newInitTestCache()}
+	detected := time.Now()
+	findings := []drift.Finding{{Kind: drift.UnknownRoute, Resource: "web", Route: "web.app.cloud.gov", FirstSeen: detected}}
+
+	tests := []struct {
+		routes string
+		action remediation.ActionType
+		target string
+	}{
+		{"    domains: [app.cloud.gov]", remediation.UnmapRoute, "mapping-guid"},
+		{"    domains: [app.cloud.gov]\n    delete_orphans: true", remediation.DeleteRoute, "route-guid"},
+		{"    domains: [apps.internal]", "", ""},
+	}
+	for _, test := range tests {
+		conf := parse(test.routes)
+		actions, scheduled := detector.remediationActions(&conf, findings, detected)
+		if len(actions) != 0 || (test.action != "" && scheduled[findings[0].Key()][0].Action != string(test.action)) {
+			t.Fatalf("Route action was not scheduled for the grace period. Found: %+v, %+v", actions, scheduled)
+		}
+
+		actions, _ = detector.remediationActions(&conf, findings, detected.Add(time.Hour))
+		if test.action == "" {
+			if len(actions) != 0 {
+				t.Fatalf("Unknown route on an unenforced domain was remediated. Found: %+v", actions)
+			}
+			continue
+		}
+		if len(actions) != 1 || actions[0].Type != test.action || actions[0].Target != test.target || !actions[0].DryRun {
+			t.Fatalf("Route action incorrect for %q. Found: %+v", test.routes, actions)
+		}
+	}
+}
+
+// TestRouteActionsAfterRestart ensures that the route grace period continues
+// from when the drift history first detected the route.
+func TestRouteActionsAfterRestart(t *testing.T) {
+	conf, err := config.Parse([]byte(`---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+remediation:
+  routes:
+    grace_period: 30m
+    domains: [app.cloud.gov]`))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	finding := drift.Finding{Kind: drift.UnknownRoute, Resource: "web", Route: "web.app.cloud.gov", FirstSeen: time.Now().Add(-20 * time.Minute)}
+	before := openTestHistory(t, path)
+	if err := before.Update(&conf, []drift.Finding{finding}, drift.Kinds, drift.Kinds); err != nil {
+		t.Fatalf("Failed updating history: %s", err)
+	}
+	before.Close()
+
+	now := time.Now()
+	finding.FirstSeen = now
+	detector := Detector{cache: newInitTestCache(), history: openTestHistory(t, path)}
+	if actions, scheduled := detector.remediationActions(&conf, []drift.Finding{finding}, now); len(actions) != 0 ||
+		!scheduled[finding.Key()][0].Time.Before(now.Add(15*time.Minute)) {
+		t.Fatalf("Grace period restarted with Watchtower. Found: %+v, %+v", actions, scheduled)
+	}
+	if actions, _ := detector.remediationActions(&conf, []drift.Finding{finding}, now.Add(15*time.Minute)); len(actions) != 1 {
+		t.Fatalf("Route was not unmapped when the grace period ended. Found: %+v", actions)
+	}
+}
+
+// TestSpaceCheckWithoutLabels ensures that the space ssh check still runs when
+// space labels could not be refreshed, unless a space entry uses a selector.
+func TestSpaceCheckWithoutLabels(t *testing.T) {
+	base := `---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+spaces:
+  enabled: true
+  resources:
+    - name: dev
+      allow_ssh: false`
+	for resources, expected := range map[string]int{"": 1, "\n    - selector: env=prod": 0} {
+		conf, err := config.Parse([]byte(base + resources))
+		if err != nil {
+			t.Fatalf("Config failed to load: %v", err)
+		}
+
+		detector := Detector{cache: newInitTestCache(), findings: drift.NewFindings(), logger: zap.NewNop().Sugar()}
+		if ran := detector.validateSpaces(&conf); ran != (expected != 0) {
+			t.Fatalf("Space check ran: %v, expected findings: %d", ran, expected)
+		}
+		if findings, _ := detector.findings.All(); len(findings) != expected {
+			t.Fatalf("Incorrect findings without space labels. Expected: %d, Found: %+v", expected, findings)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+// Package history keeps a local, file-backed record of when each drift finding
+// was detected and resolved, across detector runs and restarts.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+	"go.uber.org/zap"
+)
+
+// compactionInterval is how often resolved lifecycles older than the retention
+// period are removed from the history file
+const compactionInterval = 24 * time.Hour
+
+// Resolutions of a finding's lifecycle
+const (
+	Remediated    = "remediated"     // The finding was no longer reported
+	Exempted      = "exempted"       // The finding was accepted by a config exemption
+	CheckDisabled = "check_disabled" // The check that reported the finding was disabled
+)
+
+// Lifecycle is a single period during which a finding was reported
+type Lifecycle struct {
+	Key      string        `json:"key"`
+	Finding  drift.Finding `json:"finding"`
+	Detected time.Time     `json:"detected"`
+
+	// Resolved and Resolution are set once the finding is no longer reported
+	Resolved   *time.Time `json:"resolved,omitempty"`
+	Resolution string     `json:"resolution,omitempty"`
+}
+
+// Open returns true if the finding is still reported
+func (l *Lifecycle) Open() bool {
+	return l.Resolved == nil
+}
+
+// Duration returns how long the finding was reported, up until now if it is still open
+func (l *Lifecycle) Duration(now time.Time) time.Duration {
+	if l.Resolved != nil {
+		return l.Resolved.Sub(l.Detected)
+	}
+	return now.Sub(l.Detected)
+}
+
+// record is a single line of the history file. Detected records carry the
+// finding, resolved records refer to the open lifecycle by key.
+type record struct {
+	Type       string         `json:"type"`
+	Time       time.Time      `json:"time"`
+	Key        string         `json:"key"`
+	Finding    *drift.Finding `json:"finding,omitempty"`
+	Resolution string         `json:"resolution,omitempty"`
+}
+
+// Record types
+const (
+	detectedRecord = "detected"
+	resolvedRecord = "resolved"
+)
+
+// Store records the lifecycles of findings in an append-only file of JSON
+// records, one per line, which is replayed when the store is opened.
+type Store struct {
+	path       string
+	file       *os.File
+	lifecycles []Lifecycle
+	open       map[string]int // Indexes of open lifecycles, by finding key
+	compacted  time.Time
+	logger     *zap.SugaredLogger
+	mut        sync.RWMutex
+}
+
+// Open loads the history stored at path, creating the file if it does not exist
+func Open(path string, logger *zap.SugaredLogger) (*Store, error) {
+	if path == "" {
+		return nil, errors.New("history cannot be opened without a path")
+	}
+	if logger == nil {
+		return nil, errors.New("history cannot be opened with nil logger")
+	}
+	store := &Store{
+		path:   path,
+		open:   make(map[string]int),
+		logger: logger.Named("history"),
+	}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	store.file = file
+	return store, nil
+}
+
+// load replays the records of the history file. Lines that cannot be decoded,
+// such as one cut short by a crash, are skipped.
+func (s *Store) load() error {
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			s.logger.Warnw("skipping unreadable history record", "line", line, "error", err.Error())
+			continue
+		}
+		s.apply(rec)
+	}
+	return scanner.Err()
+}
+
+// apply updates the lifecycles with a record. s.mut must be held, unless the
+// store is still being opened.
+func (s *Store) apply(rec record) {
+	switch rec.Type {
+	case detectedRecord:
+		if _, ok := s.open[rec.Key]; ok || rec.Finding == nil {
+			return
+		}
+		s.open[rec.Key] = len(s.lifecycles)
+		s.lifecycles = append(s.lifecycles, Lifecycle{Key: rec.Key, Finding: *rec.Finding, Detected: rec.Time})
+	case resolvedRecord:
+		i, ok := s.open[rec.Key]
+		if !ok {
+			return
+		}
+		resolved := rec.Time
+		s.lifecycles[i].Resolved = &resolved
+		s.lifecycles[i].Resolution = rec.Resolution
+		delete(s.open, rec.Key)
+	}
+}
+
+// Update records the findings of a detector run. enabled are the kinds of drift
+// whose checks are enabled, and completed those whose checks ran to completion.
+// Lifecycles are opened for new findings, and resolved for findings that are no
+// longer reported or have been exempted. Findings of kinds that are not enabled
+// are resolved as check_disabled rather than remediated, and lifecycles of kinds
+// whose checks were skipped are left as they are. Findings that resolved while
+// Watchtower was not running are resolved on the first update after a restart.
+func (s *Store) Update(conf *config.Config, findings []drift.Finding, enabled, completed []drift.Kind) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	now := time.Now()
+	current := make(map[string]drift.Finding)
+	for _, finding := range findings {
+		if slices.Contains(completed, finding.Kind) {
+			current[finding.Key()] = finding
+		}
+	}
+
+	var records []record
+	for key, i := range s.open {
+		kind := s.lifecycles[i].Finding.Kind
+		finding, ok := current[key]
+		switch {
+		case !slices.Contains(enabled, kind):
+			records = append(records, record{Type: resolvedRecord, Time: now, Key: key, Resolution: CheckDisabled})
+		case !slices.Contains(completed, kind):
+			continue
+		case !ok:
+			records = append(records, record{Type: resolvedRecord, Time: now, Key: key, Resolution: Remediated})
+		case finding.Exemption != nil:
+			records = append(records, record{Type: resolvedRecord, Time: now, Key: key, Resolution: Exempted})
+		}
+	}
+	for _, finding := range current {
+		if _, ok := s.open[finding.Key()]; !ok && finding.Exemption == nil {
+			finding := finding
+			records = append(records, record{Type: detectedRecord, Time: finding.FirstSeen, Key: finding.Key(), Finding: &finding})
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Key < records[j].Key
+	})
+
+	var errs []error
+	encoder := json.NewEncoder(s.file)
+	for _, rec := range records {
+		s.apply(rec)
+		if err := encoder.Encode(rec); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed writing history: %w", err)
+	}
+
+	if now.Sub(s.compacted) >= compactionInterval {
+		if err := s.compact(now.Add(-conf.Data.History.RetentionPeriod())); err != nil {
+			return fmt.Errorf("failed compacting history: %w", err)
+		}
+		s.compacted = now
+	}
+	return nil
+}
+
+// compact drops the lifecycles resolved before cutoff, and rewrites the history
+// file with the remaining lifecycles. s.mut must be held.
+func (s *Store) compact(cutoff time.Time) error {
+	var kept []Lifecycle
+	for _, lifecycle := range s.lifecycles {
+		if lifecycle.Open() || !lifecycle.Resolved.Before(cutoff) {
+			kept = append(kept, lifecycle)
+		}
+	}
+
+	// Write to a temporary file and rename it, so a crash cannot lose the history
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for i := range kept {
+		lifecycle := &kept[i]
+		records := []record{{Type: detectedRecord, Time: lifecycle.Detected, Key: lifecycle.Key, Finding: &lifecycle.Finding}}
+		if !lifecycle.Open() {
+			records = append(records, record{Type: resolvedRecord, Time: *lifecycle.Resolved, Key: lifecycle.Key, Resolution: lifecycle.Resolution})
+		}
+		for _, rec := range records {
+			if err := encoder.Encode(rec); err != nil {
+				tmp.Close()
+				return err
+			}
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	s.file.Close()
+	s.file = file
+
+	s.lifecycles = kept
+	s.open = make(map[string]int)
+	for i, lifecycle := range kept {
+		if lifecycle.Open() {
+			s.open[lifecycle.Key] = i
+		}
+	}
+	return nil
+}
+
+// Query selects lifecycles from the history. Empty fields match every lifecycle.
+type Query struct {
+	Kind     drift.Kind
+	Resource string
+	Space    string
+
+	// Since excludes lifecycles that were resolved before it
+	Since time.Time
+}
+
+// matches returns true if the lifecycle is selected by the query
+func (q *Query) matches(lifecycle *Lifecycle) bool {
+	return (q.Kind == "" || lifecycle.Finding.Kind == q.Kind) &&
+		(q.Resource == "" || lifecycle.Finding.Resource == q.Resource) &&
+		(q.Space == "" || lifecycle.Finding.Space == q.Space) &&
+		(lifecycle.Open() || !lifecycle.Resolved.Before(q.Since))
+}
+
+// Lifecycles returns the lifecycles selected by query, most recently detected first
+func (s *Store) Lifecycles(query Query) []Lifecycle {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+
+	selected := []Lifecycle{}
+	for i := range s.lifecycles {
+		if query.matches(&s.lifecycles[i]) {
+			selected = append(selected, s.lifecycles[i])
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].Detected.After(selected[j].Detected)
+	})
+	return selected
+}
+
+// Detected returns when the open lifecycle of the finding with the given key was
+// detected, and false if the finding has no open lifecycle
+func (s *Store) Detected(key string) (time.Time, bool) {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+
+	i, ok := s.open[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return s.lifecycles[i].Detected, true
+}
+
+// OpenFindings returns the findings of every open lifecycle
+func (s *Store) OpenFindings() []drift.Finding {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+
+	findings := make([]drift.Finding, 0, len(s.open))
+	for _, i := range s.open {
+		findings = append(findings, s.lifecycles[i].Finding)
+	}
+	return findings
+}
+
+// MeanTimeToRemediate returns the mean duration of the remediated lifecycles,
+// and false if none of the lifecycles were remediated.
+func MeanTimeToRemediate(lifecycles []Lifecycle) (time.Duration, bool) {
+	var total time.Duration
+	remediated := 0
+	for i := range lifecycles {
+		if lifecycles[i].Resolution == Remediated {
+			total += lifecycles[i].Duration(*lifecycles[i].Resolved)
+			remediated++
+		}
+	}
+	if remediated == 0 {
+		return 0, false
+	}
+	return total / time.Duration(remediated), true
+}
+
+// Close closes the history file
+func (s *Store) Close() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.file.Close()
+}
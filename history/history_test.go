@@ -0,0 +1,180 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+	"go.uber.org/zap"
+)
+
+// openTestStore opens a history store in a temporary directory
+func openTestStore(t *testing.T, path string) *Store {
+	t.Helper()
+	store, err := Open(path, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("Failed opening history: %s", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// TestHistoryLifecycles ensures that lifecycles are opened and resolved as findings
+// appear and disappear, and are kept when the history is reopened.
+func TestHistoryLifecycles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	conf := &config.Config{}
+	detected := time.Now().Add(-time.Hour)
+
+	store := openTestStore(t, path)
+	rogue := drift.Finding{Kind: drift.UnknownApp, Resource: "rogue", Space: "prod", FirstSeen: detected}
+	ssh := drift.Finding{Kind: drift.AppSSH, Resource: "web", Space: "prod", FirstSeen: detected}
+	if err := store.Update(conf, []drift.Finding{rogue, ssh}, drift.Kinds, drift.Kinds); err != nil {
+		t.Fatalf("Failed updating history: %s", err)
+	}
+	store.Close()
+
+	// After a restart, findings are seen again with a new first seen time
+	reopened := openTestStore(t, path)
+	if open := reopened.OpenFindings(); len(open) != 2 {
+		t.Fatalf("Open findings were not kept across restart. Found: %+v", open)
+	}
+	ssh.FirstSeen = time.Now()
+	ssh.Exemption = &drift.Exemption{Reason: "Debugging"}
+	if err := reopened.Update(conf, []drift.Finding{ssh}, drift.Kinds, drift.Kinds); err != nil {
+		t.Fatalf("Failed updating history: %s", err)
+	}
+
+	lifecycles := reopened.Lifecycles(Query{})
+	if len(lifecycles) != 2 {
+		t.Fatalf("Incorrect number of lifecycles. Found: %+v", lifecycles)
+	}
+	for _, lifecycle := range lifecycles {
+		if !lifecycle.Detected.Equal(detected) || lifecycle.Open() {
+			t.Fatalf("Lifecycle was not kept across restart. Found: %+v", lifecycle)
+		}
+	}
+	if lifecycles := reopened.Lifecycles(Query{Resource: "web"}); lifecycles[0].Resolution != Exempted {
+		t.Fatalf("Exempted finding was not resolved as exempted. Found: %+v", lifecycles)
+	}
+
+	mean, ok := MeanTimeToRemediate(lifecycles)
+	if !ok || mean < time.Hour {
+		t.Fatalf("Incorrect mean time to remediate. Found: %s", mean)
+	}
+}
+
+// TestHistoryQuery ensures that queries select lifecycles by finding and resolution time.
+func TestHistoryQuery(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "history.jsonl"))
+	conf := &config.Config{}
+	now := time.Now()
+	findings := []drift.Finding{
+		{Kind: drift.UnknownApp, Resource: "rogue", Space: "prod", FirstSeen: now},
+		{Kind: drift.AppSSH, Resource: "web", Space: "dev", FirstSeen: now},
+	}
+	if err := store.Update(conf, findings, drift.Kinds, drift.Kinds); err != nil {
+		t.Fatalf("Failed updating history: %s", err)
+	}
+	if err := store.Update(conf, findings[1:], drift.Kinds, drift.Kinds); err != nil {
+		t.Fatalf("Failed updating history: %s", err)
+	}
+
+	tests := []struct {
+		query    Query
+		expected int
+	}{
+		{Query{}, 2},
+		{Query{Kind: drift.AppSSH}, 1},
+		{Query{Space: "prod"}, 1},
+		{Query{Resource: "missing"}, 0},
+		{Query{Since: time.Now().Add(time.Hour)}, 1},
+	}
+	for _, test := range tests {
+		if lifecycles := store.Lifecycles(test.query); len(lifecycles) != test.expected {
+			t.Fatalf("Query %+v returned %d lifecycles, expected %d", test.query, len(lifecycles), test.expected)
+		}
+	}
+}
+
+// TestHistoryCompaction ensures that lifecycles resolved before the retention period
+// are removed, and that unreadable records are skipped.
+func TestHistoryCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	old := time.Now().Add(-48 * time.Hour)
+	data := `{"type":"detected","time":"` + old.Format(time.RFC3339Nano) + `","key":"unknown_app:old","finding":{"kind":"unknown_app","resource":"old"}}
+{"type":"resolved","time":"` + old.Add(time.Hour).Format(time.RFC3339Nano) + `","key":"unknown_app:old","resolution":"remediated"}
+{"type":"detected","time":"` + old.Format(time.RFC3339Nano) + `","key":"app_ssh:web","finding":{"kind":"app_ssh","resource":"web"}}
+{"type":"detec`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := openTestStore(t, path)
+	if lifecycles := store.Lifecycles(Query{}); len(lifecycles) != 2 {
+		t.Fatalf("History was not replayed. Found: %+v", lifecycles)
+	}
+
+	conf := &config.Config{Data: config.YAMLConfig{History: config.HistoryConfig{Retention: 24 * time.Hour}}}
+	web := drift.Finding{Kind: drift.AppSSH, Resource: "web", FirstSeen: time.Now()}
+	if err := store.Update(conf, []drift.Finding{web}, drift.Kinds, drift.Kinds); err != nil {
+		t.Fatalf("Failed updating history: %s", err)
+	}
+	store.Close()
+
+	lifecycles := openTestStore(t, path).Lifecycles(Query{})
+	if len(lifecycles) != 1 || lifecycles[0].Key != "app_ssh:web" || !lifecycles[0].Open() || !lifecycles[0].Detected.Equal(old) {
+		t.Fatalf("History was not compacted. Found: %+v", lifecycles)
+	}
+}
+
+// TestHistoryDisabledCheck ensures that findings cleared because their check was
+// disabled are not resolved as remediated.
+func TestHistoryDisabledCheck(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "history.jsonl"))
+	conf := &config.Config{}
+	rogue := drift.Finding{Kind: drift.UnknownApp, Resource: "rogue", FirstSeen: time.Now()}
+	ssh := drift.Finding{Kind: drift.AppSSH, Resource: "web", FirstSeen: time.Now()}
+	if err := store.Update(conf, []drift.Finding{rogue, ssh}, drift.Kinds, drift.Kinds); err != nil {
+		t.Fatalf("Failed updating history: %s", err)
+	}
+
+	// The app_ssh check is disabled, and the rogue app is deleted
+	withoutSSH := []drift.Kind{drift.UnknownApp, drift.MissingApp}
+	if err := store.Update(conf, nil, withoutSSH, withoutSSH); err != nil {
+		t.Fatalf("Failed updating history: %s", err)
+	}
+	if lifecycles := store.Lifecycles(Query{Kind: drift.AppSSH}); len(lifecycles) != 1 || lifecycles[0].Resolution != CheckDisabled {
+		t.Fatalf("Finding of disabled check was not resolved as check_disabled. Found: %+v", lifecycles)
+	}
+	if lifecycles := store.Lifecycles(Query{Kind: drift.UnknownApp}); len(lifecycles) != 1 || lifecycles[0].Resolution != Remediated {
+		t.Fatalf("Finding of enabled check was not resolved as remediated. Found: %+v", lifecycles)
+	}
+}
+
+// TestHistorySkippedCheck ensures that findings of checks that were skipped,
+// such as when their resources could not be fetched, are left open.
+func TestHistorySkippedCheck(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "history.jsonl"))
+	conf := &config.Config{}
+	detected := time.Now().Add(-time.Hour)
+	rogue := drift.Finding{Kind: drift.UnknownApp, Resource: "rogue", FirstSeen: detected}
+	if err := store.Update(conf, []drift.Finding{rogue}, drift.Kinds, drift.Kinds); err != nil {
+		t.Fatalf("Failed updating history: %s", err)
+	}
+
+	// The apps check was skipped, so its finding was not reported
+	if err := store.Update(conf, nil, drift.Kinds, []drift.Kind{drift.AppSSH}); err != nil {
+		t.Fatalf("Failed updating history: %s", err)
+	}
+	lifecycles := store.Lifecycles(Query{})
+	if len(lifecycles) != 1 || !lifecycles[0].Open() {
+		t.Fatalf("Finding of skipped check was resolved. Found: %+v", lifecycles)
+	}
+	if !lifecycles[0].Detected.Equal(detected) {
+		t.Fatalf("Detection time of finding of skipped check changed. Found: %s", lifecycles[0].Detected)
+	}
+}
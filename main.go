@@ -3,14 +3,25 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
+
+	// Embed the time zone database so that email digest time zones can be
+	// loaded on hosts without one
+	_ "time/tzdata"
 
 	"github.com/18F/watchtower/api"
 	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+	"github.com/18F/watchtower/history"
+	"github.com/18F/watchtower/notify"
+	"github.com/18F/watchtower/remediation"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"go.uber.org/zap"
 )
 
+//go:generate sh -c "go run . schema > config.schema.json"
+
 const namespace = "watchtower"
 
 var (
@@ -63,45 +74,170 @@ var (
 		Name:      "success_total",
 		Help:      "Number of times the config refresh for Routes has succeeded",
 	})
+	failedAppSettingsChecks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "app_settings_checks",
+		Name:      "failed_total",
+		Help:      "Number of times the settings check for Apps has failed for any reason",
+	})
+	successfulAppSettingsChecks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "app_settings_checks",
+		Name:      "success_total",
+		Help:      "Number of times the settings check for Apps has succeeded",
+	})
+	failedAppLabelChecks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "app_label_checks",
+		Name:      "failed_total",
+		Help:      "Number of times the required label check for Apps has failed for any reason",
+	})
+	successfulAppLabelChecks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "app_label_checks",
+		Name:      "success_total",
+		Help:      "Number of times the required label check for Apps has succeeded",
+	})
+	failedSpaceLabelChecks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "space_label_checks",
+		Name:      "failed_total",
+		Help:      "Number of times the required label check for Spaces has failed for any reason",
+	})
+	successfulSpaceLabelChecks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "space_label_checks",
+		Name:      "success_total",
+		Help:      "Number of times the required label check for Spaces has succeeded",
+	})
 
-	// Gauges for unknown/missing/misconfigured resources
-	totalUnknownApps = promauto.NewGauge(prometheus.GaugeOpts{
+	// Gauges for unknown/missing/misconfigured resources, labelled with the
+	// severity of the check that found them
+	totalUnknownApps = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Subsystem: "unknown",
 		Name:      "apps_total",
 		Help:      "Number of Apps deployed that are not in the allowed config file (config.yaml)",
-	})
-	totalMissingApps = promauto.NewGauge(prometheus.GaugeOpts{
+	}, []string{"severity", "actor"})
+	totalMissingApps = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Subsystem: "missing",
 		Name:      "apps_total",
 		Help:      "Number of Apps in the provided config file that are not deployed",
-	})
+	}, []string{"severity"})
 
-	totalUnknownRoutes = promauto.NewGauge(prometheus.GaugeOpts{
+	totalUnknownRoutes = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Subsystem: "unknown",
 		Name:      "app_routes_total",
 		Help:      "Number of Routes deployed that are not in the allowed config file (config.yaml)",
-	})
-	totalMissingRoutes = promauto.NewGauge(prometheus.GaugeOpts{
+	}, []string{"severity", "actor"})
+	totalMissingRoutes = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Subsystem: "missing",
 		Name:      "app_routes_total",
 		Help:      "Number of Routes in the provided config file that are not deployed",
-	})
+	}, []string{"severity"})
 
-	totalSpaceSSHViolations = promauto.NewGauge(prometheus.GaugeOpts{
+	totalSpaceSSHViolations = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Subsystem: "ssh",
 		Name:      "space_misconfiguration_total",
 		Help:      "Number of Spaces that have misconfigured SSH access settings",
-	})
-	totalAppSSHViolations = promauto.NewGauge(prometheus.GaugeOpts{
+	}, []string{"severity"})
+	totalAppSSHViolations = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Subsystem: "ssh",
 		Name:      "app_misconfiguration_total",
 		Help:      "Number of Apps that have misconfigured SSH access settings",
+	}, []string{"severity"})
+
+	totalAppSettingsViolations = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "settings",
+		Name:      "app_misconfiguration_total",
+		Help:      "Number of Apps whose instances, memory, buildpacks, services or health checks differ from the config",
+	}, []string{"severity"})
+
+	totalAppLabelViolations = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "labels",
+		Name:      "app_missing_total",
+		Help:      "Number of Apps that are missing one or more required labels",
+	}, []string{"severity"})
+	totalSpaceLabelViolations = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "labels",
+		Name:      "space_missing_total",
+		Help:      "Number of Spaces that are missing one or more required labels",
+	}, []string{"severity"})
+
+	// Gauges for config exemptions
+	totalExemptedFindings = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "exemptions",
+		Name:      "exempted_findings_total",
+		Help:      "Number of drift findings that are accepted by an exemption in the config",
+	})
+	totalExpiringExemptions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "exemptions",
+		Name:      "expiring_total",
+		Help:      "Number of exemptions in the config that expire within the next 7 days",
+	})
+
+	// Counters for drift notifications, labelled with the notifier they were sent to
+	sentNotifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "notifications",
+		Name:      "sent_total",
+		Help:      "Number of times drift events were delivered to a notifier",
+	}, []string{"notifier"})
+	failedNotifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "notifications",
+		Name:      "failed_total",
+		Help:      "Number of times delivering drift events to a notifier failed after retrying",
+	}, []string{"notifier"})
+	attemptedRemediations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "remediations",
+		Name:      "attempted_total",
+		Help:      "Number of remediation actions attempted, excluding dry runs",
+	}, []string{"action"})
+	succeededRemediations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "remediations",
+		Name:      "succeeded_total",
+		Help:      "Number of remediation actions that succeeded",
+	}, []string{"action"})
+	failedRemediations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "remediations",
+		Name:      "failed_total",
+		Help:      "Number of remediation actions that failed",
+	}, []string{"action"})
+
+	// Metrics for the Cloud Controller token
+	tokenExpiry = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "token_expiry_timestamp_seconds",
+		Help:      "Unix time at which the current Cloud Controller token expires",
+	})
+	authFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "failures_total",
+		Help:      "Number of failed token refreshes, failed token grants and tokens rejected by the Cloud Controller",
+	}, []string{"reason"})
+
+	// Gauge for the result of the most recent config reload
+	configReloadSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "config",
+		Name:      "reload_success",
+		Help:      "Whether the most recent config reload succeeded (1) or failed (0)",
 	})
 )
 
@@ -119,6 +255,31 @@ func main() {
 		}
 	}()
 
+	// Subcommands are dispatched before parsing the top-level flags
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "init":
+			if err := runInit(os.Args[2:], logger); err != nil {
+				logger.Fatalw("failed generating config", "error", err.Error())
+			}
+			return
+		case "schema":
+			schema, err := config.Schema()
+			if err == nil {
+				_, err = os.Stdout.Write(schema)
+			}
+			if err != nil {
+				logger.Fatalw("failed writing config schema", "error", err.Error())
+			}
+			return
+		case "lint":
+			if err := runLint(os.Args[2:], os.Stdout); err != nil {
+				logger.Fatalw("failed linting config", "error", err.Error())
+			}
+			return
+		}
+	}
+
 	help := flag.Bool("help", false, "Print usage instructions.")
 	configPath := flag.String("config", "config.yaml", "Path to configuration file.")
 	flag.Parse()
@@ -128,17 +289,66 @@ func main() {
 		return
 	}
 
-	config, err := config.Load(*configPath)
+	conf, err := config.Load(*configPath)
 	if err != nil {
 		logger.Fatalw("failed configuration loading", "error", err.Error())
 	}
 
-	_, err = NewDetector(&config, logger)
+	store := config.NewStore(conf)
+
+	_, err = NewConfigReloader(*configPath, store, logger)
+	if err != nil {
+		logger.Fatalw("failed creating config reloader", "error", err.Error())
+	}
+
+	findings := drift.NewFindings()
+
+	dispatcher, err := notify.NewDispatcher(logger, func(notifier string, err error) {
+		if err != nil {
+			failedNotifications.WithLabelValues(notifier).Inc()
+			return
+		}
+		sentNotifications.WithLabelValues(notifier).Inc()
+	})
+	if err != nil {
+		logger.Fatalw("failed creating notification dispatcher", "error", err.Error())
+	}
+
+	var historyStore *history.Store
+	if path := conf.Data.History.Path; path != "" {
+		historyStore, err = history.Open(path, logger)
+		if err != nil {
+			logger.Fatalw("failed opening drift history", "error", err.Error())
+		}
+		// Drift still open in the history was notified before Watchtower restarted
+		dispatcher.SetBaseline(historyStore.OpenFindings())
+	}
+
+	remediator, err := remediation.NewRemediator(executeRemediation, func(action remediation.Action, outcome remediation.Outcome) {
+		switch outcome {
+		case remediation.Succeeded:
+			attemptedRemediations.WithLabelValues(string(action.Type)).Inc()
+			succeededRemediations.WithLabelValues(string(action.Type)).Inc()
+		case remediation.Failed:
+			attemptedRemediations.WithLabelValues(string(action.Type)).Inc()
+			failedRemediations.WithLabelValues(string(action.Type)).Inc()
+		}
+	}, logger)
 	if err != nil {
-		logger.Fatalw("failed creating drift detector", "error", err.Error())
+		logger.Fatalw("failed creating remediator", "error", err.Error())
 	}
 
-	err = api.Serve(&config, logger)
+	// Connecting to the Cloud Controller may be retried indefinitely, so the API
+	// is served meanwhile and /health reports Watchtower as connecting.
+	go func() {
+		_, err := NewDetector(store, findings, dispatcher, historyStore, remediator, logger)
+		if err != nil {
+			logger.Fatalw("failed creating drift detector", "error", err.Error())
+		}
+		api.SetReady()
+	}()
+
+	err = api.Serve(store, findings, historyStore, remediator, logger)
 	if err != nil {
 		logger.Fatalw("failed serving api", "error", err.Error())
 	}
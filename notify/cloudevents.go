@@ -0,0 +1,148 @@
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+)
+
+// CloudEvents types of drift events
+const (
+	CloudEventDetected = "gov.gsa.watchtower.drift.detected"
+	CloudEventResolved = "gov.gsa.watchtower.drift.resolved"
+)
+
+const cloudEventsSpecVersion = "1.0"
+
+// cloudEvent is a CloudEvents v1.0 event in the structured JSON format. The
+// severity and driftkind extension attributes allow events to be filtered,
+// e.g. by Knative triggers, without parsing their data.
+type cloudEvent struct {
+	SpecVersion     string        `json:"specversion"`
+	ID              string        `json:"id"`
+	Source          string        `json:"source"`
+	Type            string        `json:"type"`
+	Subject         string        `json:"subject"`
+	Time            string        `json:"time"`
+	DataContentType string        `json:"datacontenttype"`
+	Severity        string        `json:"severity,omitempty"`
+	DriftKind       string        `json:"driftkind"`
+	Data            drift.Finding `json:"data"`
+}
+
+// cloudEvents sends each event as a CloudEvent over HTTP
+type cloudEvents struct {
+	config config.CloudEventsConfig
+	source string
+	client *http.Client
+}
+
+// newCloudEvents returns a CloudEvents notifier. defaultSource is used as the
+// source attribute if the config does not set one.
+func newCloudEvents(conf config.CloudEventsConfig, defaultSource string) *cloudEvents {
+	source := conf.Source
+	if source == "" {
+		source = defaultSource
+	}
+	return &cloudEvents{
+		config: conf,
+		source: source,
+		client: &http.Client{Timeout: conf.RequestTimeout()},
+	}
+}
+
+// newEventID returns a random CloudEvent ID
+func newEventID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// cloudEvent returns the CloudEvent for an event
+func (c *cloudEvents) cloudEvent(event Event) (cloudEvent, error) {
+	id, err := newEventID()
+	if err != nil {
+		return cloudEvent{}, err
+	}
+	eventType := CloudEventResolved
+	if event.Type == Detected {
+		eventType = CloudEventDetected
+	}
+	return cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              id,
+		Source:          c.source,
+		Type:            eventType,
+		Subject:         event.Finding.Key(),
+		Time:            event.Time.UTC().Format(time.RFC3339Nano),
+		DataContentType: "application/json",
+		Severity:        event.Finding.Severity,
+		DriftKind:       string(event.Finding.Kind),
+		Data:            event.Finding,
+	}, nil
+}
+
+// request returns the headers and body of the request for a CloudEvent, in the
+// configured content mode.
+func (c *cloudEvents) request(ce cloudEvent) (http.Header, []byte, error) {
+	header := make(http.Header)
+	for name, value := range c.config.Headers {
+		header.Set(name, value)
+	}
+
+	if !c.config.BinaryMode() {
+		body, err := json.Marshal(ce)
+		header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+		return header, body, err
+	}
+
+	// In binary mode, attributes are sent as ce- headers and the data as the body
+	body, err := json.Marshal(ce.Data)
+	header.Set("Content-Type", ce.DataContentType)
+	header.Set("ce-specversion", ce.SpecVersion)
+	header.Set("ce-id", ce.ID)
+	header.Set("ce-source", ce.Source)
+	header.Set("ce-type", ce.Type)
+	header.Set("ce-subject", ce.Subject)
+	header.Set("ce-time", ce.Time)
+	header.Set("ce-driftkind", ce.DriftKind)
+	if ce.Severity != "" {
+		header.Set("ce-severity", ce.Severity)
+	}
+	return header, body, err
+}
+
+// Notify sends a CloudEvent for each event. Retried requests resend the same
+// event ID, so that sinks can deduplicate them.
+func (c *cloudEvents) Notify(ctx context.Context, events []Event) error {
+	var errs []error
+	for _, event := range events {
+		ce, err := c.cloudEvent(event)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		header, body, err := c.request(ce)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		err = retry(ctx, c.config.Retries(), c.config.Backoff(), func() error {
+			return postHTTP(ctx, c.client, c.config.URL, header.Clone(), body)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s event for %s: %w", event.Type, event.Finding.Key(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
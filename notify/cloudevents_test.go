@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+)
+
+// cloudEventsRequest is a request received by a fake CloudEvents sink
+type cloudEventsRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// sendCloudEvent sends a single event to a fake sink with the given config mode,
+// returning the request the sink received.
+func sendCloudEvent(t *testing.T, mode string, event Event) cloudEventsRequest {
+	t.Helper()
+	requests := make(chan cloudEventsRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- cloudEventsRequest{header: r.Header, body: body}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	notifier := newCloudEvents(config.CloudEventsConfig{Name: "broker", URL: server.URL, Mode: mode}, "https://api.fr.cloud.gov")
+	if err := notifier.Notify(context.Background(), []Event{event}); err != nil {
+		t.Fatalf("CloudEvent failed to send: %v", err)
+	}
+	return <-requests
+}
+
+var cloudEventsEvent = Event{
+	Type:    Detected,
+	Time:    time.Date(2026, 10, 18, 14, 3, 11, 0, time.UTC),
+	Finding: drift.Finding{Kind: drift.UnknownApp, Resource: "rogue", Space: "dev", Severity: "critical"},
+}
+
+// TestCloudEventsStructured ensures that structured mode events contain every attribute and the finding as data.
+func TestCloudEventsStructured(t *testing.T) {
+	request := sendCloudEvent(t, "", cloudEventsEvent)
+	if contentType := request.header.Get("Content-Type"); contentType != "application/cloudevents+json; charset=utf-8" {
+		t.Fatalf("Structured mode content type incorrect. Found: %s", contentType)
+	}
+
+	var ce map[string]interface{}
+	if err := json.Unmarshal(request.body, &ce); err != nil {
+		t.Fatalf("CloudEvent is not JSON: %v", err)
+	}
+	expected := map[string]string{
+		"specversion":     "1.0",
+		"source":          "https://api.fr.cloud.gov",
+		"type":            "gov.gsa.watchtower.drift.detected",
+		"subject":         "unknown_app:rogue",
+		"time":            "2026-10-18T14:03:11Z",
+		"datacontenttype": "application/json",
+		"severity":        "critical",
+		"driftkind":       "unknown_app",
+	}
+	for attribute, value := range expected {
+		if ce[attribute] != value {
+			t.Fatalf("CloudEvent attribute %s incorrect. Expected: %s, Found: %v", attribute, value, ce[attribute])
+		}
+	}
+	if id, _ := ce["id"].(string); len(id) != 32 {
+		t.Fatalf("CloudEvent id incorrect. Found: %v", ce["id"])
+	}
+	if data, _ := ce["data"].(map[string]interface{}); data["resource"] != "rogue" || data["space"] != "dev" {
+		t.Fatalf("CloudEvent data incorrect. Found: %v", ce["data"])
+	}
+}
+
+// TestCloudEventsBinary ensures that binary mode events send attributes as headers and the finding as the body.
+func TestCloudEventsBinary(t *testing.T) {
+	event := cloudEventsEvent
+	event.Type = Resolved
+	request := sendCloudEvent(t, "binary", event)
+
+	expected := map[string]string{
+		"Content-Type":   "application/json",
+		"Ce-Specversion": "1.0",
+		"Ce-Type":        "gov.gsa.watchtower.drift.resolved",
+		"Ce-Source":      "https://api.fr.cloud.gov",
+		"Ce-Subject":     "unknown_app:rogue",
+		"Ce-Driftkind":   "unknown_app",
+	}
+	for header, value := range expected {
+		if request.header.Get(header) != value {
+			t.Fatalf("CloudEvent header %s incorrect. Expected: %s, Found: %s", header, value, request.header.Get(header))
+		}
+	}
+
+	var finding drift.Finding
+	if err := json.Unmarshal(request.body, &finding); err != nil || finding.Resource != "rogue" {
+		t.Fatalf("CloudEvent data incorrect. Found: %s", request.body)
+	}
+}
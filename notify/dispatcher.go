@@ -0,0 +1,201 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+	"go.uber.org/zap"
+)
+
+// Notifier delivers the events of a single detector run
+type Notifier interface {
+	Notify(ctx context.Context, events []Event) error
+}
+
+// DeliveryFunc is called with the result of every delivery to a notifier
+type DeliveryFunc func(notifier string, err error)
+
+// Dispatcher tracks the findings of successive detector runs, and sends the
+// events for findings that appear or resolve to the notifiers in the config.
+type Dispatcher struct {
+	logger    *zap.SugaredLogger
+	delivered DeliveryFunc
+	previous  map[string]drift.Finding
+	limiters  map[string]*rateLimiter   // Rate limiters of notifiers, by notifier name
+	digests   map[string]*digestState   // Schedules of email digests, by notifier name
+	queues    map[string]*notifierQueue // Undelivered events of notifiers, by notifier name
+	mut       sync.Mutex
+	sending   sync.WaitGroup
+}
+
+// queuedEvents are the events of a single update, queued for delivery to a notifier
+type queuedEvents struct {
+	notifier Notifier
+	events   []Event
+}
+
+// notifierQueue holds the events waiting to be delivered to a notifier. Events
+// are delivered one update at a time, in the order they were queued, so that a
+// finding's resolved event never arrives before its detected event.
+type notifierQueue struct {
+	pending  []queuedEvents
+	draining bool
+}
+
+// NewDispatcher returns a Dispatcher. delivered may be nil.
+func NewDispatcher(logger *zap.SugaredLogger, delivered DeliveryFunc) (*Dispatcher, error) {
+	if logger == nil {
+		return nil, errors.New("dispatcher cannot be created with nil logger")
+	}
+	if delivered == nil {
+		delivered = func(string, error) {}
+	}
+	return &Dispatcher{
+		logger:    logger.Named("notify"),
+		delivered: delivered,
+		limiters:  make(map[string]*rateLimiter),
+		digests:   make(map[string]*digestState),
+		queues:    make(map[string]*notifierQueue),
+	}, nil
+}
+
+// SetBaseline sets the findings that the first update is compared with, such as
+// the findings still open in the drift history, which were notified before
+// Watchtower restarted. Without a baseline, every finding of the first update is
+// sent as detected.
+func (d *Dispatcher) SetBaseline(findings []drift.Finding) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	d.previous = activeFindings(findings)
+}
+
+// limiter returns the rate limiter of the named notifier. Rate limiters are kept
+// across updates so that limits apply across detector runs, and are replaced
+// when their limits are changed by a reloaded config. d.mut must be held.
+func (d *Dispatcher) limiter(name string, limit int, period time.Duration) *rateLimiter {
+	limiter, ok := d.limiters[name]
+	if !ok || limiter.limit != limit || limiter.period != period {
+		limiter = newRateLimiter(limit, period)
+		d.limiters[name] = limiter
+	}
+	return limiter
+}
+
+// notifiers returns the notifiers configured in conf, by name. d.mut must be held.
+func (d *Dispatcher) notifiers(conf *config.Config) map[string]Notifier {
+	configured := make(map[string]Notifier)
+	for _, webhook := range conf.Data.Notifications.Webhooks {
+		configured["webhook:"+webhook.Name] = newWebhook(webhook)
+	}
+	for _, slack := range conf.Data.Notifications.Slack {
+		name := "slack:" + slack.Name
+		configured[name] = newSlack(slack, d.limiter(name, slack.MessageLimit(), slack.RatePeriod()))
+	}
+	for _, syslog := range conf.Data.Notifications.Syslog {
+		configured["syslog:"+syslog.Name] = newSyslog(syslog)
+	}
+	for _, sink := range conf.Data.Notifications.CloudEvents {
+		configured["cloudevents:"+sink.Name] = newCloudEvents(sink, conf.Data.GlobalConfig.CloudControllerURL)
+	}
+	return configured
+}
+
+// Update compares findings with those of the previous update, or the baseline,
+// and sends an event for each finding that appeared or resolved to every
+// notifier in conf. enabled are the kinds of drift whose checks are enabled, and
+// completed those whose checks ran to completion. Exempted findings are treated
+// as resolved. Findings of kinds whose checks were disabled are dropped without
+// a resolved event, and findings of kinds whose checks were skipped are kept as
+// they were, since neither means that the drift was fixed. Email digests that
+// are due are sent as well. Events and digests are delivered in the background,
+// so Update does not block on slow notifiers.
+func (d *Dispatcher) Update(conf *config.Config, findings []drift.Finding, enabled, completed []drift.Kind) {
+	now := time.Now()
+
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	previous := make(map[string]drift.Finding)
+	current := make(map[string]drift.Finding)
+	for key, finding := range activeFindings(findings) {
+		if slices.Contains(completed, finding.Kind) {
+			current[key] = finding
+		}
+	}
+	for key, finding := range d.previous {
+		switch {
+		case !slices.Contains(enabled, finding.Kind):
+			continue
+		case !slices.Contains(completed, finding.Kind):
+			current[key] = finding
+		}
+		previous[key] = finding
+	}
+	events := changes(previous, current, now)
+	d.previous = current
+	digests := d.dueDigests(conf, events, now)
+
+	for _, digest := range digests {
+		d.sending.Add(1)
+		go func(digest emailDigest) {
+			defer d.sending.Done()
+			d.sendDigest(digest)
+		}(digest)
+	}
+
+	if len(events) == 0 {
+		return
+	}
+	for name, notifier := range d.notifiers(conf) {
+		d.enqueue(name, queuedEvents{notifier: notifier, events: events})
+	}
+}
+
+// enqueue queues events for delivery to the named notifier, starting delivery
+// if the notifier has no delivery in progress. d.mut must be held.
+func (d *Dispatcher) enqueue(name string, queued queuedEvents) {
+	queue, ok := d.queues[name]
+	if !ok {
+		queue = &notifierQueue{}
+		d.queues[name] = queue
+	}
+	queue.pending = append(queue.pending, queued)
+	if queue.draining {
+		return
+	}
+	queue.draining = true
+	d.sending.Add(1)
+	go d.drain(name, queue)
+}
+
+// drain delivers the queued events of the named notifier in order, until its
+// queue is empty
+func (d *Dispatcher) drain(name string, queue *notifierQueue) {
+	defer d.sending.Done()
+	for {
+		d.mut.Lock()
+		if len(queue.pending) == 0 {
+			queue.draining = false
+			d.mut.Unlock()
+			return
+		}
+		queued := queue.pending[0]
+		queue.pending = queue.pending[1:]
+		d.mut.Unlock()
+
+		err := queued.notifier.Notify(context.Background(), queued.events)
+		if err != nil {
+			d.logger.Errorw("failed sending drift notification", "notifier", name, "error", err.Error())
+		}
+		d.delivered(name, err)
+	}
+}
+
+// Wait blocks until every event sent by Update has been delivered or has failed
+func (d *Dispatcher) Wait() {
+	d.sending.Wait()
+}
@@ -0,0 +1,125 @@
+package notify
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+	"go.uber.org/zap"
+)
+
+// TestDispatcherUpdate ensures that drift present at startup is notified unless
+// it is in the baseline, and that each notifier receives events in order.
+func TestDispatcherUpdate(t *testing.T) {
+	var bodies []string
+	var mut sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mut.Lock()
+		defer mut.Unlock()
+		// Delay the first delivery, so that later events would overtake it
+		if len(bodies) == 0 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		bodies = append(bodies, string(data))
+	}))
+	defer server.Close()
+
+	conf, err := config.Parse([]byte(`---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+notifications:
+  webhooks:
+    - name: chat
+      url: ` + server.URL + `
+      template: '{{.Type}} {{.Finding.Resource}}'`))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	rogue := drift.Finding{Kind: drift.UnknownApp, Resource: "rogue"}
+	web := drift.Finding{Kind: drift.AppSSH, Resource: "web"}
+
+	dispatcher, _ := NewDispatcher(zap.NewNop().Sugar(), nil)
+	dispatcher.SetBaseline([]drift.Finding{rogue})
+	dispatcher.Update(&conf, []drift.Finding{rogue, web}, drift.Kinds, drift.Kinds)
+	dispatcher.Update(&conf, nil, drift.Kinds, drift.Kinds)
+	dispatcher.Wait()
+	if !slices.Equal(bodies, []string{"detected web", "resolved web", "resolved rogue"}) &&
+		!slices.Equal(bodies, []string{"detected web", "resolved rogue", "resolved web"}) {
+		t.Fatalf("Events incorrect or out of order. Found: %q", bodies)
+	}
+
+	bodies = nil
+	dispatcher, _ = NewDispatcher(zap.NewNop().Sugar(), nil)
+	dispatcher.Update(&conf, []drift.Finding{rogue}, drift.Kinds, drift.Kinds)
+	dispatcher.Wait()
+	if !slices.Equal(bodies, []string{"detected rogue"}) {
+		t.Fatalf("Drift present at startup was not notified without a baseline. Found: %q", bodies)
+	}
+}
+
+// TestDispatcherSkippedChecks ensures that findings of checks that were skipped
+// or disabled are not notified as resolved.
+func TestDispatcherSkippedChecks(t *testing.T) {
+	var bodies []string
+	var mut sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mut.Lock()
+		defer mut.Unlock()
+		bodies = append(bodies, string(data))
+	}))
+	defer server.Close()
+
+	conf, err := config.Parse([]byte(`---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+notifications:
+  webhooks:
+    - name: chat
+      url: ` + server.URL + `
+      template: '{{.Type}} {{.Finding.Resource}}'`))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	rogue := drift.Finding{Kind: drift.UnknownApp, Resource: "rogue"}
+	web := drift.Finding{Kind: drift.AppSSH, Resource: "web"}
+	withoutSSH := []drift.Kind{drift.UnknownApp, drift.MissingApp}
+
+	dispatcher, _ := NewDispatcher(zap.NewNop().Sugar(), nil)
+	dispatcher.SetBaseline([]drift.Finding{rogue, web})
+
+	// The ssh check was skipped, so web is still open and rogue has resolved
+	dispatcher.Update(&conf, nil, drift.Kinds, withoutSSH)
+	dispatcher.Wait()
+	if !slices.Equal(bodies, []string{"resolved rogue"}) {
+		t.Fatalf("Findings of a skipped check were notified. Found: %q", bodies)
+	}
+
+	// web is still reported once the ssh check runs again
+	bodies = nil
+	dispatcher.Update(&conf, []drift.Finding{web}, drift.Kinds, drift.Kinds)
+	dispatcher.Wait()
+	if len(bodies) != 0 {
+		t.Fatalf("Findings of a skipped check were notified again. Found: %q", bodies)
+	}
+
+	// The ssh check was disabled, which does not resolve web
+	dispatcher.Update(&conf, nil, withoutSSH, withoutSSH)
+	dispatcher.Wait()
+	if len(bodies) != 0 {
+		t.Fatalf("Findings of a disabled check were notified as resolved. Found: %q", bodies)
+	}
+}
@@ -0,0 +1,300 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+)
+
+// Delivery settings for email digests
+const (
+	emailRetries = 3
+	emailBackoff = 30 * time.Second
+	smtpTimeout  = time.Minute
+
+	// noSpace groups the findings that are not about a particular space
+	noSpace = "(none)"
+
+	digestDateFormat = "2006-01-02 15:04 MST"
+)
+
+// digestState tracks the schedule of an email digest and the events since the
+// last digest was sent.
+type digestState struct {
+	next     time.Time
+	schedule string // SendAt and TimeZone the next digest was scheduled with
+	detected int
+	resolved int
+	sending  bool
+}
+
+// emailDigest is a digest that is due to be sent
+type emailDigest struct {
+	name     string
+	config   config.EmailConfig
+	state    *digestState
+	findings []drift.Finding
+	detected int
+	resolved int
+	time     time.Time
+}
+
+// dueDigests counts events towards every email digest in conf, and returns the
+// digests that are due at time now. d.mut must be held.
+func (d *Dispatcher) dueDigests(conf *config.Config, events []Event, now time.Time) []emailDigest {
+	var due []emailDigest
+	configured := make(map[string]bool)
+	for _, email := range conf.Data.Notifications.Email {
+		name := "email:" + email.Name
+		configured[name] = true
+
+		state, ok := d.digests[name]
+		if !ok {
+			state = &digestState{}
+			d.digests[name] = state
+		}
+		if schedule := email.SendAt + " " + email.TimeZone; !ok || state.schedule != schedule {
+			state.next, state.schedule = email.NextDigest(now), schedule
+		}
+
+		for _, event := range events {
+			if event.Type == Detected {
+				state.detected++
+			} else {
+				state.resolved++
+			}
+		}
+
+		if now.Before(state.next) || state.sending {
+			continue
+		}
+		state.next = email.NextDigest(now)
+		state.sending = true
+
+		var findings []drift.Finding
+		for _, finding := range d.previous {
+			findings = append(findings, finding)
+		}
+		drift.Sort(findings)
+		due = append(due, emailDigest{
+			name:     name,
+			config:   email,
+			state:    state,
+			findings: findings,
+			detected: state.detected,
+			resolved: state.resolved,
+			time:     now,
+		})
+	}
+
+	for name := range d.digests {
+		if !configured[name] {
+			delete(d.digests, name)
+		}
+	}
+	return due
+}
+
+// sendDigest sends a due digest. Events counted in a digest that fails to send
+// are counted again in the next digest.
+func (d *Dispatcher) sendDigest(digest emailDigest) {
+	message := digestMessage(digest)
+	err := retry(context.Background(), emailRetries, emailBackoff, func() error {
+		return sendMail(&digest.config, nil, message)
+	})
+
+	d.mut.Lock()
+	digest.state.sending = false
+	if err == nil {
+		digest.state.detected -= digest.detected
+		digest.state.resolved -= digest.resolved
+	}
+	d.mut.Unlock()
+
+	if err != nil {
+		d.logger.Errorw("failed sending drift digest", "notifier", digest.name, "error", err.Error())
+	}
+	d.delivered(digest.name, err)
+}
+
+// findingSpace returns the space a finding is grouped under in a digest
+func findingSpace(finding drift.Finding) string {
+	switch {
+	case finding.Kind.IsSpace():
+		return finding.Resource
+	case finding.Space != "":
+		return finding.Space
+	}
+	return noSpace
+}
+
+// describeFinding returns a single line description of a finding for a digest
+func describeFinding(finding drift.Finding, location *time.Location) string {
+	description := string(finding.Kind) + ": " + finding.Resource
+	if finding.Route != "" {
+		description += " " + finding.Route
+	}
+	if len(finding.Details) != 0 {
+		description += " (" + strings.Join(finding.Details, ", ") + ")"
+	}
+	if !finding.FirstSeen.IsZero() {
+		description += ", first seen " + finding.FirstSeen.In(location).Format(digestDateFormat)
+	}
+	if event := finding.AuditEvent; event != nil {
+		description += ", " + event.Type + " by " + event.Actor + " at " + event.Time.In(location).Format(digestDateFormat)
+	}
+	return description
+}
+
+// digestBody renders the plain text body of a digest, listing the open findings
+// grouped by space and severity.
+func digestBody(digest emailDigest) string {
+	location := digest.config.Location()
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s, %s\n\n", digest.config.DigestSubject(), digest.time.In(location).Format(digestDateFormat))
+	fmt.Fprintf(&body, "Open findings: %d\n", len(digest.findings))
+	fmt.Fprintf(&body, "New since the last digest: %d\n", digest.detected)
+	fmt.Fprintf(&body, "Resolved since the last digest: %d\n", digest.resolved)
+
+	bySpace := make(map[string]map[string][]drift.Finding)
+	for _, finding := range digest.findings {
+		space := findingSpace(finding)
+		if bySpace[space] == nil {
+			bySpace[space] = make(map[string][]drift.Finding)
+		}
+		bySpace[space][finding.Severity] = append(bySpace[space][finding.Severity], finding)
+	}
+
+	var spaces []string
+	for space := range bySpace {
+		spaces = append(spaces, space)
+	}
+	sort.Slice(spaces, func(i, j int) bool {
+		// List findings without a space last
+		if (spaces[i] == noSpace) != (spaces[j] == noSpace) {
+			return spaces[j] == noSpace
+		}
+		return spaces[i] < spaces[j]
+	})
+
+	// List the most severe findings first
+	severities := slices.Clone(config.Severities)
+	slices.Reverse(severities)
+
+	for _, space := range spaces {
+		fmt.Fprintf(&body, "\nSpace: %s\n", space)
+		for _, severity := range severities {
+			findings := bySpace[space][severity]
+			if len(findings) == 0 {
+				continue
+			}
+			fmt.Fprintf(&body, "  %s (%d)\n", severity, len(findings))
+			for _, finding := range findings {
+				fmt.Fprintf(&body, "    - %s\n", describeFinding(finding, location))
+			}
+		}
+	}
+	return body.String()
+}
+
+// digestMessage returns the email message of a digest, with CRLF line endings
+func digestMessage(digest emailDigest) []byte {
+	var message bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&message, "%s: %s\r\n", name, value)
+	}
+	header("From", digest.config.From)
+	header("To", strings.Join(digest.config.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", digest.config.DigestSubject()))
+	header("Date", digest.time.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	message.WriteString("\r\n")
+	message.WriteString(strings.ReplaceAll(digestBody(digest), "\n", "\r\n"))
+	return message.Bytes()
+}
+
+// smtpError marks SMTP permanent failure replies (5xx) as permanent errors
+func smtpError(err error) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return permanent(err)
+	}
+	return err
+}
+
+// sendMail sends message to the recipients of an email digest. tlsConfig is used
+// for STARTTLS, and defaults to verifying the certificate of the SMTP host.
+func sendMail(conf *config.EmailConfig, tlsConfig *tls.Config, message []byte) error {
+	conn, err := net.DialTimeout("tcp", conf.Address(), smtpTimeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, conf.Host)
+	if err != nil {
+		conn.Close()
+		return smtpError(err)
+	}
+	defer client.Close()
+
+	if conf.UseStartTLS() {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return permanent(errors.New("SMTP server does not support STARTTLS"))
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: conf.Host, MinVersion: tls.VersionTLS12}
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return smtpError(err)
+		}
+	}
+	if conf.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", conf.Username, conf.Password, conf.Host)); err != nil {
+			return smtpError(err)
+		}
+	}
+
+	// Addresses were validated when the config was loaded
+	from, _ := mail.ParseAddress(conf.From)
+	if err := client.Mail(from.Address); err != nil {
+		return smtpError(err)
+	}
+	for _, to := range conf.To {
+		recipient, _ := mail.ParseAddress(to)
+		if err := client.Rcpt(recipient.Address); err != nil {
+			return smtpError(err)
+		}
+	}
+
+	data, err := client.Data()
+	if err != nil {
+		return smtpError(err)
+	}
+	if _, err := data.Write(message); err != nil {
+		return err
+	}
+	if err := data.Close(); err != nil {
+		return smtpError(err)
+	}
+	return client.Quit()
+}
@@ -0,0 +1,237 @@
+package notify
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+	"go.uber.org/zap"
+)
+
+// smtpSession is what a fake SMTP server received in a single session
+type smtpSession struct {
+	auth string
+	rcpt []string
+	data string
+}
+
+// fakeSMTPServer accepts a single SMTP session, advertising the given extensions,
+// and sends what it received on the returned channel.
+func fakeSMTPServer(t *testing.T, extensions ...string) (string, <-chan smtpSession) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var session smtpSession
+		reader := bufio.NewReader(conn)
+		reply := func(lines ...string) {
+			for _, line := range lines {
+				conn.Write([]byte(line + "\r\n"))
+			}
+		}
+		reply("220 localhost ESMTP")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				sessions <- session
+				return
+			}
+			line = strings.TrimSpace(line)
+			command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch command {
+			case "EHLO":
+				lines := []string{"250-localhost"}
+				for _, extension := range extensions {
+					lines = append(lines, "250-"+extension)
+				}
+				reply(append(lines, "250 8BITMIME")...)
+			case "AUTH":
+				session.auth = line
+				reply("235 Authentication succeeded")
+			case "RCPT":
+				session.rcpt = append(session.rcpt, line)
+				reply("250 OK")
+			case "DATA":
+				reply("354 Go ahead")
+				var data strings.Builder
+				for {
+					dataLine, _ := reader.ReadString('\n')
+					if dataLine == ".\r\n" || dataLine == "" {
+						break
+					}
+					data.WriteString(dataLine)
+				}
+				session.data = data.String()
+				reply("250 Queued")
+			case "QUIT":
+				reply("221 Bye")
+				sessions <- session
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return listener.Addr().String(), sessions
+}
+
+// parseEmail returns the email digest defined by the given 'notifications:email' entry
+func parseEmail(t *testing.T, entry string) config.EmailConfig {
+	t.Helper()
+	conf, err := config.Parse([]byte(`---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+notifications:
+  email:
+` + entry))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+	return conf.Data.Notifications.Email[0]
+}
+
+// TestSendDigest ensures that digests are sent with authentication to every recipient.
+func TestSendDigest(t *testing.T) {
+	address, sessions := fakeSMTPServer(t, "AUTH PLAIN")
+	host, port, _ := net.SplitHostPort(address)
+	email := parseEmail(t, `    - name: compliance
+      host: `+host+`
+      port: `+port+`
+      starttls: false
+      username: watchtower
+      password: s3cret
+      from: Watchtower <watchtower@example.gov>
+      to: [officer@example.gov, team@example.gov]`)
+
+	digest := emailDigest{
+		config:   email,
+		findings: []drift.Finding{{Kind: drift.UnknownApp, Resource: "rogue", Space: "dev", Severity: "warning"}},
+		detected: 1,
+		time:     time.Now(),
+	}
+	if err := sendMail(&email, nil, digestMessage(digest)); err != nil {
+		t.Fatalf("Digest failed to send: %v", err)
+	}
+
+	session := <-sessions
+	if !strings.HasPrefix(session.auth, "AUTH PLAIN ") {
+		t.Fatalf("Digest was not sent with authentication. Found: %q", session.auth)
+	}
+	if len(session.rcpt) != 2 || !strings.Contains(session.rcpt[1], "team@example.gov") {
+		t.Fatalf("Digest recipients incorrect. Found: %v", session.rcpt)
+	}
+	if !strings.Contains(session.data, "Subject: Watchtower drift digest\r\n") || !strings.Contains(session.data, "unknown_app: rogue") {
+		t.Fatalf("Digest message incorrect. Found:\n%s", session.data)
+	}
+}
+
+// TestSendDigestRequiresStartTLS ensures that digests are not sent unencrypted when STARTTLS is required.
+func TestSendDigestRequiresStartTLS(t *testing.T) {
+	address, _ := fakeSMTPServer(t)
+	host, port, _ := net.SplitHostPort(address)
+	email := parseEmail(t, `    - name: compliance
+      host: `+host+`
+      port: `+port+`
+      from: watchtower@example.gov
+      to: [officer@example.gov]`)
+
+	err := sendMail(&email, nil, []byte("test"))
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("Digest was sent without STARTTLS. Error: %v", err)
+	}
+}
+
+// TestDigestBody ensures that digests group open findings by space and severity.
+func TestDigestBody(t *testing.T) {
+	email := parseEmail(t, "    - name: compliance\n      host: localhost\n      from: a@example.gov\n      to: [b@example.gov]")
+	body := digestBody(emailDigest{
+		config: email,
+		findings: []drift.Finding{
+			{Kind: drift.MissingApp, Resource: "worker", Severity: "warning"},
+			{Kind: drift.SpaceSSH, Resource: "prod", Severity: "critical"},
+			{Kind: drift.UnknownApp, Resource: "rogue", Space: "dev", Severity: "info"},
+			{Kind: drift.AppSSH, Resource: "web", Space: "dev", Severity: "critical"},
+		},
+		detected: 3,
+		resolved: 2,
+		time:     time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC),
+	})
+
+	expected := `Watchtower drift digest, 2026-10-18 08:00 UTC
+
+Open findings: 4
+New since the last digest: 3
+Resolved since the last digest: 2
+
+Space: dev
+  critical (1)
+    - app_ssh: web
+  info (1)
+    - unknown_app: rogue
+
+Space: prod
+  critical (1)
+    - space_ssh: prod
+
+Space: (none)
+  warning (1)
+    - missing_app: worker
+`
+	if body != expected {
+		t.Fatalf("Digest body incorrect. Expected:\n%s\nFound:\n%s", expected, body)
+	}
+}
+
+// TestDueDigests ensures that digests are sent once per day with the events since the last digest.
+func TestDueDigests(t *testing.T) {
+	conf, err := config.Parse([]byte(`---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+notifications:
+  email:
+    - name: compliance
+      host: localhost
+      from: watchtower@example.gov
+      to: [officer@example.gov]
+      send_at: "09:30"`))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+
+	dispatcher, _ := NewDispatcher(zap.NewNop().Sugar(), nil)
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	if due := dispatcher.dueDigests(&conf, nil, start); len(due) != 0 {
+		t.Fatal("Digest was sent before it was due")
+	}
+
+	events := []Event{{Type: Detected}, {Type: Detected}, {Type: Resolved}}
+	due := dispatcher.dueDigests(&conf, events, start.Add(45*time.Minute))
+	if len(due) != 1 || due[0].detected != 2 || due[0].resolved != 1 {
+		t.Fatalf("Due digest incorrect. Found: %+v", due)
+	}
+	if next := due[0].state.next; !next.Equal(time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)) {
+		t.Fatalf("Next digest was not scheduled for the next day. Found: %v", next)
+	}
+	if due := dispatcher.dueDigests(&conf, nil, start.Add(time.Hour)); len(due) != 0 {
+		t.Fatal("Digest was sent twice in one day")
+	}
+}
@@ -0,0 +1,60 @@
+// Package notify sends notifications when drift findings appear or resolve.
+package notify
+
+import (
+	"time"
+
+	"github.com/18F/watchtower/drift"
+)
+
+// EventType identifies whether an Event reports new or resolved drift
+type EventType string
+
+// Types of Event sent to notifiers
+const (
+	Detected EventType = "detected"
+	Resolved EventType = "resolved"
+)
+
+// Event reports that a finding appeared or resolved between two detector runs
+type Event struct {
+	Type    EventType     `json:"type"`
+	Time    time.Time     `json:"time"`
+	Finding drift.Finding `json:"finding"`
+}
+
+// activeFindings returns the findings that are not exempted, by key
+func activeFindings(findings []drift.Finding) map[string]drift.Finding {
+	active := make(map[string]drift.Finding)
+	for _, finding := range drift.Active(findings) {
+		active[finding.Key()] = finding
+	}
+	return active
+}
+
+// changes returns an Event for every finding in current that is not in previous,
+// and for every finding in previous that is not in current, in finding order.
+func changes(previous, current map[string]drift.Finding, now time.Time) []Event {
+	var detected, resolved []drift.Finding
+	for key, finding := range current {
+		if _, ok := previous[key]; !ok {
+			detected = append(detected, finding)
+		}
+	}
+	for key, finding := range previous {
+		if _, ok := current[key]; !ok {
+			resolved = append(resolved, finding)
+		}
+	}
+	drift.Sort(detected)
+	drift.Sort(resolved)
+
+	var events []Event
+	for _, finding := range detected {
+		events = append(events, Event{Type: Detected, Time: now, Finding: finding})
+	}
+	for _, finding := range resolved {
+		events = append(events, Event{Type: Resolved, Time: now, Finding: finding})
+	}
+	return events
+}
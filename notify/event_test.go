@@ -0,0 +1,32 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/18F/watchtower/drift"
+)
+
+// TestChanges ensures that events are only created for findings that appear or resolve.
+func TestChanges(t *testing.T) {
+	previous := activeFindings([]drift.Finding{
+		{Kind: drift.UnknownApp, Resource: "rogue"},
+		{Kind: drift.AppSSH, Resource: "web"},
+	})
+	current := activeFindings([]drift.Finding{
+		{Kind: drift.AppSSH, Resource: "web"},
+		{Kind: drift.MissingRoute, Resource: "api", Route: "api.app.cloud.gov"},
+		{Kind: drift.UnknownApp, Resource: "debug", Exemption: &drift.Exemption{Reason: "Debugging"}},
+	})
+
+	events := changes(previous, current, time.Now())
+	if len(events) != 2 {
+		t.Fatalf("Incorrect number of events. Found: %+v", events)
+	}
+	if events[0].Type != Detected || events[0].Finding.Resource != "api" {
+		t.Fatalf("Appeared finding was not detected. Found: %+v", events[0])
+	}
+	if events[1].Type != Resolved || events[1].Finding.Resource != "rogue" {
+		t.Fatalf("Removed finding was not resolved. Found: %+v", events[1])
+	}
+}
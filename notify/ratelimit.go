@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter allows at most limit messages in any period
+type rateLimiter struct {
+	limit  int
+	period time.Duration
+	sent   []time.Time
+	mut    sync.Mutex
+}
+
+func newRateLimiter(limit int, period time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, period: period}
+}
+
+// allow records a message sent at time now, unless that would exceed the limit
+func (l *rateLimiter) allow(now time.Time) bool {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	// Forget messages sent before the current period
+	recent := l.sent[:0]
+	for _, sent := range l.sent {
+		if now.Sub(sent) < l.period {
+			recent = append(recent, sent)
+		}
+	}
+	l.sent = recent
+
+	if len(l.sent) >= l.limit {
+		return false
+	}
+	l.sent = append(l.sent, now)
+	return true
+}
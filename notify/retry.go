@@ -0,0 +1,47 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// permanentError is an error that retrying will not fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// permanent marks err as an error that should not be retried
+func permanent(err error) error {
+	return &permanentError{err}
+}
+
+// retry calls send until it succeeds, returns a permanent error, or has been
+// retried the given number of times. The delay between attempts starts at
+// backoff and doubles after every retry.
+func retry(ctx context.Context, retries int, backoff time.Duration, send func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := send()
+		var permanentErr *permanentError
+		if err == nil || attempt == retries || errors.As(err, &permanentErr) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
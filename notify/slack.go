@@ -0,0 +1,182 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+)
+
+// Delivery settings for Slack messages
+const (
+	slackRetries = 3
+	slackBackoff = time.Second
+	slackTimeout = 10 * time.Second
+
+	// maxSlackFindings is the number of findings listed in a single message,
+	// keeping messages well under the Block Kit limit of 50 blocks.
+	maxSlackFindings = 20
+)
+
+// slackText is a Block Kit text object
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// slackBlock is a Block Kit header, section or context block
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Fields   []slackText `json:"fields,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+// slackMessage is the payload of a Slack incoming webhook request
+type slackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+// slack sends a Block Kit message to a Slack incoming webhook for each group of
+// events with the same type and drift kind.
+type slack struct {
+	config  config.SlackConfig
+	limiter *rateLimiter
+	client  *http.Client
+}
+
+func newSlack(conf config.SlackConfig, limiter *rateLimiter) *slack {
+	return &slack{
+		config:  conf,
+		limiter: limiter,
+		client:  &http.Client{Timeout: slackTimeout},
+	}
+}
+
+// groupEvents splits events into groups of the same type and drift kind,
+// preserving their order.
+func groupEvents(events []Event) [][]Event {
+	var groups [][]Event
+	for i, event := range events {
+		if i == 0 || event.Type != events[i-1].Type || event.Finding.Kind != events[i-1].Finding.Kind {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], event)
+	}
+	return groups
+}
+
+// Notify sends a message for each group of similar events. Messages over the
+// rate limit are dropped and reported as an error.
+func (s *slack) Notify(ctx context.Context, events []Event) error {
+	var errs []error
+	var dropped int
+	for _, group := range groupEvents(events) {
+		if !s.limiter.allow(time.Now()) {
+			dropped++
+			continue
+		}
+		body, err := json.Marshal(s.message(group))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := retry(ctx, slackRetries, slackBackoff, func() error { return s.post(ctx, body) }); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if dropped != 0 {
+		errs = append(errs, fmt.Errorf("rate limit of %d messages per %s reached, dropped %d messages",
+			s.limiter.limit, s.limiter.period, dropped))
+	}
+	return errors.Join(errs...)
+}
+
+// escapeSlack escapes the characters that Slack mrkdwn treats as control characters
+func escapeSlack(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// slackDate formats t for Slack, which displays it in the reader's time zone
+func slackDate(t time.Time) string {
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", t.Unix(), t.UTC().Format(time.RFC3339))
+}
+
+// driftURL returns the link to the finding in the /drift endpoint, or "" if
+// Watchtower's URL is not configured.
+func (s *slack) driftURL(finding drift.Finding) string {
+	if s.config.WatchtowerURL == "" {
+		return ""
+	}
+	query := url.Values{"kind": {string(finding.Kind)}, "resource": {finding.Resource}}
+	return strings.TrimSuffix(s.config.WatchtowerURL, "/") + "/drift?" + query.Encode()
+}
+
+// findingBlock returns the section describing a single finding
+func (s *slack) findingBlock(finding drift.Finding) slackBlock {
+	resource := "*" + escapeSlack(finding.Resource) + "*"
+	if link := s.driftURL(finding); link != "" {
+		resource = "*<" + link + "|" + escapeSlack(finding.Resource) + ">*"
+	}
+
+	field := func(name, value string) slackText {
+		return slackText{Type: "mrkdwn", Text: "*" + name + "*\n" + value}
+	}
+	fields := []slackText{field("Kind", string(finding.Kind))}
+	if finding.Space != "" {
+		fields = append(fields, field("Space", escapeSlack(finding.Space)))
+	}
+	if finding.Route != "" {
+		fields = append(fields, field("Route", escapeSlack(finding.Route)))
+	}
+	if len(finding.Details) != 0 {
+		fields = append(fields, field("Details", escapeSlack(strings.Join(finding.Details, ", "))))
+	}
+	if finding.Severity != "" {
+		fields = append(fields, field("Severity", finding.Severity))
+	}
+	if !finding.FirstSeen.IsZero() {
+		fields = append(fields, field("First seen", slackDate(finding.FirstSeen)))
+	}
+	if event := finding.AuditEvent; event != nil {
+		fields = append(fields, field("Changed by", escapeSlack(event.Actor)+" ("+event.Type+", "+slackDate(event.Time)+")"))
+	}
+
+	return slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: resource}, Fields: fields}
+}
+
+// message returns the message for a group of events with the same type and kind
+func (s *slack) message(group []Event) slackMessage {
+	title := fmt.Sprintf("Drift %s: %s (%d)", group[0].Type, group[0].Finding.Kind, len(group))
+	message := slackMessage{
+		Text:   title,
+		Blocks: []slackBlock{{Type: "header", Text: &slackText{Type: "plain_text", Text: title}}},
+	}
+	for i, event := range group {
+		if i == maxSlackFindings {
+			more := fmt.Sprintf("and %d more", len(group)-maxSlackFindings)
+			message.Blocks = append(message.Blocks, slackBlock{
+				Type:     "context",
+				Elements: []slackText{{Type: "mrkdwn", Text: more}},
+			})
+			break
+		}
+		message.Blocks = append(message.Blocks, s.findingBlock(event.Finding))
+	}
+	return message
+}
+
+// post sends a single message to the incoming webhook
+func (s *slack) post(ctx context.Context, body []byte) error {
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	return postHTTP(ctx, s.client, s.config.WebhookURL, header, body)
+}
@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+)
+
+// slackServer records the messages posted to a fake Slack incoming webhook
+func slackServer(t *testing.T) (*httptest.Server, *[]slackMessage) {
+	t.Helper()
+	var messages []slackMessage
+	var mut sync.Mutex
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message slackMessage
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mut.Lock()
+		messages = append(messages, message)
+		mut.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return server, &messages
+}
+
+// TestSlackGrouping ensures that similar events are sent in a single message linking to /drift.
+func TestSlackGrouping(t *testing.T) {
+	server, messages := slackServer(t)
+	notifier := newSlack(config.SlackConfig{
+		Name:          "platform",
+		WebhookURL:    server.URL,
+		WatchtowerURL: "https://watchtower.example.com/",
+	}, newRateLimiter(10, time.Hour))
+	notifier.client = server.Client()
+
+	seen := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Type: Detected, Finding: drift.Finding{Kind: drift.UnknownApp, Resource: "rogue", Space: "dev", FirstSeen: seen}},
+		{Type: Detected, Finding: drift.Finding{Kind: drift.UnknownApp, Resource: "debug<1>", Space: "dev", FirstSeen: seen}},
+		{Type: Resolved, Finding: drift.Finding{Kind: drift.AppSSH, Resource: "web", FirstSeen: seen}},
+	}
+	if err := notifier.Notify(context.Background(), events); err != nil {
+		t.Fatalf("Slack notification failed: %v", err)
+	}
+
+	if len(*messages) != 2 {
+		t.Fatalf("Events were not grouped by type and kind. Found %d messages", len(*messages))
+	}
+	detected := (*messages)[0]
+	if detected.Text != "Drift detected: unknown_app (2)" || len(detected.Blocks) != 3 {
+		t.Fatalf("Detected message incorrect. Found: %+v", detected)
+	}
+	section := detected.Blocks[1]
+	if section.Text.Text != "*<https://watchtower.example.com/drift?kind=unknown_app&resource=rogue|rogue>*" {
+		t.Fatalf("Finding was not linked to /drift. Found: %q", section.Text.Text)
+	}
+	if !strings.Contains(section.Fields[1].Text, "dev") || !strings.Contains(section.Fields[2].Text, "<!date^1792314000^") {
+		t.Fatalf("Finding fields incorrect. Found: %+v", section.Fields)
+	}
+	if !strings.Contains(detected.Blocks[2].Text.Text, "debug&lt;1&gt;") {
+		t.Fatalf("Resource name was not escaped. Found: %q", detected.Blocks[2].Text.Text)
+	}
+}
+
+// TestSlackRateLimit ensures that messages over the rate limit are dropped.
+func TestSlackRateLimit(t *testing.T) {
+	server, messages := slackServer(t)
+	notifier := newSlack(config.SlackConfig{Name: "platform", WebhookURL: server.URL}, newRateLimiter(1, time.Hour))
+	notifier.client = server.Client()
+
+	events := []Event{
+		{Type: Detected, Finding: drift.Finding{Kind: drift.UnknownApp, Resource: "rogue"}},
+		{Type: Detected, Finding: drift.Finding{Kind: drift.MissingApp, Resource: "api"}},
+	}
+	err := notifier.Notify(context.Background(), events)
+	if err == nil || !strings.Contains(err.Error(), "dropped 1 messages") || len(*messages) != 1 {
+		t.Fatalf("Rate limit was not enforced. Messages: %d, error: %v", len(*messages), err)
+	}
+
+	limiter := newRateLimiter(1, time.Minute)
+	now := time.Now()
+	if !limiter.allow(now) || limiter.allow(now.Add(30*time.Second)) || !limiter.allow(now.Add(time.Minute)) {
+		t.Fatal("Rate limiter did not allow messages once the period passed")
+	}
+}
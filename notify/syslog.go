@@ -0,0 +1,237 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/18F/watchtower/config"
+)
+
+// Delivery settings for syslog messages
+const (
+	syslogRetries = 3
+	syslogBackoff = time.Second
+	syslogTimeout = 10 * time.Second
+
+	defaultSyslogAppName = "watchtower"
+	syslogTimeFormat     = "2006-01-02T15:04:05.000000Z07:00"
+
+	// nilValue is sent for syslog header fields that are unknown
+	nilValue = "-"
+)
+
+// Syslog severities (RFC 5424 section 6.2.1) of drift events
+const (
+	syslogCritical = 2
+	syslogWarning  = 4
+	syslogNotice   = 5
+	syslogInfo     = 6
+)
+
+// CEF header fields identifying Watchtower as the source of events
+const (
+	cefVendor  = "18F"
+	cefProduct = "Watchtower"
+)
+
+// cefSeverities map finding severities to CEF severities (0-10). Resolved
+// events have severity cefResolved.
+var cefSeverities = map[string]int{
+	config.SeverityInfo:     3,
+	config.SeverityWarning:  6,
+	config.SeverityCritical: 9,
+}
+
+const cefResolved = 1
+
+// syslogSeverities map finding severities to syslog severities. Resolved events
+// have severity syslogNotice.
+var syslogSeverities = map[string]int{
+	config.SeverityInfo:     syslogInfo,
+	config.SeverityWarning:  syslogWarning,
+	config.SeverityCritical: syslogCritical,
+}
+
+// syslog sends each event as an RFC 5424 message with a CEF payload
+type syslog struct {
+	config   config.SyslogConfig
+	hostname string
+	appName  string
+	connect  func(ctx context.Context) (net.Conn, error)
+}
+
+func newSyslog(conf config.SyslogConfig) *syslog {
+	hostname := conf.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+		if hostname == "" || strings.IndexFunc(hostname, func(c rune) bool { return c < 33 || c > 126 }) != -1 {
+			hostname = nilValue
+		}
+	}
+	appName := conf.AppName
+	if appName == "" {
+		appName = defaultSyslogAppName
+	}
+	output := &syslog{config: conf, hostname: hostname, appName: appName}
+	output.connect = output.dial
+	return output
+}
+
+// dial connects to the syslog server
+func (s *syslog) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogTimeout}
+	if s.config.Transport() != "tls" {
+		return dialer.DialContext(ctx, s.config.Transport(), s.config.Address)
+	}
+
+	host, _, _ := net.SplitHostPort(s.config.Address)
+	tlsDialer := &tls.Dialer{
+		NetDialer: dialer,
+		Config: &tls.Config{
+			ServerName: host,
+			RootCAs:    s.config.RootCAs(),
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+	return tlsDialer.DialContext(ctx, "tcp", s.config.Address)
+}
+
+// Notify sends a message for each event over a single connection. If the
+// connection fails, the events not yet sent are retried over a new connection.
+func (s *syslog) Notify(ctx context.Context, events []Event) error {
+	sent := 0
+	return retry(ctx, syslogRetries, syslogBackoff, func() error {
+		conn, err := s.connect(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		if err := conn.SetWriteDeadline(time.Now().Add(syslogTimeout)); err != nil {
+			return err
+		}
+		for ; sent < len(events); sent++ {
+			message := s.message(events[sent])
+			if s.config.Transport() != "udp" {
+				// Octet counting framing (RFC 6587 section 3.4.1, RFC 5425 section 4.3)
+				message = strconv.Itoa(len(message)) + " " + message
+			}
+			if _, err := conn.Write([]byte(message)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// message returns the RFC 5424 message for an event
+func (s *syslog) message(event Event) string {
+	severity := syslogNotice
+	msgID := "DRIFT_RESOLVED"
+	if event.Type == Detected {
+		severity = syslogSeverities[event.Finding.Severity]
+		if severity == 0 {
+			severity = syslogWarning
+		}
+		msgID = "DRIFT_DETECTED"
+	}
+	priority := s.config.FacilityCode()*8 + severity
+
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s", priority, event.Time.UTC().Format(syslogTimeFormat),
+		s.hostname, s.appName, os.Getpid(), msgID, nilValue, cefMessage(event, s.hostname))
+}
+
+// watchtowerVersion returns the version of the Watchtower module, if it was
+// built from a tagged version.
+func watchtowerVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// escapeCEFHeader escapes a CEF header field
+func escapeCEFHeader(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`, "\n", " ", "\r", " ").Replace(value)
+}
+
+// escapeCEFValue escapes a CEF extension value
+func escapeCEFValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, "\n", `\n`, "\r", `\r`).Replace(value)
+}
+
+// cefMessage returns the CEF payload of an event. The extension keys and custom
+// string labels are a stable interface for SIEM correlation rules, and must not
+// be changed.
+func cefMessage(event Event, hostname string) string {
+	finding := event.Finding
+	severity := cefResolved
+	if event.Type == Detected {
+		severity = cefSeverities[finding.Severity]
+		if severity == 0 {
+			severity = cefSeverities[config.SeverityWarning]
+		}
+	}
+	category := "app"
+	if finding.Kind.IsSpace() {
+		category = "space"
+	}
+
+	header := []string{
+		"CEF:0",
+		escapeCEFHeader(cefVendor),
+		escapeCEFHeader(cefProduct),
+		escapeCEFHeader(watchtowerVersion()),
+		escapeCEFHeader(string(finding.Kind)),
+		escapeCEFHeader(fmt.Sprintf("Drift %s: %s", event.Type, finding.Kind)),
+		strconv.Itoa(severity),
+	}
+
+	var extension []string
+	add := func(key, value string) {
+		if value != "" {
+			extension = append(extension, key+"="+escapeCEFValue(value))
+		}
+	}
+	addLabelled := func(key, label, value string) {
+		if value != "" {
+			add(key, value)
+			add(key+"Label", label)
+		}
+	}
+	milliseconds := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	}
+
+	add("rt", milliseconds(event.Time))
+	add("act", string(event.Type))
+	add("cat", category)
+	add("externalId", finding.Key())
+	if hostname != nilValue {
+		add("dvchost", hostname)
+	}
+	add("start", milliseconds(finding.FirstSeen))
+	add("request", finding.Route)
+	addLabelled("cs1", "resource", finding.Resource)
+	addLabelled("cs2", "space", finding.Space)
+	addLabelled("cs3", "configEntry", finding.Entry)
+	addLabelled("cs4", "details", strings.Join(finding.Details, ","))
+	addLabelled("cs5", "severity", finding.Severity)
+	if event := finding.AuditEvent; event != nil {
+		add("suser", event.Actor)
+		addLabelled("cs6", "auditEvent", event.Type)
+	}
+
+	return strings.Join(header, "|") + "|" + strings.Join(extension, " ")
+}
@@ -0,0 +1,210 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+)
+
+// parseSyslog returns the syslog output defined by the given 'notifications:syslog' entry
+func parseSyslog(t *testing.T, entry string) config.SyslogConfig {
+	t.Helper()
+	conf, err := config.Parse([]byte(`---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+notifications:
+  syslog:
+` + entry))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+	return conf.Data.Notifications.Syslog[0]
+}
+
+var syslogEvent = Event{
+	Type: Detected,
+	Time: time.Date(2026, 10, 18, 14, 3, 11, 0, time.UTC),
+	Finding: drift.Finding{
+		Kind:      drift.UnknownRoute,
+		Resource:  "web",
+		Entry:     "web-*",
+		Space:     "prod",
+		Route:     "admin.app.cloud.gov",
+		Severity:  "critical",
+		FirstSeen: time.Date(2026, 10, 18, 14, 0, 0, 0, time.UTC),
+		AuditEvent: &drift.AuditEvent{
+			Type:      "audit.app.map-route",
+			Actor:     "jane.doe@gsa.gov",
+			ActorType: "user",
+			Time:      time.Date(2026, 10, 18, 13, 58, 0, 0, time.UTC),
+		},
+	},
+}
+
+// TestCEFMessage ensures that events are mapped to stable CEF fields.
+func TestCEFMessage(t *testing.T) {
+	message := cefMessage(syslogEvent, "watchtower-0")
+	expected := "CEF:0|18F|Watchtower|" + watchtowerVersion() + "|unknown_route|Drift detected: unknown_route|9|" +
+		"rt=1792332191000 act=detected cat=app externalId=unknown_route:web:admin.app.cloud.gov dvchost=watchtower-0 " +
+		"start=1792332000000 request=admin.app.cloud.gov cs1=web cs1Label=resource cs2=prod cs2Label=space " +
+		"cs3=web-* cs3Label=configEntry cs5=critical cs5Label=severity suser=jane.doe@gsa.gov " +
+		"cs6=audit.app.map-route cs6Label=auditEvent"
+	if message != expected {
+		t.Fatalf("CEF message incorrect.\nExpected: %s\nFound:    %s", expected, message)
+	}
+
+	resolved := cefMessage(Event{Type: Resolved, Finding: drift.Finding{Kind: drift.SpaceSSH, Resource: "a=b|c"}}, "-")
+	if !strings.HasPrefix(resolved, "CEF:0|18F|Watchtower|") || !strings.Contains(resolved, "|Drift resolved: space_ssh|1|act=resolved cat=space") ||
+		!strings.Contains(resolved, `cs1=a\=b|c`) {
+		t.Fatalf("Resolved CEF message incorrect. Found: %s", resolved)
+	}
+}
+
+// syslogPattern matches the RFC 5424 header of the syslog event, with local0 facility and critical severity
+var syslogPattern = regexp.MustCompile(`^<130>1 2026-10-18T14:03:11\.000000Z watchtower-0 watchtower \d+ DRIFT_DETECTED - CEF:0\|`)
+
+// TestSyslogUDP ensures that each event is sent in a single datagram.
+func TestSyslogUDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	output := newSyslog(parseSyslog(t, "    - name: soc\n      address: "+listener.LocalAddr().String()+"\n      hostname: watchtower-0"))
+	if err := output.Notify(context.Background(), []Event{syslogEvent}); err != nil {
+		t.Fatalf("Syslog message failed to send: %v", err)
+	}
+
+	buf := make([]byte, 4096)
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := listener.ReadFrom(buf)
+	if err != nil || !syslogPattern.Match(buf[:n]) {
+		t.Fatalf("Syslog message incorrect. Found: %q, error: %v", buf[:n], err)
+	}
+}
+
+// readFramedMessage reads a single octet counted message from a syslog stream
+func readFramedMessage(t *testing.T, listener net.Listener) string {
+	t.Helper()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	reader := bufio.NewReader(conn)
+	length, err := reader.ReadString(' ')
+	if err != nil {
+		t.Fatalf("Failed to read message length: %v", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+	if err != nil {
+		t.Fatalf("Message length %q is not a number", length)
+	}
+	message := make([]byte, n)
+	if _, err := io.ReadFull(reader, message); err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	return string(message)
+}
+
+// TestSyslogTCP ensures that events are sent over TCP with octet counting framing.
+func TestSyslogTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	output := newSyslog(parseSyslog(t, "    - name: soc\n      protocol: tcp\n      address: "+listener.Addr().String()+"\n      hostname: watchtower-0"))
+	errs := make(chan error, 1)
+	go func() { errs <- output.Notify(context.Background(), []Event{syslogEvent}) }()
+
+	if message := readFramedMessage(t, listener); !syslogPattern.MatchString(message) {
+		t.Fatalf("Syslog message incorrect. Found: %q", message)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Syslog message failed to send: %v", err)
+	}
+}
+
+// TestSyslogWriteRetry ensures that events are resent over a new connection when
+// writing to the connection fails.
+func TestSyslogWriteRetry(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	output := newSyslog(parseSyslog(t, "    - name: soc\n      protocol: tcp\n      address: "+listener.Addr().String()+"\n      hostname: watchtower-0"))
+	dials := 0
+	output.connect = func(ctx context.Context) (net.Conn, error) {
+		dials++
+		if dials == 1 {
+			// A connection the server has already closed
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		}
+		return output.dial(ctx)
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- output.Notify(context.Background(), []Event{syslogEvent}) }()
+
+	if message := readFramedMessage(t, listener); !syslogPattern.MatchString(message) {
+		t.Fatalf("Syslog message incorrect. Found: %q", message)
+	}
+	if err := <-errs; err != nil || dials != 2 {
+		t.Fatalf("Syslog message was not resent after a failed write. Dials: %d, error: %v", dials, err)
+	}
+}
+
+// TestSyslogTLS ensures that events are sent over TLS, trusting the configured CA.
+func TestSyslogTLS(t *testing.T) {
+	// Borrow the certificate of a test HTTPS server, which is valid for 127.0.0.1
+	server := httptest.NewTLSServer(nil)
+	tlsConfig := server.TLS.Clone()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	server.Close()
+	if err := os.WriteFile(caFile, pemData, 0o600); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	output := newSyslog(parseSyslog(t, "    - name: soc\n      protocol: tls\n      address: "+listener.Addr().String()+
+		"\n      ca_file: "+caFile+"\n      hostname: watchtower-0"))
+	errs := make(chan error, 1)
+	go func() { errs <- output.Notify(context.Background(), []Event{syslogEvent}) }()
+
+	if message := readFramedMessage(t, listener); !syslogPattern.MatchString(message) {
+		t.Fatalf("Syslog message incorrect. Found: %q", message)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Syslog message failed to send: %v", err)
+	}
+}
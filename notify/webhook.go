@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/18F/watchtower/config"
+)
+
+// Headers set on every webhook request
+const (
+	SignatureHeader = "X-Watchtower-Signature"
+	EventHeader     = "X-Watchtower-Event"
+)
+
+// webhook sends each event in a POST request to a configured URL
+type webhook struct {
+	config config.WebhookConfig
+	client *http.Client
+}
+
+func newWebhook(conf config.WebhookConfig) *webhook {
+	return &webhook{
+		config: conf,
+		client: &http.Client{Timeout: conf.RequestTimeout()},
+	}
+}
+
+// Notify sends a request for each event, returning the errors of the requests
+// that failed after being retried.
+func (w *webhook) Notify(ctx context.Context, events []Event) error {
+	var errs []error
+	for _, event := range events {
+		body, err := w.body(event)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		err = retry(ctx, w.config.Retries(), w.config.Backoff(), func() error {
+			return w.post(ctx, event.Type, body)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s event for %s: %w", event.Type, event.Finding.Key(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// body renders the request body for an event
+func (w *webhook) body(event Event) ([]byte, error) {
+	tmpl := w.config.BodyTemplate()
+	if tmpl == nil {
+		return json.Marshal(event)
+	}
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, event); err != nil {
+		return nil, fmt.Errorf("rendering template: %w", err)
+	}
+	return body.Bytes(), nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 of body, keyed with the webhook secret
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// post sends a single request
+func (w *webhook) post(ctx context.Context, eventType EventType, body []byte) error {
+	contentType := w.config.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	header := make(http.Header)
+	header.Set("Content-Type", contentType)
+	header.Set(EventHeader, string(eventType))
+	for name, value := range w.config.Headers {
+		header.Set(name, value)
+	}
+	if w.config.Secret != "" {
+		header.Set(SignatureHeader, "sha256="+sign(w.config.Secret, body))
+	}
+	return postHTTP(ctx, w.client, w.config.URL, header, body)
+}
+
+// postHTTP sends a POST request with the given headers and body. Responses other
+// than rate limiting and server errors are returned as permanent errors, since
+// retrying will not fix them.
+func postHTTP(ctx context.Context, client *http.Client, url string, header http.Header, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return permanent(err)
+	}
+	req.Header = header
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return checkResponse(resp)
+}
+
+// checkResponse returns an error for unsuccessful responses, marking those that
+// should not be retried as permanent.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err := fmt.Errorf("unexpected response status %s", resp.Status)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return err
+	}
+	return permanent(err)
+}
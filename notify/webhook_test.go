@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+)
+
+// parseWebhook returns the webhook defined by the given 'notifications:webhooks' entry
+func parseWebhook(t *testing.T, entry string) *webhook {
+	t.Helper()
+	conf, err := config.Parse([]byte(`---
+global:
+  port: 8443
+  refresh_interval: 15s
+  cloud_controller_url: https://api.fr.cloud.gov
+notifications:
+  webhooks:
+` + entry))
+	if err != nil {
+		t.Fatalf("Config failed to load: %v", err)
+	}
+	return newWebhook(conf.Data.Notifications.Webhooks[0])
+}
+
+var testEvent = Event{Type: Detected, Finding: drift.Finding{Kind: drift.UnknownApp, Resource: "rogue", Space: "dev"}}
+
+// TestWebhookRequest ensures that webhook requests are rendered from the template and signed.
+func TestWebhookRequest(t *testing.T) {
+	var body, signature, token, eventType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		signature = r.Header.Get(SignatureHeader)
+		token = r.Header.Get("Authorization")
+		eventType = r.Header.Get(EventHeader)
+	}))
+	defer server.Close()
+
+	hook := parseWebhook(t, `    - name: chat
+      url: `+server.URL+`
+      secret: s3cret
+      headers:
+        Authorization: Bearer token
+      template: '{{.Type}} {{.Finding.Kind}} {{.Finding.Resource}} in {{.Finding.Space}}'`)
+	if err := hook.Notify(context.Background(), []Event{testEvent}); err != nil {
+		t.Fatalf("Webhook failed: %v", err)
+	}
+
+	if body != "detected unknown_app rogue in dev" {
+		t.Fatalf("Webhook body incorrect. Found: %q", body)
+	}
+	if signature != "sha256="+sign("s3cret", []byte(body)) {
+		t.Fatalf("Webhook signature incorrect. Found: %q", signature)
+	}
+	if token != "Bearer token" || eventType != "detected" {
+		t.Fatalf("Webhook headers incorrect. Found: %q, %q", token, eventType)
+	}
+}
+
+// TestWebhookRetries ensures that server errors are retried and client errors are not.
+func TestWebhookRetries(t *testing.T) {
+	var attempts atomic.Int32
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(status)
+		}
+	}))
+	defer server.Close()
+
+	hook := parseWebhook(t, `    - name: tickets
+      url: `+server.URL+`
+      max_retries: 2
+      retry_backoff: 1ms`)
+	if err := hook.Notify(context.Background(), []Event{testEvent}); err != nil || attempts.Load() != 3 {
+		t.Fatalf("Webhook was not retried until it succeeded. Attempts: %d, error: %v", attempts.Load(), err)
+	}
+
+	attempts.Store(0)
+	status = http.StatusBadRequest
+	err := hook.Notify(context.Background(), []Event{testEvent})
+	if err == nil || !strings.Contains(err.Error(), "400") || attempts.Load() != 1 {
+		t.Fatalf("Webhook client error was retried. Attempts: %d, error: %v", attempts.Load(), err)
+	}
+}
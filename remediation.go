@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+	"github.com/18F/watchtower/remediation"
+)
+
+// scheduledStatus is the status of remediations waiting for their grace period to end
+const scheduledStatus = "scheduled"
+
+// remediate takes the actions that resolve the enforced findings of a detector
+// run, and records the actions on the findings so that they are shown by /drift
+func (detector *Detector) remediate(conf *config.Config, findings []drift.Finding) {
+	actions, remediations := detector.remediationActions(conf, findings, time.Now())
+	if detector.remediator != nil {
+		for _, entry := range detector.remediator.Run(conf, actions) {
+			key := entry.Action.Finding.Key()
+			remediations[key] = append(remediations[key], drift.Remediation{
+				Action: string(entry.Action.Type),
+				Route:  entry.Action.Route,
+				Status: string(entry.Outcome),
+				Time:   entry.Time,
+			})
+		}
+	}
+	detector.findings.SetRemediations(remediations)
+}
+
+// remediationActions returns the actions that resolve the active, enforced
+// findings of a detector run, along with the remediations that are scheduled
+// for later runs, by finding key
+func (detector *Detector) remediationActions(conf *config.Config, findings []drift.Finding, now time.Time) ([]remediation.Action, map[string][]drift.Remediation) {
+	var actions []remediation.Action
+	scheduled := make(map[string][]drift.Remediation)
+	for _, finding := range drift.Active(findings) {
+		switch finding.Kind {
+		case drift.AppSSH:
+			app, ok := detector.cache.Apps.nameMap[finding.Resource]
+			entry, found := conf.FindApp(finding.Resource, app.Metadata.Labels)
+			if !ok || !found || !conf.AppSSHEnforced(&entry) || finding.SSHEnabled == nil {
+				continue
+			}
+			actionType := remediation.EnableAppSSH
+			if *finding.SSHEnabled {
+				actionType = remediation.DisableAppSSH
+			}
+			actions = append(actions, remediation.Action{
+				Type:    actionType,
+				Target:  app.GUID,
+				Finding: finding,
+				DryRun:  conf.Data.Remediation.IsDryRun(),
+			})
+		case drift.SpaceSSH:
+			space, ok := detector.cache.Spaces.nameMap[finding.Resource]
+			entry, found := conf.FindSpace(finding.Resource, detector.cache.Spaces.labelMap[finding.Resource])
+			if !ok || !found || !conf.SpaceSSHEnforced(&entry) || finding.SSHEnabled == nil {
+				continue
+			}
+			actionType := remediation.EnableSpaceSSH
+			if *finding.SSHEnabled {
+				actionType = remediation.DisableSpaceSSH
+			}
+			actions = append(actions, remediation.Action{
+				Type:    actionType,
+				Target:  space.Guid,
+				Finding: finding,
+				DryRun:  conf.Data.Remediation.IsDryRun(),
+			})
+		case drift.UnknownApp:
+			quarantine := detector.quarantineActions(conf, finding)
+			if due := detector.detectedAt(&finding).Add(conf.Data.Remediation.Quarantine.Grace()); now.Before(due) {
+				for _, action := range quarantine {
+					scheduled[finding.Key()] = append(scheduled[finding.Key()], drift.Remediation{
+						Action: string(action.Type),
+						Route:  action.Route,
+						Status: scheduledStatus,
+						Time:   due,
+					})
+				}
+				continue
+			}
+			actions = append(actions, quarantine...)
+		case drift.UnknownRoute:
+			action, ok := detector.routeAction(conf, finding)
+			if !ok {
+				continue
+			}
+			if due := detector.detectedAt(&finding).Add(conf.Data.Remediation.Routes.Grace()); now.Before(due) {
+				scheduled[finding.Key()] = append(scheduled[finding.Key()], drift.Remediation{
+					Action: string(action.Type),
+					Route:  action.Route,
+					Status: scheduledStatus,
+					Time:   due,
+				})
+				continue
+			}
+			actions = append(actions, action)
+		}
+	}
+	for i := range actions {
+		actions[i].RequiresApproval = conf.Data.Remediation.Approval.RequiresApproval(findingSpace(&actions[i].Finding))
+	}
+	return actions, scheduled
+}
+
+// detectedAt returns when a finding was detected. The drift history is kept
+// across restarts, so grace periods continue from when its lifecycle opened;
+// without history, or before the finding is recorded, its first seen time is used.
+func (detector *Detector) detectedAt(finding *drift.Finding) time.Time {
+	if detector.history != nil {
+		if detected, ok := detector.history.Detected(finding.Key()); ok {
+			return detected
+		}
+	}
+	return finding.FirstSeen
+}
+
+// findingSpace returns the name of the space of the resource a finding is about
+func findingSpace(finding *drift.Finding) string {
+	if finding.Kind.IsSpace() {
+		return finding.Resource
+	}
+	return finding.Space
+}
+
+// routeAction returns the action that unmaps an unknown route from its app, if
+// the route's domain is enforced. When orphans are deleted, a route that is not
+// mapped to any other app is deleted instead.
+func (detector *Detector) routeAction(conf *config.Config, finding drift.Finding) (remediation.Action, bool) {
+	settings := &conf.Data.Remediation.Routes
+	app, ok := detector.cache.Apps.nameMap[finding.Resource]
+	if !ok {
+		return remediation.Action{}, false
+	}
+
+	var unmap *remediation.Action
+	routeMappings := make(map[string]int)
+	for _, mapping := range detector.cache.RouteMappings.routeMappings {
+		routeMappings[mapping.RouteGUID]++
+		if mapping.AppGUID != app.GUID {
+			continue
+		}
+		_, route, domainName, err := detector.cache.getMappingResources(mapping.Guid)
+		if err != nil || route.Host+"."+domainName != finding.Route || !settings.Enforced(domainName) {
+			continue
+		}
+		unmap = &remediation.Action{
+			Type:    remediation.UnmapRoute,
+			Target:  mapping.Guid,
+			Route:   finding.Route,
+			Finding: finding,
+			DryRun:  conf.RouteDryRun(),
+		}
+	}
+	if unmap == nil {
+		return remediation.Action{}, false
+	}
+
+	routeGUID := detector.cache.RouteMappings.guidMap[unmap.Target].RouteGUID
+	if settings.DeleteOrphans && routeMappings[routeGUID] == 1 {
+		unmap.Type = remediation.DeleteRoute
+		unmap.Target = routeGUID
+	}
+	return *unmap, true
+}
+
+// quarantineActions returns the actions allowed in the space of an unknown app
+// that stop it and unmap its public routes. Apps that are already stopped and
+// routes that are already unmapped need no action, so quarantine actions are
+// only taken once.
+func (detector *Detector) quarantineActions(conf *config.Config, finding drift.Finding) []remediation.Action {
+	space, ok := conf.Data.Remediation.Quarantine.Space(finding.Space)
+	app, deployed := detector.cache.Apps.nameMap[finding.Resource]
+	if !ok || !deployed {
+		return nil
+	}
+
+	var actions []remediation.Action
+	dryRun := conf.QuarantineDryRun(&space)
+	if space.Allows(config.QuarantineStop) && app.State != "STOPPED" {
+		actions = append(actions, remediation.Action{Type: remediation.StopApp, Target: app.GUID, Finding: finding, DryRun: dryRun})
+	}
+	if space.Allows(config.QuarantineUnmapRoutes) {
+		for _, mapping := range detector.cache.RouteMappings.routeMappings {
+			if mapping.AppGUID != app.GUID {
+				continue
+			}
+			_, route, domainName, err := detector.cache.getMappingResources(mapping.Guid)
+			if err != nil || detector.cache.SharedDomains.guidMap[route.DomainGuid].Internal {
+				continue
+			}
+			actions = append(actions, remediation.Action{
+				Type:    remediation.UnmapRoute,
+				Target:  mapping.Guid,
+				Route:   route.Host + "." + domainName,
+				Finding: finding,
+				DryRun:  dryRun,
+			})
+		}
+	}
+	return actions
+}
+
+// executeRemediation takes a remediation action with the CF client
+func executeRemediation(action remediation.Action) error {
+	switch action.Type {
+	case remediation.DisableAppSSH, remediation.EnableAppSSH:
+		return updateCFResource("PATCH", "/v3/apps/"+action.Target+"/features/ssh",
+			map[string]bool{"enabled": action.Type == remediation.EnableAppSSH})
+	case remediation.DisableSpaceSSH, remediation.EnableSpaceSSH:
+		return updateCFResource("PATCH", "/v3/spaces/"+action.Target+"/features/ssh",
+			map[string]bool{"enabled": action.Type == remediation.EnableSpaceSSH})
+	case remediation.StopApp:
+		return updateCFResource("POST", "/v3/apps/"+action.Target+"/actions/stop", nil)
+	case remediation.UnmapRoute:
+		return client.DeleteRouteMapping(action.Target)
+	case remediation.DeleteRoute:
+		return updateCFResource("DELETE", "/v3/routes/"+action.Target, nil)
+	}
+	return fmt.Errorf("unsupported remediation action %q", action.Type)
+}
+
+// updateCFResource sends a request to the Cloud Controller, with body encoded as
+// JSON unless it is nil, returning an error unless it succeeds
+func updateCFResource(method, path string, body interface{}) error {
+	request := client.NewRequest(method, path)
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		request = client.NewRequestWithBody(method, path, bytes.NewReader(data))
+	}
+	resp, err := client.DoRequest(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Error responses are returned as errors by the client
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%s %s failed with status %d", method, path, resp.StatusCode)
+	}
+	return nil
+}
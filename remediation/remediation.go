@@ -0,0 +1,419 @@
+// Package remediation takes actions on the Cloud Foundry environment to resolve
+// enforced drift, keeps a queue of actions waiting for approval, and keeps an
+// audit log of every action and decision.
+package remediation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+	"go.uber.org/zap"
+)
+
+// ActionType identifies the change an Action makes
+type ActionType string
+
+// Types of remediation action
+const (
+	DisableAppSSH   ActionType = "disable_app_ssh"
+	EnableAppSSH    ActionType = "enable_app_ssh"
+	DisableSpaceSSH ActionType = "disable_space_ssh"
+	EnableSpaceSSH  ActionType = "enable_space_ssh"
+	StopApp         ActionType = "stop_app"
+	UnmapRoute      ActionType = "unmap_route"
+	DeleteRoute     ActionType = "delete_route"
+)
+
+// Action is a change to a single Cloud Foundry resource that resolves a finding
+type Action struct {
+	Type ActionType `json:"type"`
+
+	// Target is the GUID of the app, space, route mapping or route the action changes
+	Target string `json:"target"`
+
+	// Route is the route an action on a route or route mapping changes
+	Route   string        `json:"route,omitempty"`
+	Finding drift.Finding `json:"finding"`
+
+	// DryRun is set when the action is only logged instead of taken
+	DryRun bool `json:"dry_run"`
+
+	// RequiresApproval is set when the action is only taken once approved
+	RequiresApproval bool `json:"requires_approval,omitempty"`
+}
+
+// Key uniquely identifies the Action among the actions of a single run
+func (a *Action) Key() string {
+	key := string(a.Type) + ":" + a.Finding.Key()
+	if a.Route != "" {
+		key += ":" + a.Route
+	}
+	return key
+}
+
+// proposalKey identifies the proposal of the Action. Dry runs and real actions
+// are proposed separately, so that approving a dry run never approves the
+// action itself.
+func (a *Action) proposalKey() string {
+	if a.DryRun {
+		return a.Key() + ":dry_run"
+	}
+	return a.Key()
+}
+
+// Outcome is the result of a remediation action
+type Outcome string
+
+// Outcomes of a remediation action
+const (
+	DryRun    Outcome = "dry_run"   // The action was only logged
+	Skipped   Outcome = "skipped"   // The maximum number of actions per run was reached
+	Succeeded Outcome = "succeeded" // The action was taken
+	Failed    Outcome = "failed"    // The action was attempted, but failed
+	Pending   Outcome = "pending"   // The action is waiting for approval
+	Approved  Outcome = "approved"  // The action was approved, and is taken once on the next run
+	Rejected  Outcome = "rejected"  // The action was rejected, and is not taken while the drift remains
+)
+
+// AuditEntry records a single remediation action in the audit log
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	Action  Action    `json:"action"`
+	Outcome Outcome   `json:"outcome"`
+	Error   string    `json:"error,omitempty"`
+
+	// Approver is the approver who decided on the action, if it required approval
+	Approver string `json:"approver,omitempty"`
+}
+
+// proposalIDBytes is the number of random bytes in a proposal ID
+const proposalIDBytes = 8
+
+// Errors returned when deciding on a proposal
+var (
+	ErrProposalNotFound = errors.New("proposal not found")
+	ErrProposalDecided  = errors.New("proposal was already decided")
+)
+
+// Proposal is an action in the queue of actions waiting for approval. When an
+// audit log is configured, proposals are kept in a file next to it so that
+// they survive restarts; otherwise they are proposed again after a restart.
+type Proposal struct {
+	ID       string     `json:"id"`
+	Action   Action     `json:"action"`
+	Status   Outcome    `json:"status"`
+	Proposed time.Time  `json:"proposed"`
+	Decided  *time.Time `json:"decided,omitempty"`
+	Approver string     `json:"approver,omitempty"`
+}
+
+// Executor takes a remediation action on the Cloud Foundry environment
+type Executor func(action Action) error
+
+// OutcomeFunc is called with the outcome of every remediation action
+type OutcomeFunc func(action Action, outcome Outcome)
+
+// Remediator takes the remediation actions of each detector run, up to the
+// maximum number of actions per run, and records them in the audit log.
+// Actions that require approval are proposed in a queue of pending actions,
+// and only taken once approved.
+type Remediator struct {
+	execute   Executor
+	outcome   OutcomeFunc
+	logger    *zap.SugaredLogger
+	auditPath string
+	auditLog  *os.File
+	proposals map[string]*Proposal // By action proposal key
+
+	// proposalsPath is the file the proposals are kept in, or "" if they are only kept in memory
+	proposalsPath string
+	mut           sync.Mutex
+}
+
+// proposalsFile returns the path of the file the proposals are kept in, next
+// to the audit log at auditLog
+func proposalsFile(auditLog string) string {
+	return auditLog + ".proposals"
+}
+
+// NewRemediator returns a Remediator that takes actions with execute. outcome may be nil.
+func NewRemediator(execute Executor, outcome OutcomeFunc, logger *zap.SugaredLogger) (*Remediator, error) {
+	if execute == nil {
+		return nil, errors.New("remediator cannot be created with nil executor")
+	}
+	if logger == nil {
+		return nil, errors.New("remediator cannot be created with nil logger")
+	}
+	if outcome == nil {
+		outcome = func(Action, Outcome) {}
+	}
+	return &Remediator{
+		execute:   execute,
+		outcome:   outcome,
+		logger:    logger.Named("remediation"),
+		proposals: make(map[string]*Proposal),
+	}, nil
+}
+
+// Run takes the actions in order, returning the audit entry of each. Dry run
+// actions are only logged. Actions beyond the maximum number of actions per run
+// are skipped, and taken on a later run if the drift remains.
+//
+// Actions that require approval are proposed on the first run they appear in,
+// and are taken on the run after they are approved. An approval covers a single
+// run of the action: once it is taken, whether it succeeds or fails, its
+// proposal is dropped, and the action must be proposed and approved again if it
+// is still needed. Pending and rejected actions do not count towards the maximum
+// number of actions per run. Proposals of actions that are no longer needed are
+// dropped.
+func (r *Remediator) Run(conf *config.Config, actions []Action) []AuditEntry {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	settings := &conf.Data.Remediation
+	r.loadProposals(settings.AuditLog)
+	var entries []AuditEntry
+	current := make(map[string]bool)
+	changed := false
+	taken := 0
+	for _, action := range actions {
+		key := action.proposalKey()
+		current[key] = true
+		entry := AuditEntry{Time: time.Now(), Action: action}
+		proposal, proposed := r.proposals[key]
+		if action.RequiresApproval && proposed {
+			entry.Approver = proposal.Approver
+		}
+		switch {
+		case action.RequiresApproval && !proposed:
+			entry.Outcome = Pending
+			r.propose(action, entry.Time)
+			changed = true
+			r.record(settings.AuditLog, entry)
+			entries = append(entries, entry)
+			continue
+		case action.RequiresApproval && proposal.Status != Approved:
+			// The proposal was recorded when it was made or decided on
+			entry.Outcome = proposal.Status
+			entries = append(entries, entry)
+			continue
+		case taken >= settings.ActionLimit():
+			entry.Outcome = Skipped
+		case action.DryRun:
+			taken++
+			entry.Outcome = DryRun
+		default:
+			taken++
+			entry.Outcome = Succeeded
+			if err := r.execute(action); err != nil {
+				entry.Outcome = Failed
+				entry.Error = err.Error()
+			}
+		}
+		if action.RequiresApproval && entry.Outcome != Skipped {
+			delete(r.proposals, key)
+			changed = true
+		}
+		r.record(settings.AuditLog, entry)
+		r.outcome(action, entry.Outcome)
+		entries = append(entries, entry)
+	}
+
+	for key := range r.proposals {
+		if !current[key] {
+			delete(r.proposals, key)
+			changed = true
+		}
+	}
+	if changed {
+		r.saveProposals()
+	}
+	return entries
+}
+
+// propose adds a pending proposal of the action to the queue. r.mut must be held.
+func (r *Remediator) propose(action Action, now time.Time) {
+	id := make([]byte, proposalIDBytes)
+	if _, err := rand.Read(id); err != nil {
+		// The queue cannot be used without IDs, so the action is proposed again
+		// on the next run
+		r.logger.Errorw("failed generating proposal id", "error", err.Error())
+		return
+	}
+	r.proposals[action.proposalKey()] = &Proposal{
+		ID:       hex.EncodeToString(id),
+		Action:   action,
+		Status:   Pending,
+		Proposed: now,
+	}
+}
+
+// Proposals returns the queue of proposed actions, oldest first
+func (r *Remediator) Proposals() []Proposal {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.sortedProposals()
+}
+
+// sortedProposals returns the queue of proposed actions, oldest first. r.mut must be held.
+func (r *Remediator) sortedProposals() []Proposal {
+	proposals := make([]Proposal, 0, len(r.proposals))
+	for _, proposal := range r.proposals {
+		proposals = append(proposals, *proposal)
+	}
+	sort.Slice(proposals, func(i, j int) bool {
+		if !proposals[i].Proposed.Equal(proposals[j].Proposed) {
+			return proposals[i].Proposed.Before(proposals[j].Proposed)
+		}
+		return proposals[i].ID < proposals[j].ID
+	})
+	return proposals
+}
+
+// Decide approves or rejects the pending proposal with the given ID on behalf of
+// approver, and records the decision in the audit log. Approved actions are
+// taken once, on the next run.
+func (r *Remediator) Decide(conf *config.Config, id string, approve bool, approver string) (Proposal, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.loadProposals(conf.Data.Remediation.AuditLog)
+
+	var proposal *Proposal
+	for _, p := range r.proposals {
+		if p.ID == id {
+			proposal = p
+			break
+		}
+	}
+	if proposal == nil {
+		return Proposal{}, ErrProposalNotFound
+	}
+	if proposal.Status != Pending {
+		return *proposal, ErrProposalDecided
+	}
+
+	now := time.Now()
+	proposal.Status = Rejected
+	if approve {
+		proposal.Status = Approved
+	}
+	proposal.Decided = &now
+	proposal.Approver = approver
+	r.record(conf.Data.Remediation.AuditLog, AuditEntry{
+		Time:     now,
+		Action:   proposal.Action,
+		Outcome:  proposal.Status,
+		Approver: approver,
+	})
+	r.saveProposals()
+	return *proposal, nil
+}
+
+// loadProposals reads the proposals kept next to the audit log at auditLog,
+// unless they were already read, such as on the first run after a restart or
+// when the audit log is changed by a reloaded config. Proposals are only kept
+// in memory if no audit log is configured. r.mut must be held.
+func (r *Remediator) loadProposals(auditLog string) {
+	if auditLog == "" {
+		r.proposalsPath = ""
+		return
+	}
+	path := proposalsFile(auditLog)
+	if path == r.proposalsPath {
+		return
+	}
+	r.proposalsPath = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		r.logger.Errorw("failed reading remediation proposals", "path", path, "error", err.Error())
+		return
+	}
+	var proposals []Proposal
+	if err := json.Unmarshal(data, &proposals); err != nil {
+		r.logger.Errorw("failed decoding remediation proposals", "path", path, "error", err.Error())
+		return
+	}
+	for i := range proposals {
+		r.proposals[proposals[i].Action.proposalKey()] = &proposals[i]
+	}
+}
+
+// saveProposals replaces the file the proposals are kept in, if there is one,
+// with the current proposals. r.mut must be held.
+func (r *Remediator) saveProposals() {
+	if r.proposalsPath == "" {
+		return
+	}
+	data, err := json.Marshal(r.sortedProposals())
+	if err == nil {
+		// Written to a temporary file first, so that a crash never leaves a partial file
+		tmp := r.proposalsPath + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, r.proposalsPath)
+		}
+	}
+	if err != nil {
+		r.logger.Errorw("failed writing remediation proposals", "path", r.proposalsPath, "error", err.Error())
+	}
+}
+
+// record logs an audit entry, and appends it to the audit log file if one is
+// configured. r.mut must be held.
+func (r *Remediator) record(path string, entry AuditEntry) {
+	logFields := []interface{}{
+		"action", entry.Action.Type,
+		"target", entry.Action.Target,
+		"route", entry.Action.Route,
+		"finding", entry.Action.Finding.Key(),
+		"outcome", entry.Outcome,
+	}
+	if entry.Approver != "" {
+		logFields = append(logFields, "approver", entry.Approver)
+	}
+	if entry.Outcome == Failed {
+		r.logger.Errorw("remediation action failed", append(logFields, "error", entry.Error)...)
+	} else {
+		r.logger.Infow("remediation action", logFields...)
+	}
+
+	if path == "" {
+		return
+	}
+	if err := r.openAuditLog(path); err != nil {
+		r.logger.Errorw("failed opening remediation audit log", "path", path, "error", err.Error())
+		return
+	}
+	if err := json.NewEncoder(r.auditLog).Encode(entry); err != nil {
+		r.logger.Errorw("failed writing remediation audit log", "path", path, "error", err.Error())
+	}
+}
+
+// openAuditLog opens the audit log file at path for appending, closing the
+// previous file if the path was changed by a reloaded config. r.mut must be held.
+func (r *Remediator) openAuditLog(path string) error {
+	if r.auditLog != nil && r.auditPath == path {
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if r.auditLog != nil {
+		r.auditLog.Close()
+	}
+	r.auditLog = file
+	r.auditPath = path
+	return nil
+}
@@ -0,0 +1,191 @@
+package remediation
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/18F/watchtower/config"
+	"github.com/18F/watchtower/drift"
+	"go.uber.org/zap"
+)
+
+// newTestRemediator returns a Remediator that records the actions it takes
+func newTestRemediator(t *testing.T, taken *[]Action) *Remediator {
+	t.Helper()
+	remediator, err := NewRemediator(func(action Action) error {
+		*taken = append(*taken, action)
+		if action.Finding.Resource == "broken" {
+			return errors.New("forbidden")
+		}
+		return nil
+	}, nil, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("Failed creating remediator: %s", err)
+	}
+	return remediator
+}
+
+var sshActions = []Action{
+	{Type: DisableAppSSH, Target: "web-guid", Finding: drift.Finding{Kind: drift.AppSSH, Resource: "web"}},
+	{Type: DisableAppSSH, Target: "broken-guid", Finding: drift.Finding{Kind: drift.AppSSH, Resource: "broken"}},
+	{Type: EnableSpaceSSH, Target: "dev-guid", Finding: drift.Finding{Kind: drift.SpaceSSH, Resource: "dev"}},
+}
+
+// TestRemediationDryRun ensures that dry run actions are only recorded.
+func TestRemediationDryRun(t *testing.T) {
+	var taken []Action
+	actions := append([]Action{}, sshActions...)
+	for i := range actions {
+		actions[i].DryRun = true
+	}
+	entries := newTestRemediator(t, &taken).Run(&config.Config{}, actions)
+	if len(taken) != 0 {
+		t.Fatalf("Actions were taken in a dry run. Found: %+v", taken)
+	}
+	if len(entries) != 3 || entries[0].Outcome != DryRun {
+		t.Fatalf("Dry run actions were not recorded. Found: %+v", entries)
+	}
+}
+
+// TestRemediationRun ensures that actions are taken in order up to the limit per
+// run, and that every action is appended to the audit log.
+func TestRemediationRun(t *testing.T) {
+	auditLog := filepath.Join(t.TempDir(), "audit.jsonl")
+	conf := &config.Config{Data: config.YAMLConfig{Remediation: config.RemediationConfig{
+		MaxActions: 2,
+		AuditLog:   auditLog,
+	}}}
+
+	var taken []Action
+	entries := newTestRemediator(t, &taken).Run(conf, append([]Action{}, sshActions...))
+	if len(taken) != 2 || taken[0].Finding.Resource != "web" || taken[1].Finding.Resource != "broken" {
+		t.Fatalf("Incorrect actions taken. Found: %+v", taken)
+	}
+	expected := []Outcome{Succeeded, Failed, Skipped}
+	for i, entry := range entries {
+		if entry.Outcome != expected[i] {
+			t.Fatalf("Incorrect outcome of %s. Expected: %s, Found: %s", entry.Action.Key(), expected[i], entry.Outcome)
+		}
+	}
+	if entries[1].Error != "forbidden" {
+		t.Fatalf("Failed action error was not recorded. Found: %+v", entries[1])
+	}
+
+	file, err := os.Open(auditLog)
+	if err != nil {
+		t.Fatalf("Audit log was not written: %s", err)
+	}
+	defer file.Close()
+	var logged []AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Audit log entry is not JSON: %s", scanner.Text())
+		}
+		logged = append(logged, entry)
+	}
+	if len(logged) != 3 || logged[2].Outcome != Skipped || logged[0].Action.Target != "web-guid" {
+		t.Fatalf("Audit log incorrect. Found: %+v", logged)
+	}
+}
+
+// TestRemediationApproval ensures that actions requiring approval are proposed,
+// only taken once approved, and that every decision is audited with its approver.
+func TestRemediationApproval(t *testing.T) {
+	auditLog := filepath.Join(t.TempDir(), "audit.jsonl")
+	conf := &config.Config{Data: config.YAMLConfig{Remediation: config.RemediationConfig{AuditLog: auditLog}}}
+	actions := append([]Action{}, sshActions...)
+	for i := range actions {
+		actions[i].RequiresApproval = true
+	}
+
+	var taken []Action
+	remediator := newTestRemediator(t, &taken)
+	entries := remediator.Run(conf, actions)
+	proposals := remediator.Proposals()
+	if len(taken) != 0 || len(proposals) != 3 || entries[0].Outcome != Pending {
+		t.Fatalf("Actions were not proposed. Taken: %+v, Proposals: %+v", taken, proposals)
+	}
+
+	var web, dev Proposal
+	for _, proposal := range proposals {
+		switch proposal.Action.Finding.Resource {
+		case "web":
+			web = proposal
+		case "dev":
+			dev = proposal
+		}
+	}
+	if _, err := remediator.Decide(conf, web.ID, true, "ops"); err != nil {
+		t.Fatalf("Failed approving action: %s", err)
+	}
+	if _, err := remediator.Decide(conf, dev.ID, false, "security"); err != nil {
+		t.Fatalf("Failed rejecting action: %s", err)
+	}
+	if _, err := remediator.Decide(conf, web.ID, false, "ops"); !errors.Is(err, ErrProposalDecided) {
+		t.Fatalf("Decided action was decided again. Found: %v", err)
+	}
+	if _, err := remediator.Decide(conf, "unknown", true, "ops"); !errors.Is(err, ErrProposalNotFound) {
+		t.Fatalf("Unknown proposal was decided. Found: %v", err)
+	}
+
+	entries = remediator.Run(conf, actions)
+	if len(taken) != 1 || taken[0].Finding.Resource != "web" {
+		t.Fatalf("Incorrect actions taken. Found: %+v", taken)
+	}
+	expected := []Outcome{Succeeded, Pending, Rejected}
+	for i, entry := range entries {
+		if entry.Outcome != expected[i] {
+			t.Fatalf("Incorrect outcome of %s. Expected: %s, Found: %s", entry.Action.Key(), expected[i], entry.Outcome)
+		}
+	}
+	if entries[0].Approver != "ops" {
+		t.Fatalf("Approver of the action was not recorded. Found: %+v", entries[0])
+	}
+
+	// The approval covered a single run, so the action is proposed again
+	entries = remediator.Run(conf, actions[:1])
+	if proposals := remediator.Proposals(); len(proposals) != 1 || proposals[0].ID == web.ID || entries[0].Outcome != Pending {
+		t.Fatalf("Taken action was not proposed again, or proposals that are no longer needed were kept. Found: %+v", proposals)
+	}
+	if len(taken) != 1 {
+		t.Fatalf("Approved action was taken more than once. Found: %+v", taken)
+	}
+
+	// Proposals are kept across restarts, but dry runs are proposed separately
+	restarted := newTestRemediator(t, &taken)
+	restarted.Run(conf, actions[:1])
+	if proposals := restarted.Proposals(); len(proposals) != 1 || proposals[0].ID != remediator.Proposals()[0].ID {
+		t.Fatalf("Proposals were not kept across a restart. Found: %+v", proposals)
+	}
+	dryRun := actions[0]
+	dryRun.DryRun = true
+	restarted.Run(conf, []Action{dryRun})
+	if proposals := restarted.Proposals(); len(proposals) != 1 || !proposals[0].Action.DryRun {
+		t.Fatalf("Dry run shared the proposal of the action. Found: %+v", proposals)
+	}
+
+	data, err := os.ReadFile(auditLog)
+	if err != nil {
+		t.Fatalf("Audit log was not written: %s", err)
+	}
+	var decisions []AuditEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry AuditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Audit log entry is not JSON: %s", line)
+		}
+		if entry.Outcome == Approved || entry.Outcome == Rejected {
+			decisions = append(decisions, entry)
+		}
+	}
+	if len(decisions) != 2 || decisions[0].Approver != "ops" || decisions[1].Approver != "security" {
+		t.Fatalf("Decisions were not audited. Found: %+v", decisions)
+	}
+}
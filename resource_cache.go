@@ -2,9 +2,11 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
 	"os"
-	"strings"
+	"sort"
 	"sync"
 	"time"
 
@@ -13,8 +15,6 @@ import (
 )
 
 var client *cfclient.Client
-var clientCreatedAt = time.Now()
-var clientAgeLimitHours = 8.0
 var cloudControllerURL string
 
 // Get an environment variable value. If the key is empty or does not exist,
@@ -26,42 +26,74 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
-// newCFClient creates and returns a cfclient.Client. Reads CF_USER, and
-// CF_PASS environment variables as configuration values.
-func newCFClient(logger *zap.SugaredLogger) *cfclient.Client {
-	c := &cfclient.Config{
-		ApiAddress: cloudControllerURL,
-		Username:   getEnv("CF_USER", ""),
-		Password:   getEnv("CF_PASS", ""),
+// newCFClient creates and returns a cfclient.Client authenticated with creds.
+// Tokens are fetched from CF_TOKEN_ENDPOINT if set, and otherwise from the token
+// endpoint advertised by the Cloud Controller, and are refreshed by a
+// tokenManager for as long as the client is used.
+func newCFClient(creds cfCredentials, logger *zap.SugaredLogger) (*cfclient.Client, error) {
+	// cfclient authenticates against the advertised token endpoint, so the client
+	// is created without fetching a token and authenticated below instead
+	c, err := cfclient.NewClient(&cfclient.Config{ApiAddress: cloudControllerURL, ClientID: "watchtower"})
+	if err != nil {
+		return nil, err
+	}
+	tokenURL := creds.tokenEndpoint
+	if tokenURL == "" {
+		tokenURL = c.Endpoint.TokenEndpoint + "/oauth/token"
+	}
+
+	tokens := newTokenManager(creds, tokenURL, logger)
+	if err := tokens.authenticate(); err != nil {
+		return nil, fmt.Errorf("%s grant against %s: %w", creds.grant(), tokenURL, err)
 	}
-	client, err := cfclient.NewClient(c)
+	c.Config.TokenSource = tokens
+	c.Config.HttpClient = &http.Client{Transport: &authTransport{tokens: tokens, base: http.DefaultTransport}}
+
+	logger.Infow("successfully created cfclient", "grant", creds.grant(), "token endpoint", tokenURL)
+	return c, nil
+}
+
+// connectCFClient creates a cfclient.Client with the credentials read by
+// credentialsFromEnv, retrying with backoff if the Cloud Controller or UAA
+// cannot be reached or authentication fails. With attempts set to 0, it retries
+// until it succeeds.
+func connectCFClient(attempts int, logger *zap.SugaredLogger) (*cfclient.Client, error) {
+	creds, err := credentialsFromEnv()
 	if err != nil {
-		// Bad/No credentials
-		if strings.HasPrefix(err.Error(), "Error getting token: oauth2: cannot fetch token: 401 Unauthorized") {
-			logger.Fatalw("could not create cfclient", "error", "credentials were not valid")
+		return nil, err
+	}
+	for attempt := 1; ; attempt++ {
+		c, err := newCFClient(creds, logger)
+		if err == nil {
+			return c, nil
+		}
+		if attempt == attempts {
+			return nil, err
 		}
-		logger.Fatalw("could not create cfclient", "error", err)
+		delay := authBackoff(attempt)
+		logger.Errorw("could not create cfclient, retrying", "attempt", attempt, "retry in", delay.String(), "error", err.Error())
+		time.Sleep(delay)
 	}
-
-	logger.Info("successfully created cfclient")
-	return client
 }
 
 // CFResourceCache will contain the most recently scraped resource information
 // about the Cloud Foundry environment being monitored. Various resource types
 // can be searched for by their unique identifiers using provided lookup functions.
 type CFResourceCache struct {
-	Apps          AppCache
-	Routes        RouteCache
-	RouteMappings RouteMappingCache
-	Domains       DomainCache
-	SharedDomains SharedDomainCache
-	Spaces        SpaceCache
-	logger        *zap.SugaredLogger
+	Apps            AppCache
+	Routes          RouteCache
+	RouteMappings   RouteMappingCache
+	Domains         DomainCache
+	SharedDomains   SharedDomainCache
+	Spaces          SpaceCache
+	ServiceBindings ServiceBindingCache
+	logger          *zap.SugaredLogger
 }
 
-// NewCFResourceCache returns a new, populated CFResourceCache
-func NewCFResourceCache(url string, logger *zap.SugaredLogger) (CFResourceCache, error) {
+// NewCFResourceCache returns a new, populated CFResourceCache. Creating the
+// Cloud Foundry client is attempted up to attempts times, or until it succeeds
+// if attempts is 0.
+func NewCFResourceCache(url string, attempts int, logger *zap.SugaredLogger) (CFResourceCache, error) {
 	if logger == nil {
 		return CFResourceCache{}, errors.New("cannot create CFResourceCache with nil logger")
 	}
@@ -69,30 +101,29 @@ func NewCFResourceCache(url string, logger *zap.SugaredLogger) (CFResourceCache,
 	cloudControllerURL = url
 	logger.Infow("creating resource cache", "url", url)
 	var cache = CFResourceCache{
-		Apps:          AppCache{logger: logger.Named("apps")},
-		Routes:        RouteCache{logger: logger.Named("routes")},
-		RouteMappings: RouteMappingCache{logger: logger.Named("route-mappings")},
-		Domains:       DomainCache{logger: logger.Named("domains")},
-		SharedDomains: SharedDomainCache{logger: logger.Named("shared-domains")},
-		Spaces:        SpaceCache{logger: logger.Named("spaces")},
-		logger:        logger,
-	}
-	client = newCFClient(logger)
+		Apps:            AppCache{logger: logger.Named("apps")},
+		Routes:          RouteCache{logger: logger.Named("routes")},
+		RouteMappings:   RouteMappingCache{logger: logger.Named("route-mappings")},
+		Domains:         DomainCache{logger: logger.Named("domains")},
+		SharedDomains:   SharedDomainCache{logger: logger.Named("shared-domains")},
+		Spaces:          SpaceCache{logger: logger.Named("spaces")},
+		ServiceBindings: ServiceBindingCache{logger: logger.Named("service-bindings")},
+		logger:          logger,
+	}
+	var err error
+	client, err = connectCFClient(attempts, logger)
+	if err != nil {
+		return CFResourceCache{}, fmt.Errorf("could not create cfclient: %w", err)
+	}
 	cache.Refresh()
 	return cache, nil
 }
 
 // Refresh the current resource cache
 func (cache *CFResourceCache) Refresh() {
-	// Ensure the client is still valid (refresh token expires periodically)
-	if time.Since(clientCreatedAt).Hours() > clientAgeLimitHours {
-		client = newCFClient(cache.logger)
-		clientCreatedAt = time.Now()
-		cache.logger.Info("successfully refreshed cf http client")
-	}
 	// Parallelize calls to refreshXCache using goroutines and a sync.WaitGroup
 	var waitgroup sync.WaitGroup
-	var numRefreshFuncions = 6
+	var numRefreshFuncions = 7
 	waitgroup.Add(numRefreshFuncions)
 
 	go cache.Apps.refresh(&waitgroup)
@@ -101,11 +132,12 @@ func (cache *CFResourceCache) Refresh() {
 	go cache.Domains.refresh(&waitgroup)
 	go cache.SharedDomains.refresh(&waitgroup)
 	go cache.Spaces.refresh(&waitgroup)
+	go cache.ServiceBindings.refresh(&waitgroup)
 
 	waitgroup.Wait()
 }
 
-// isValid() returns 'true' if all sub-caches are valid, and 'false' otherwise
+// isValid() returns 'true' if all sub-caches used by the route checks are valid, and 'false' otherwise
 func (cache *CFResourceCache) isValid() bool {
 	return cache.Apps.Valid &&
 		cache.Routes.Valid &&
@@ -172,15 +204,43 @@ func (cache *CFResourceCache) getMappingResources(mappingGUID string) (cfclient.
 	return app, route, domainName, nil
 }
 
+// appSpaceName returns the name of the space the named app is deployed to
+func appSpaceName(cache *CFResourceCache, appName string) string {
+	app := cache.Apps.nameMap[appName]
+	space, ok := cache.Spaces.guidMap[app.Relationships["space"].Data.GUID]
+	if !ok {
+		return "unknown"
+	}
+	return space.Name
+}
+
+// getAppRoutes returns the sorted URLs of the routes mapped to each app, of the
+// form <hostname>.<domain>, by app name.
+func (cache *CFResourceCache) getAppRoutes() map[string][]string {
+	appRoutes := make(map[string][]string)
+	for _, mapping := range cache.RouteMappings.routeMappings {
+		app, route, domainName, err := cache.getMappingResources(mapping.Guid)
+		if err != nil {
+			continue
+		}
+		appRoutes[app.Name] = append(appRoutes[app.Name], route.Host+"."+domainName)
+	}
+	for _, routes := range appRoutes {
+		sort.Strings(routes)
+	}
+	return appRoutes
+}
+
 // AppCache holds the most recently scraped CF App information
 type AppCache struct {
 	// AppCache.Valid will be 'true' when the cache was successfully refreshed and 'false' if the last refresh failed.
-	Valid   bool
-	apps    []cfclient.V3App
-	guidMap map[string]cfclient.V3App
-	nameMap map[string]cfclient.V3App
-	sshMap  map[string]bool
-	logger  *zap.SugaredLogger
+	Valid     bool
+	apps      []cfclient.V3App
+	guidMap   map[string]cfclient.V3App
+	nameMap   map[string]cfclient.V3App
+	sshMap    map[string]bool
+	v2NameMap map[string]cfclient.App
+	logger    *zap.SugaredLogger
 }
 
 func (cache *AppCache) refresh(wg *sync.WaitGroup) {
@@ -205,6 +265,7 @@ func (cache *AppCache) refresh(wg *sync.WaitGroup) {
 	guidMap := make(map[string]cfclient.V3App)
 	nameMap := make(map[string]cfclient.V3App)
 	sshMap := make(map[string]bool)
+	v2NameMap := make(map[string]cfclient.App)
 
 	for _, elem := range resourceList {
 		nameMap[elem.Name] = elem
@@ -213,11 +274,13 @@ func (cache *AppCache) refresh(wg *sync.WaitGroup) {
 
 	for _, elem := range v2ResourceList {
 		sshMap[elem.Name] = elem.EnableSSH
+		v2NameMap[elem.Name] = elem
 	}
 	cache.apps = resourceList
 	cache.guidMap = guidMap
 	cache.nameMap = nameMap
 	cache.sshMap = sshMap
+	cache.v2NameMap = v2NameMap
 	cache.Valid = true
 }
 
@@ -364,11 +427,14 @@ func (cache *DomainCache) refresh(wg *sync.WaitGroup) {
 // SpaceCache holds the most recently scraped CF Space information
 type SpaceCache struct {
 	// SpaceCache.Valid will be 'true' when the cache was successfully refreshed and 'false' if the last refresh failed.
-	Valid   bool
-	spaces  []cfclient.Space
-	guidMap map[string]cfclient.Space
-	nameMap map[string]cfclient.Space
-	logger  *zap.SugaredLogger
+	Valid bool
+	// SpaceCache.LabelsValid will be 'false' if the space labels could not be refreshed, even if the spaces were.
+	LabelsValid bool
+	spaces      []cfclient.Space
+	guidMap     map[string]cfclient.Space
+	nameMap     map[string]cfclient.Space
+	labelMap    map[string]map[string]string
+	logger      *zap.SugaredLogger
 }
 
 func (cache *SpaceCache) refresh(wg *sync.WaitGroup) {
@@ -382,17 +448,78 @@ func (cache *SpaceCache) refresh(wg *sync.WaitGroup) {
 		return
 	}
 
+	// Labels are only needed by label checks and selectors, so the spaces are
+	// kept valid without them
+	v3ResourceList, err := client.ListV3SpacesByQuery(url.Values{})
+	if err != nil {
+		cache.logger.Warnw("failed refreshing space labels", "error", err)
+	}
+
 	// Convert the space data to a map so that lookups can be performed without iterating over the data every time
 	guidMap := make(map[string]cfclient.Space)
 	nameMap := make(map[string]cfclient.Space)
+	labelMap := make(map[string]map[string]string)
 
 	for _, elem := range resourceList {
 		nameMap[elem.Name] = elem
 		guidMap[elem.Guid] = elem
 	}
 
+	for _, elem := range v3ResourceList {
+		labelMap[elem.Name] = elem.Metadata.Labels
+	}
+
 	cache.spaces = resourceList
 	cache.guidMap = guidMap
 	cache.nameMap = nameMap
+	cache.labelMap = labelMap
+	cache.Valid = true
+	cache.LabelsValid = err == nil
+}
+
+// ServiceBindingCache holds the most recently scraped CF service binding information
+type ServiceBindingCache struct {
+	// ServiceBindingCache.Valid will be 'true' when the cache was successfully refreshed and 'false' if the last refresh failed.
+	Valid bool
+	// appServices maps app GUIDs to the names of the service instances bound to the app
+	appServices map[string][]string
+	logger      *zap.SugaredLogger
+}
+
+func (cache *ServiceBindingCache) refresh(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Retrieve the service instance and app binding data from cloud.gov
+	instanceList, err := client.ListV3ServiceInstances()
+	if err != nil {
+		cache.Valid = false
+		cache.logger.Infow("failed refreshing service instances", "error", err)
+		return
+	}
+
+	bindingList, err := client.ListV3ServiceCredentialBindingsByQuery(url.Values{"type": []string{"app"}})
+	if err != nil {
+		cache.Valid = false
+		cache.logger.Infow("failed refreshing service bindings", "error", err)
+		return
+	}
+
+	// Convert the binding data to a map so that lookups can be performed without iterating over the data every time
+	instanceNames := make(map[string]string)
+	for _, elem := range instanceList {
+		instanceNames[elem.Guid] = elem.Name
+	}
+
+	appServices := make(map[string][]string)
+	for _, elem := range bindingList {
+		appGUID := elem.Relationships["app"].Data.GUID
+		instanceName, ok := instanceNames[elem.Relationships["service_instance"].Data.GUID]
+		if !ok {
+			continue
+		}
+		appServices[appGUID] = append(appServices[appGUID], instanceName)
+	}
+
+	cache.appServices = appServices
 	cache.Valid = true
 }